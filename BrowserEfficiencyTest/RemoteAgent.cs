@@ -8,10 +8,14 @@ namespace BrowserEfficiencyTest
         public string DefaultHost = "localhost";
         public string DefaultPort = "8086";
         public string DefaultPortTLS = "8087";
+        public string Token = "";
+        public string HmacKey = "";
 
         public RemoteAgent()
         {
             RemoteAgentConfig config = GetConfig();
+            Token = config.Token ?? "";
+            HmacKey = config.HmacKey ?? "";
             if (config.Host != DefaultHost) {
                 DefaultHost = config.Host;
                 DefaultPort = config.Port;
@@ -19,12 +23,16 @@ namespace BrowserEfficiencyTest
             }
         }
 
-        public string Execute(string cmd, string args)
+        // Optional working directory must be absolute, timeout is like "30s"
+        public string Execute(string cmd, string args, string cwd = null, System.Collections.Generic.Dictionary<string, string> env = null, string timeout = null)
         {
             var remoteCmd = new RemoteAgentCommand
             {
                 Cmd = cmd,
-                Args = args
+                Args = args,
+                Cwd = cwd,
+                Env = env,
+                Timeout = timeout
             };
 
             HttpResponseMessage response = null;
@@ -35,6 +43,7 @@ namespace BrowserEfficiencyTest
                     var uri = new System.Uri($"http://{DefaultHost}:{DefaultPort}/");
                     string cmdJson = Newtonsoft.Json.JsonConvert.SerializeObject(remoteCmd);
                     var stringContent = new StringContent(cmdJson, System.Text.Encoding.UTF8, "application/json");
+                    Authenticate(client, "PUT", uri.AbsolutePath, uri.Query.TrimStart('?'), cmdJson);
                     Logger.LogWriteLine($"RemoteAgent.SendCommand: '{uri.ToString()}' '{cmdJson}'");
                     response = client.PutAsync(uri, stringContent).Result;
                 }
@@ -47,6 +56,27 @@ namespace BrowserEfficiencyTest
             return response.ToString();
         }
 
+        // Signs request by HMAC key if it is configured, otherwise sends token, query is without "?"
+        private void Authenticate(HttpClient client, string method, string path, string query, string body)
+        {
+            if (HmacKey != "")
+            {
+                string timestamp = System.DateTimeOffset.UtcNow.ToUnixTimeSeconds().ToString();
+                using (var hmac = new System.Security.Cryptography.HMACSHA256(System.Text.Encoding.UTF8.GetBytes(HmacKey)))
+                {
+                    byte[] hash = hmac.ComputeHash(System.Text.Encoding.UTF8.GetBytes($"{timestamp}\n{method}\n{path}\n{query}\n{body}"));
+                    client.DefaultRequestHeaders.Add("X-RemoteAgent-Timestamp", timestamp);
+                    client.DefaultRequestHeaders.Add("X-RemoteAgent-Signature", System.BitConverter.ToString(hash).Replace("-", "").ToLower());
+                }
+                return;
+            }
+
+            if (Token != "")
+            {
+                client.DefaultRequestHeaders.Add("Authorization", $"Bearer {Token}");
+            }
+        }
+
         private RemoteAgentConfig GetConfig()
         {
             string cwd = System.IO.Directory.GetCurrentDirectory();
@@ -75,6 +105,15 @@ namespace BrowserEfficiencyTest
 
         [Newtonsoft.Json.JsonProperty("args")]
         public string Args { get; set; }
+
+        [Newtonsoft.Json.JsonProperty("cwd", NullValueHandling = Newtonsoft.Json.NullValueHandling.Ignore)]
+        public string Cwd { get; set; }
+
+        [Newtonsoft.Json.JsonProperty("env", NullValueHandling = Newtonsoft.Json.NullValueHandling.Ignore)]
+        public System.Collections.Generic.Dictionary<string, string> Env { get; set; }
+
+        [Newtonsoft.Json.JsonProperty("timeout", NullValueHandling = Newtonsoft.Json.NullValueHandling.Ignore)]
+        public string Timeout { get; set; }
     }
 
     public class RemoteAgentConfig
@@ -87,6 +126,12 @@ namespace BrowserEfficiencyTest
 
         [Newtonsoft.Json.JsonProperty("portTls")]
         public string PortTls { get; set; }
+
+        [Newtonsoft.Json.JsonProperty("token")]
+        public string Token { get; set; }
+
+        [Newtonsoft.Json.JsonProperty("hmacKey")]
+        public string HmacKey { get; set; }
     }
 }
 
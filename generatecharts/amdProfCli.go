@@ -23,6 +23,8 @@ const (
 	symbolsCacheDirChrome        = "SymbolsCacheChrome"
 	symbolsCacheDirChromium      = "SymbolsCacheChromium"
 	amdProfCliReportAllProcesses = "ALL PROCESSES (Sort Event - Energy)"
+	amdProfCliReportAllModules   = "ALL MODULES (Sort Event - Energy)"
+	amdProfCliReportAllFunctions = "ALL FUNCTIONS (Sort Event - Energy)"
 )
 
 func generateChartsForAmdProfCliFiles(files []os.FileInfo) error {
@@ -127,6 +129,29 @@ func getSymbolsArgs(browserShortName string) ([]string, error) {
 	args := []string{}
 	symbolsServer := symbolsServerMicrosoft
 
+	// Symbols imported or fetched before to local symbol store
+	storeVersion, _, err := symbolsGetBrowserVersion(browserShortName)
+	if err != nil {
+		return []string{}, fmt.Errorf("failed to symbolsGetBrowserVersion(%s): %s\n", browserShortName, err)
+	}
+	storeDir := symbolsGetStoreDir(browserShortName, storeVersion)
+	if _, err := os.Stat(storeDir); storeVersion != "" && err == nil {
+		args = append(
+			args,
+			[]string{
+				"--symbol-path", storeDir,
+				"--symbol-cache-dir", filepath.Join(*symbolStore, symbolsSystem),
+			}...,
+		)
+		if *symbolsOffline {
+			return args, nil
+		}
+		return append(args, "--symbol-server", symbolsServer), nil
+	}
+	if *symbolsOffline {
+		return []string{}, fmt.Errorf("no symbols of %s %s in symbol store %s", browserShortName, storeVersion, *symbolStore)
+	}
+
 	v, err := getBrowserVersion(browserShortName)
 	if err != nil {
 		return []string{}, fmt.Errorf("failed to getBrowserVersion(%s): %s\n", browserShortName, err)
@@ -174,19 +199,47 @@ func getSymbolsArgs(browserShortName string) ([]string, error) {
 }
 
 func amdProfCliGetMeasures(csvFilePath string) ([]Measure, error) {
-	csvFile, err := os.Open(csvFilePath)
+	metaMeasure, err := generalGetFileMeta(csvFilePath)
 	if err != nil {
 		return nil, err
 	}
-	defer csvFile.Close()
 
-	metaMeasure, err := generalGetFileMeta(csvFilePath)
+	dataParts, err := amdProfCliReadSections(csvFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	processParts := map[string]func([][]string, Measure) []Measure{
+		amdProfCliReportAllProcesses: amdProfCliReportAllProcessesFunc,
+	}
+
+	var msrs []Measure
+
+	for part, f := range processParts {
+		records := dataParts[part]
+		if len(records) > 0 {
+			//fmt.Printf("%s \n %s \n %s:\n", csvFilePath, part)
+			tmpMsrs := f(records, metaMeasure)
+			msrs = append(msrs, tmpMsrs...)
+		}
+	}
+
+	//fmt.Printf("%#v\n", msrs)
+	return msrs, nil
+}
+
+// Returns records of known report sections: section title > records
+func amdProfCliReadSections(csvFilePath string) (map[string][][]string, error) {
+	csvFile, err := os.Open(csvFilePath)
 	if err != nil {
 		return nil, err
 	}
+	defer csvFile.Close()
 
 	dataParts := map[string]string{
 		amdProfCliReportAllProcesses: "",
+		amdProfCliReportAllModules:   "",
+		amdProfCliReportAllFunctions: "",
 	}
 
 	scanner := bufio.NewReader(csvFile)
@@ -202,6 +255,7 @@ func amdProfCliGetMeasures(csvFilePath string) ([]Measure, error) {
 
 		for part, _ := range dataParts {
 			if line == fmt.Sprintf("%s\r\n", part) {
+				header := true
 				for {
 					dataline, err := scanner.ReadString('\n')
 					if err == io.EOF {
@@ -215,7 +269,12 @@ func amdProfCliGetMeasures(csvFilePath string) ([]Measure, error) {
 						break
 					}
 					//fmt.Printf("in file: %s\nin part: %s:\ndataline: %s\nerr: %v\n", csvFilePath, part, dataline, err)
-					dataline = strings.Replace(dataline, `"`, ``, -1)
+					// Header has quotes inside fields like "Energy" (milli Joules), data rows are quoted CSV
+					// with names like "base::Bind<int,int>"
+					if header {
+						dataline = strings.Replace(dataline, `"`, ``, -1)
+						header = false
+					}
 					dataParts[part] += strings.Trim(dataline, " ")
 				}
 			}
@@ -223,27 +282,17 @@ func amdProfCliGetMeasures(csvFilePath string) ([]Measure, error) {
 	}
 	//fmt.Printf("%#v\n", dataParts)
 
-	processParts := map[string]func([][]string, Measure) []Measure{
-		amdProfCliReportAllProcesses: amdProfCliReportAllProcessesFunc,
-	}
-
-	var msrs []Measure
-
-	for part, f := range processParts {
-		records, err := getRecordsFromString(dataParts[part], ',')
+	sections := map[string][][]string{}
+	for part, data := range dataParts {
+		records, err := getRecordsFromString(data, ',')
 		if err != nil {
-			fmt.Printf("%s\n%s\n%s\n", csvFilePath, part, err)
+			dataQualityAdd(dataQualityUnparseable, csvFilePath, Measure{}, "section %s: %s", part, err)
 			continue
 		}
-		if len(records) > 0 {
-			//fmt.Printf("%s \n %s \n %s:\n", csvFilePath, part)
-			tmpMsrs := f(records, metaMeasure)
-			msrs = append(msrs, tmpMsrs...)
-		}
+		sections[part] = records
 	}
 
-	//fmt.Printf("%#v\n", msrs)
-	return msrs, nil
+	return sections, nil
 }
 
 func amdProfCliReportAllProcessesFunc(records [][]string, meta Measure) []Measure {
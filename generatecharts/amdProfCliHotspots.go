@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	amdProfCliHotspotsReport   = "amdProfCliHotspots"
+	amdProfCliHotspotsTopN     = 15
+	amdProfCliHotspotsJsonFile = amdProfCliHotspotsReport + ".json"
+)
+
+type amdProfCliHotspot struct {
+	Name    string  `json:"Name"`
+	Module  string  `json:"Module"`
+	Energy  float64 `json:"Energy"`  // milli Joules
+	CpuTime float64 `json:"CpuTime"` // seconds
+	// Filled for diffs only
+	EnergyDiff        float64 `json:"EnergyDiff,omitempty"`
+	EnergyDiffPercent float64 `json:"EnergyDiffPercent,omitempty"`
+}
+
+type amdProfCliHotspotSortByEnergy []amdProfCliHotspot
+
+func (s amdProfCliHotspotSortByEnergy) Len() int {
+	return len(s)
+}
+func (s amdProfCliHotspotSortByEnergy) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s amdProfCliHotspotSortByEnergy) Less(i, j int) bool {
+	return s[i].Energy > s[j].Energy
+}
+
+type amdProfCliHotspotSortByEnergyDiff []amdProfCliHotspot
+
+func (s amdProfCliHotspotSortByEnergyDiff) Len() int {
+	return len(s)
+}
+func (s amdProfCliHotspotSortByEnergyDiff) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s amdProfCliHotspotSortByEnergyDiff) Less(i, j int) bool {
+	return s[i].EnergyDiff*s[i].EnergyDiff > s[j].EnergyDiff*s[j].EnergyDiff
+}
+
+// Hotspots of one browser in one scenario averaged over iterations
+type amdProfCliBrowserHotspots struct {
+	Browser    string              `json:"Browser"`
+	Scenario   string              `json:"Scenario"`
+	Iterations int                 `json:"Iterations"`
+	Modules    []amdProfCliHotspot `json:"Modules"`
+	Functions  []amdProfCliHotspot `json:"Functions"`
+	// Filled for report only
+	ModulesVsBaselineRun   []amdProfCliHotspot `json:"-"`
+	FunctionsVsBaselineRun []amdProfCliHotspot `json:"-"`
+}
+
+type amdProfCliBrowserDiff struct {
+	Scenario  string
+	Browser   string
+	Versus    string
+	Modules   []amdProfCliHotspot
+	Functions []amdProfCliHotspot
+}
+
+type amdProfCliHotspotsReportData struct {
+	Hotspots     []amdProfCliBrowserHotspots
+	BrowserDiffs []amdProfCliBrowserDiff
+	BaselineRun  string
+}
+
+func generateAmdProfCliHotspotsReport(files []os.FileInfo) error {
+	// scenario > browser > hotspots
+	grouped := map[string]map[string]*amdProfCliBrowserHotspots{}
+	// scenario > browser > "module" or "function" > name > accumulated hotspot
+	accum := map[string]map[string]map[string]map[string]amdProfCliHotspot{}
+
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".pdata" {
+			continue
+		}
+
+		subDir := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+		csvFilePath := filepath.Join(*csvPath, amdProfCli, subDir, subDir+".csv")
+
+		meta, err := generalGetFileMeta(csvFilePath)
+		if err != nil {
+			return err
+		}
+		sections, err := amdProfCliReadSections(csvFilePath)
+		if err != nil {
+			return fmt.Errorf("%s: %v", csvFilePath, err)
+		}
+
+		if grouped[meta.scenarioName] == nil {
+			grouped[meta.scenarioName] = map[string]*amdProfCliBrowserHotspots{}
+			accum[meta.scenarioName] = map[string]map[string]map[string]amdProfCliHotspot{}
+		}
+		if grouped[meta.scenarioName][meta.browser] == nil {
+			grouped[meta.scenarioName][meta.browser] = &amdProfCliBrowserHotspots{
+				Browser:  meta.browser,
+				Scenario: meta.scenarioName,
+			}
+			accum[meta.scenarioName][meta.browser] = map[string]map[string]amdProfCliHotspot{
+				"module":   {},
+				"function": {},
+			}
+		}
+		grouped[meta.scenarioName][meta.browser].Iterations++
+
+		modules := amdProfCliBrowserModules(sections, meta)
+		for kind, section := range map[string]string{"module": amdProfCliReportAllModules, "function": amdProfCliReportAllFunctions} {
+			for _, hotspot := range amdProfCliGetHotspots(sections[section]) {
+				if (kind == "module" && !modules[hotspot.Name]) || (kind == "function" && !modules[hotspot.Module]) {
+					continue
+				}
+				key := hotspot.Module + "!" + hotspot.Name
+				tmp := accum[meta.scenarioName][meta.browser][kind][key]
+				tmp.Name = hotspot.Name
+				tmp.Module = hotspot.Module
+				tmp.Energy += hotspot.Energy
+				tmp.CpuTime += hotspot.CpuTime
+				accum[meta.scenarioName][meta.browser][kind][key] = tmp
+			}
+		}
+	}
+
+	var hotspots []amdProfCliBrowserHotspots
+	for scenario, browsers := range grouped {
+		for browser, browserHotspots := range browsers {
+			for kind, kindHotspots := range accum[scenario][browser] {
+				var l []amdProfCliHotspot
+				for _, hotspot := range kindHotspots {
+					hotspot.Energy = hotspot.Energy / float64(browserHotspots.Iterations)
+					hotspot.CpuTime = hotspot.CpuTime / float64(browserHotspots.Iterations)
+					l = append(l, hotspot)
+				}
+				sort.Sort(amdProfCliHotspotSortByEnergy(l))
+				if kind == "module" {
+					browserHotspots.Modules = l
+				} else {
+					browserHotspots.Functions = l
+				}
+			}
+			hotspots = append(hotspots, *browserHotspots)
+		}
+	}
+	if len(hotspots) == 0 {
+		return nil
+	}
+	sort.Slice(hotspots, func(i, j int) bool {
+		if hotspots[i].Scenario != hotspots[j].Scenario {
+			return hotspots[i].Scenario < hotspots[j].Scenario
+		}
+		return hotspots[i].Browser < hotspots[j].Browser
+	})
+
+	// Keep full lists for future runs comparing
+	jsonFilePath := filepath.Join(*csvPath, amdProfCli, amdProfCliHotspotsJsonFile)
+	jsonFile, err := os.Create(jsonFilePath)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(jsonFile).Encode(hotspots)
+	if err != nil {
+		jsonFile.Close()
+		return fmt.Errorf("failed to json encode %s: %s", jsonFilePath, err)
+	}
+	err = ioClose(jsonFilePath, jsonFile)
+	if err != nil {
+		return err
+	}
+
+	report := amdProfCliHotspotsReportData{
+		BaselineRun: *amdProfCliBaselineRun,
+	}
+
+	var baseline []amdProfCliBrowserHotspots
+	if *amdProfCliBaselineRun != "" {
+		baseline, err = amdProfCliLoadHotspots(filepath.Join(*amdProfCliBaselineRun, amdProfCli, amdProfCliHotspotsJsonFile))
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, browserHotspots := range hotspots {
+		for _, baselineHotspots := range baseline {
+			if baselineHotspots.Scenario == browserHotspots.Scenario && baselineHotspots.Browser == browserHotspots.Browser {
+				hotspots[i].ModulesVsBaselineRun = amdProfCliDiffHotspots(browserHotspots.Modules, baselineHotspots.Modules)
+				hotspots[i].FunctionsVsBaselineRun = amdProfCliDiffHotspots(browserHotspots.Functions, baselineHotspots.Functions)
+			}
+		}
+
+		// Diffs against Yandex Browser like diff bars on charts
+		if browserHotspots.Browser == yaBrowserProcessName {
+			continue
+		}
+		yaBrowserHotspots, found := grouped[browserHotspots.Scenario][yaBrowserProcessName]
+		if !found {
+			continue
+		}
+		report.BrowserDiffs = append(report.BrowserDiffs, amdProfCliBrowserDiff{
+			Scenario:  browserHotspots.Scenario,
+			Browser:   yaBrowserProcessName,
+			Versus:    browserHotspots.Browser,
+			Modules:   amdProfCliTopN(amdProfCliDiffHotspots(yaBrowserHotspots.Modules, browserHotspots.Modules)),
+			Functions: amdProfCliTopN(amdProfCliDiffHotspots(yaBrowserHotspots.Functions, browserHotspots.Functions)),
+		})
+	}
+
+	for i := range hotspots {
+		hotspots[i].Modules = amdProfCliTopN(hotspots[i].Modules)
+		hotspots[i].Functions = amdProfCliTopN(hotspots[i].Functions)
+		hotspots[i].ModulesVsBaselineRun = amdProfCliTopN(hotspots[i].ModulesVsBaselineRun)
+		hotspots[i].FunctionsVsBaselineRun = amdProfCliTopN(hotspots[i].FunctionsVsBaselineRun)
+	}
+	report.Hotspots = hotspots
+
+	return amdProfCliHotspotsWriteHtml(amdProfCliHotspotsReport+".html", report)
+}
+
+func amdProfCliHotspotsWriteHtml(fileName string, report amdProfCliHotspotsReportData) error {
+	t, err := template.New(amdProfCliHotspotsReport).Parse(amdProfCliHotspotsReportTpl)
+	if err != nil {
+		return err
+	}
+
+	htmlFile, err := os.Create(filepath.Join(*csvPath, fileName))
+	if err != nil {
+		return err
+	}
+
+	err = t.Execute(htmlFile, report)
+	if err != nil {
+		htmlFile.Close()
+		return fmt.Errorf("failed to generate %s: %s", fileName, err)
+	}
+
+	return ioClose(fileName, htmlFile)
+}
+
+func amdProfCliGetHotspots(records [][]string) []amdProfCliHotspot {
+	/*
+		ALL MODULES (Sort Event - Energy)
+		MODULE,"Energy" (milli Joules),"CPU Time" (seconds)
+		C:\WINDOWS\system32\ntoskrnl.exe,5281.332,21.014
+		C:\Users\user\AppData\Local\Yandex\YandexBrowser\Application\18.6.0.742\browser.dll,201.102,0.322
+
+		ALL FUNCTIONS (Sort Event - Energy)
+		FUNCTION,"Energy" (milli Joules),"CPU Time" (seconds),MODULE
+		KiIdleLoop,1021.332,9.011,ntoskrnl.exe
+		base::MessagePumpForUI::DoRunLoop,52.123,0.082,browser.dll
+	*/
+	var hotspots []amdProfCliHotspot
+	if len(records) < 2 {
+		return hotspots
+	}
+
+	colName := 0
+	colEnergy := -1
+	colCpuTime := -1
+	colModule := -1
+	for colId, header := range records[0] {
+		switch {
+		case colId == colName:
+		case strings.Contains(header, "Energy"):
+			colEnergy = colId
+		case strings.Contains(header, "CPU Time"):
+			colCpuTime = colId
+		case strings.Contains(strings.ToUpper(header), "MODULE"):
+			colModule = colId
+		}
+	}
+	if colEnergy < 0 {
+		fmt.Printf("amdProfCliGetHotspots: no Energy column in headers %v\n", records[0])
+		return hotspots
+	}
+
+	for _, row := range records[1:] {
+		hotspot := amdProfCliHotspot{
+			Name: strings.Trim(row[colName], " "),
+		}
+		if colModule >= 0 {
+			hotspot.Module = amdProfCliBaseName(row[colModule])
+		} else {
+			hotspot.Name = amdProfCliBaseName(row[colName]) // modules table
+		}
+		val, err := strconv.ParseFloat(row[colEnergy], 64)
+		if err != nil {
+			fmt.Printf("failed parse '%s': %v\n", row[colEnergy], err)
+			continue
+		}
+		hotspot.Energy = val
+		if colCpuTime >= 0 {
+			val, err = strconv.ParseFloat(row[colCpuTime], 64)
+			if err != nil {
+				fmt.Printf("failed parse '%s': %v\n", row[colCpuTime], err)
+				continue
+			}
+			hotspot.CpuTime = val
+		}
+		hotspots = append(hotspots, hotspot)
+	}
+
+	return hotspots
+}
+
+// Module paths differ between browsers and machines, compare by file name only
+//
+// "C:\WINDOWS\system32\ntoskrnl.exe" > "ntoskrnl.exe"
+// " (PID - 6688)" suffix of process in ALL PROCESSES section
+var amdProfCliPidRegExp = regexp.MustCompile(` \(PID - [0-9]+\)$`)
+
+// Returns lower case base names of browser executables and modules in their directories.
+// ALL MODULES and ALL FUNCTIONS sections are system-wide and have no process column,
+// so modules of browser are found by path of browser processes in ALL PROCESSES section.
+func amdProfCliBrowserModules(sections map[string][][]string, meta Measure) map[string]bool {
+	modules := map[string]bool{}
+	var dirs []string
+	for _, row := range sections[amdProfCliReportAllProcesses] {
+		if len(row) == 0 {
+			continue
+		}
+		path := strings.ToLower(amdProfCliPidRegExp.ReplaceAllString(strings.Trim(row[0], " "), ""))
+		for _, process := range meta.browserProcesses {
+			if amdProfCliBaseName(path) != strings.ToLower(process) {
+				continue
+			}
+			modules[amdProfCliBaseName(path)] = true
+			if dir := path[:strings.LastIndexAny(path, `\/`)+1]; dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+
+	for _, row := range sections[amdProfCliReportAllModules] {
+		if len(row) == 0 {
+			continue
+		}
+		path := strings.ToLower(strings.Trim(row[0], " "))
+		for _, dir := range dirs {
+			if strings.HasPrefix(path, dir) {
+				modules[amdProfCliBaseName(path)] = true
+			}
+		}
+	}
+	return modules
+}
+
+func amdProfCliBaseName(path string) string {
+	path = strings.Trim(path, " ")
+	return strings.ToLower(path[strings.LastIndexAny(path, `\/`)+1:])
+}
+
+// Returns hotspots of current minus hotspots of other sorted by absolute diff
+func amdProfCliDiffHotspots(current, other []amdProfCliHotspot) []amdProfCliHotspot {
+	otherEnergy := map[string]float64{}
+	byKey := map[string]amdProfCliHotspot{}
+	for _, hotspot := range other {
+		key := hotspot.Module + "!" + hotspot.Name
+		otherEnergy[key] = hotspot.Energy
+		hotspot.Energy = 0
+		byKey[key] = hotspot
+	}
+	for _, hotspot := range current {
+		byKey[hotspot.Module+"!"+hotspot.Name] = hotspot
+	}
+
+	var diffs []amdProfCliHotspot
+	for key, hotspot := range byKey {
+		hotspot.EnergyDiff = hotspot.Energy - otherEnergy[key]
+		if hotspot.EnergyDiff == 0 {
+			continue
+		}
+		if otherEnergy[key] > 0 {
+			hotspot.EnergyDiffPercent = hotspot.EnergyDiff * 100 / otherEnergy[key]
+		}
+		diffs = append(diffs, hotspot)
+	}
+	sort.Sort(amdProfCliHotspotSortByEnergyDiff(diffs))
+
+	return diffs
+}
+
+func amdProfCliTopN(hotspots []amdProfCliHotspot) []amdProfCliHotspot {
+	if len(hotspots) > amdProfCliHotspotsTopN {
+		return hotspots[:amdProfCliHotspotsTopN]
+	}
+	return hotspots
+}
+
+func amdProfCliLoadHotspots(jsonFilePath string) ([]amdProfCliBrowserHotspots, error) {
+	var hotspots []amdProfCliBrowserHotspots
+	content, err := ioutil.ReadFile(jsonFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline run hotspots %s: %s", jsonFilePath, err)
+	}
+	err = json.Unmarshal(content, &hotspots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode baseline run hotspots %s: %s", jsonFilePath, err)
+	}
+
+	return hotspots, nil
+}
+
+const amdProfCliHotspotsReportTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8">
+		<title>Top energy-consuming modules and functions</title>
+		<style>
+			table { border-collapse: collapse; margin-bottom: 16px; }
+			td, th { border: 1px solid #ccc; padding: 2px 6px; }
+			.more { color: #c00000; }
+			.less { color: #008000; }
+		</style>
+	</head>
+	<body>
+		{{define "hotspots"}}
+			<table>
+				<tr><th>#</th><th>Name</th><th>Module</th><th>Energy (mJ)</th><th>CPU Time (s)</th></tr>
+				{{range $i, $h := .}}
+				<tr><td>{{$i}}</td><td>{{$h.Name}}</td><td>{{$h.Module}}</td><td>{{printf "%.3f" $h.Energy}}</td><td>{{printf "%.3f" $h.CpuTime}}</td></tr>
+				{{end}}
+			</table>
+		{{end}}
+		{{define "diffs"}}
+			<table>
+				<tr><th>#</th><th>Name</th><th>Module</th><th>Energy (mJ)</th><th>Diff (mJ)</th><th>Diff %</th></tr>
+				{{range $i, $h := .}}
+				<tr class="{{if gt $h.EnergyDiff 0.0}}more{{else}}less{{end}}"><td>{{$i}}</td><td>{{$h.Name}}</td><td>{{$h.Module}}</td><td>{{printf "%.3f" $h.Energy}}</td><td>{{printf "%+.3f" $h.EnergyDiff}}</td><td>{{printf "%+.0f" $h.EnergyDiffPercent}}%</td></tr>
+				{{end}}
+			</table>
+		{{end}}
+
+		<h2>Top modules and functions per browser</h2>
+		<p>Modules of browser are its executables and modules in their directories, system modules are not listed.</p>
+		{{range $hs := .Hotspots}}
+			<h3>{{$hs.Scenario}}: {{$hs.Browser}} ({{$hs.Iterations}} iterations)</h3>
+			<p>Modules</p>
+			{{template "hotspots" $hs.Modules}}
+			<p>Functions</p>
+			{{template "hotspots" $hs.Functions}}
+			{{if $hs.ModulesVsBaselineRun}}
+				<p>Modules vs baseline run {{$.BaselineRun}}</p>
+				{{template "diffs" $hs.ModulesVsBaselineRun}}
+			{{end}}
+			{{if $hs.FunctionsVsBaselineRun}}
+				<p>Functions vs baseline run {{$.BaselineRun}}</p>
+				{{template "diffs" $hs.FunctionsVsBaselineRun}}
+			{{end}}
+		{{else}}
+			<div><strong>no rows</strong></div>
+		{{end}}
+
+		<h2>Diffs between browsers</h2>
+		{{range $d := .BrowserDiffs}}
+			<h3>{{$d.Scenario}}: {{$d.Browser}} vs {{$d.Versus}}</h3>
+			<p>Modules</p>
+			{{template "diffs" $d.Modules}}
+			<p>Functions</p>
+			{{template "diffs" $d.Functions}}
+		{{end}}
+	</body>
+</html>`
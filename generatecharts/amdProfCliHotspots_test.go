@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const amdProfCliHotspotsTestCsv = "ALL PROCESSES (Sort Event - Energy)\r\n" +
+	"PROCESS,\"Energy\" (milli Joules),\"CPU Time\" (seconds)\r\n" +
+	"System Idle (PID - 0),12475.300,147.083\r\n" +
+	"C:\\Users\\user\\AppData\\Local\\Yandex\\YandexBrowser\\Application\\browser.exe (PID - 6688),267.393,0.428\r\n" +
+	"C:\\Program Files\\Google\\Chrome\\Application\\chrome.exe (PID - 7012),167.393,0.328\r\n" +
+	"\r\n" +
+	"ALL MODULES (Sort Event - Energy)\r\n" +
+	"MODULE,\"Energy\" (milli Joules),\"CPU Time\" (seconds)\r\n" +
+	"C:\\WINDOWS\\system32\\ntoskrnl.exe,5281.332,21.014\r\n" +
+	"C:\\Users\\user\\AppData\\Local\\Yandex\\YandexBrowser\\Application\\18.6.0.742\\browser.dll,201.102,0.322\r\n" +
+	"C:\\Program Files\\Google\\Chrome\\Application\\66.0.3359.139\\chrome.dll,101.102,0.222\r\n" +
+	"\r\n" +
+	"ALL FUNCTIONS (Sort Event - Energy)\r\n" +
+	"FUNCTION,\"Energy\" (milli Joules),\"CPU Time\" (seconds),MODULE\r\n" +
+	"KiIdleLoop,1021.332,9.011,ntoskrnl.exe\r\n" +
+	"base::MessagePumpForUI::DoRunLoop,52.123,0.082,browser.dll\r\n" +
+	"\"base::internal::Invoker<int,int>::Run\",42.456,0.072,chrome.dll\r\n" +
+	"\r\n"
+
+func TestGenerateAmdProfCliHotspotsReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amdProfCliHotspots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldCsvPath := *csvPath
+	*csvPath = dir
+	defer func() { *csvPath = oldCsvPath }()
+
+	for _, name := range []string{"yabro_youtube_1_amdProfCli_20180120_224843-1", "chrome_youtube_1_amdProfCli_20180120_225843-1"} {
+		err = os.MkdirAll(filepath.Join(dir, amdProfCli, name), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, amdProfCli, name+".pdata"), nil, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, amdProfCli, name, name+".csv"), []byte(amdProfCliHotspotsTestCsv), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, amdProfCli))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = generateAmdProfCliHotspotsReport(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := ioutil.ReadFile(filepath.Join(dir, amdProfCliHotspotsReport+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"youtube: browser.exe (1 iterations)", "youtube: browser.exe vs chrome.exe", "DoRunLoop", "201.102", "base::internal::Invoker&lt;int,int&gt;::Run", "42.456"} {
+		if !strings.Contains(string(html), expected) {
+			t.Errorf("report has no '%s':\n%s", expected, html)
+		}
+	}
+	// System-wide modules are not browser ones
+	for _, unexpected := range []string{"KiIdleLoop", "ntoskrnl.exe"} {
+		if strings.Contains(string(html), unexpected) {
+			t.Errorf("report has '%s'", unexpected)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/wcharczuk/go-chart"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Native results of standard benchmark suites in files like
+// chrome_default_0_speedometer_20180120_224843.json
+const (
+	benchmarkMeasureSet  = "benchmark"
+	benchmarkSpeedometer = "speedometer"
+	benchmarkJetStream   = "jetstream"
+	benchmarkMotionMark  = "motionmark"
+	benchmarkOctane      = "octane"
+	// Speedometer 2 score is 60 * 1000 / geomean of suites totals / correction factor
+	benchmarkSpeedometer2CorrectionFactor = 3.0
+)
+
+type benchmarkScore struct {
+	name           string
+	unit           string
+	biggerIsBetter bool
+	values         []float64 // one value per run of suite
+}
+
+type benchmarkParser func(content []byte) ([]benchmarkScore, error)
+
+var benchmarkParsers = map[string]benchmarkParser{
+	benchmarkSpeedometer: benchmarkParseSpeedometer,
+	benchmarkJetStream:   benchmarkParseJetStream,
+	benchmarkMotionMark:  benchmarkParseMotionMark,
+	benchmarkOctane:      benchmarkParseOctane,
+}
+
+// Octane d8 run.js output like "Richards: 28342" and "Score (version 9): 32521"
+var benchmarkOctaneLineRegExp = regexp.MustCompile(`^([A-Za-z0-9]+)(\s*\(version [0-9]+\))?:\s*([0-9.]+)\s*$`)
+
+func generateChartsForBenchmarkSuiteFiles(files []os.FileInfo) error {
+	measures := []Measure{}
+
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if ext != ".json" && ext != ".txt" {
+			continue
+		}
+
+		tokens := strings.Split(f.Name(), "_")
+		if len(tokens) < 6 {
+			continue
+		}
+		parser, found := benchmarkParsers[strings.ToLower(tokens[3])]
+		if !found {
+			continue
+		}
+
+		m, err := benchmarkGetMeasures(filepath.Join(*csvPath, f.Name()), parser)
+		if err != nil {
+			fmt.Printf("benchmark %s err %v", f.Name(), err)
+			return err
+		}
+		measures = append(measures, m...)
+	}
+
+	raw := groupMeasuresBySet(measures)
+	chartBars := benchmarkAddVariance(getChartBarsFromRawResults(raw, 2), raw, 2)
+
+	for measureSet, barValues := range chartBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	groupedBars := getIterationsBarsFromGroupedMeasures(groupMeasuresByIterations(measures), 2)
+	for measureSet, barValues := range groupedBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func benchmarkGetMeasures(filePath string, parser benchmarkParser) ([]Measure, error) {
+	msrs := []Measure{}
+
+	metaMeasure, err := generalGetFileMeta(filePath)
+	if err != nil {
+		return msrs, err
+	}
+	suite := strings.ToLower(metaMeasure.measureSet)
+	metaMeasure.measureSet = benchmarkMeasureSet + strings.Title(suite)
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return msrs, err
+	}
+	scores, err := parser(content)
+	if err != nil {
+		return msrs, fmt.Errorf("benchmarkGetMeasures: %s: %v", filePath, err)
+	}
+	if len(scores) == 0 {
+		return msrs, fmt.Errorf("benchmarkGetMeasures: %s: no %s scores found", filePath, suite)
+	}
+
+	for _, score := range scores {
+		m := metaMeasure
+		m.measureName = fmt.Sprintf("%s (%s)", score.name, score.unit)
+		if score.biggerIsBetter {
+			// Diff bars treat less as good by default
+			excludedFromBad[getMeasureSetFullName(m.measureSet, m.browser, m.measureName, m.scenarioName)] = true
+		}
+		for run, val := range score.values {
+			m.iteration = metaMeasure.iteration
+			if len(score.values) > 1 {
+				m.iteration = fmt.Sprintf("%s.%d", metaMeasure.iteration, run)
+			}
+			m.value = val
+			msrs = append(msrs, m)
+		}
+	}
+
+	return msrs, nil
+}
+
+// Speedometer 3 metrics like {"Score": {"unit": "score", "values": [...]}, "TodoMVC-React/Total": {...}}
+// or Speedometer 2 runs like [{"tests": {"VanillaJS-TodoMVC": {"total": 123.4, "tests": {...}}}, "total": 456.7}]
+func benchmarkParseSpeedometer(content []byte) ([]benchmarkScore, error) {
+	var metrics map[string]struct {
+		Unit   string    `json:"unit"`
+		Values []float64 `json:"values"`
+	}
+	if err := json.Unmarshal(content, &metrics); err == nil {
+		var scores []benchmarkScore
+		for name, metric := range metrics {
+			// Nested steps and per iteration totals are too many to chart
+			if strings.Contains(name, "/") || strings.HasPrefix(name, "Iteration-") || len(metric.Values) == 0 {
+				continue
+			}
+			scores = append(scores, benchmarkScore{
+				name:           name,
+				unit:           metric.Unit,
+				biggerIsBetter: metric.Unit == "score",
+				values:         metric.Values,
+			})
+		}
+		return scores, nil
+	}
+
+	var runs []struct {
+		Score float64 `json:"score"`
+		Total float64 `json:"total"`
+		Tests map[string]struct {
+			Total float64 `json:"total"`
+		} `json:"tests"`
+	}
+	if err := json.Unmarshal(content, &runs); err != nil {
+		return nil, fmt.Errorf("neither Speedometer 3 metrics nor Speedometer 2 runs: %v", err)
+	}
+
+	total := benchmarkScore{name: "Total", unit: "ms"}
+	score := benchmarkScore{name: "Score", unit: "runs per minute", biggerIsBetter: true}
+	suites := map[string]*benchmarkScore{}
+	for _, run := range runs {
+		var suiteTotals []float64
+		for suiteName, suite := range run.Tests {
+			if suites[suiteName] == nil {
+				suites[suiteName] = &benchmarkScore{name: suiteName, unit: "ms"}
+			}
+			suites[suiteName].values = append(suites[suiteName].values, suite.Total)
+			suiteTotals = append(suiteTotals, suite.Total)
+		}
+		total.values = append(total.values, run.Total)
+		if run.Score == 0 && len(suiteTotals) > 0 {
+			run.Score = 60 * 1000 / benchmarkGeomean(suiteTotals) / benchmarkSpeedometer2CorrectionFactor
+		}
+		score.values = append(score.values, run.Score)
+	}
+
+	scores := []benchmarkScore{score, total}
+	for _, suite := range suites {
+		scores = append(scores, *suite)
+	}
+	return scores, nil
+}
+
+// JetStream 2 resultsJSON() like {"JetStream2.0": {"tests": {"3d-cube-SP": {"metrics": {"Score": {"current": [123.4]}}}}}}
+// or resultsObject() like {"3d-cube-SP": {"Score": 123.4, "First": 10.1, "Worst": 8.2, "Average": 9.4}}
+func benchmarkParseJetStream(content []byte) ([]benchmarkScore, error) {
+	type metric struct {
+		Current []float64 `json:"current"`
+	}
+	var resultsJson map[string]struct {
+		Tests map[string]struct {
+			Metrics map[string]metric `json:"metrics"`
+		} `json:"tests"`
+	}
+	var tests map[string][]float64
+	if err := json.Unmarshal(content, &resultsJson); err == nil {
+		tests = map[string][]float64{}
+		for _, suite := range resultsJson {
+			for testName, test := range suite.Tests {
+				if score, found := test.Metrics["Score"]; found {
+					tests[testName] = score.Current
+				}
+			}
+		}
+	}
+
+	if len(tests) == 0 {
+		var resultsObject map[string]map[string]float64
+		if err := json.Unmarshal(content, &resultsObject); err != nil {
+			return nil, fmt.Errorf("neither JetStream resultsJSON nor resultsObject: %v", err)
+		}
+		tests = map[string][]float64{}
+		for testName, test := range resultsObject {
+			if score, found := test["Score"]; found {
+				tests[testName] = []float64{score}
+			}
+		}
+	}
+
+	return benchmarkScoresWithGeomean(tests, "score"), nil
+}
+
+// MotionMark results like {"score": 512.3, "iterationsResults": [{"score": 510.1, "testsResults": {"MotionMark": {"Multiply": {"score": 623.4}}}}]}
+func benchmarkParseMotionMark(content []byte) ([]benchmarkScore, error) {
+	type results struct {
+		IterationsResults []struct {
+			Score        float64                                       `json:"score"`
+			TestsResults map[string]map[string]struct{ Score float64 } `json:"testsResults"`
+		} `json:"iterationsResults"`
+	}
+	var r struct {
+		results
+		Results *results `json:"results"`
+	}
+	if err := json.Unmarshal(content, &r); err != nil {
+		return nil, err
+	}
+	if len(r.IterationsResults) == 0 && r.Results != nil {
+		r.results = *r.Results
+	}
+
+	score := benchmarkScore{name: "Score", unit: "score", biggerIsBetter: true}
+	tests := map[string]*benchmarkScore{}
+	for _, iteration := range r.IterationsResults {
+		score.values = append(score.values, iteration.Score)
+		for _, suite := range iteration.TestsResults {
+			for testName, test := range suite {
+				if tests[testName] == nil {
+					tests[testName] = &benchmarkScore{name: testName, unit: "score", biggerIsBetter: true}
+				}
+				tests[testName].values = append(tests[testName].values, test.Score)
+			}
+		}
+	}
+	if len(score.values) == 0 {
+		return nil, nil
+	}
+
+	scores := []benchmarkScore{score}
+	for _, test := range tests {
+		scores = append(scores, *test)
+	}
+	return scores, nil
+}
+
+// Octane d8 output or JSON like {"Richards": 28342, "Score": 32521}, runs are repeated outputs
+func benchmarkParseOctane(content []byte) ([]benchmarkScore, error) {
+	tests := map[string][]float64{}
+
+	var object map[string]float64
+	if err := json.Unmarshal(content, &object); err == nil {
+		for testName, val := range object {
+			tests[testName] = []float64{val}
+		}
+	} else {
+		scanner := bufio.NewScanner(strings.NewReader(string(content)))
+		for scanner.Scan() {
+			match := benchmarkOctaneLineRegExp.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+			if len(match) != 4 {
+				continue
+			}
+			val, err := strconv.ParseFloat(match[3], 64)
+			if err != nil {
+				return nil, err
+			}
+			tests[match[1]] = append(tests[match[1]], val)
+		}
+	}
+
+	scores := []benchmarkScore{}
+	for testName, values := range tests {
+		scores = append(scores, benchmarkScore{name: testName, unit: "score", biggerIsBetter: true, values: values})
+	}
+	return scores, nil
+}
+
+// Overall score is geometric mean of tests scores per run
+func benchmarkScoresWithGeomean(tests map[string][]float64, unit string) []benchmarkScore {
+	var scores []benchmarkScore
+	overall := benchmarkScore{name: "Score", unit: unit, biggerIsBetter: true}
+	for run := 0; ; run++ {
+		var runScores []float64
+		for _, values := range tests {
+			if run < len(values) {
+				runScores = append(runScores, values[run])
+			}
+		}
+		if len(runScores) == 0 {
+			break
+		}
+		overall.values = append(overall.values, benchmarkGeomean(runScores))
+	}
+	if len(overall.values) > 0 {
+		scores = append(scores, overall)
+	}
+
+	names := []string{}
+	for testName := range tests {
+		names = append(names, testName)
+	}
+	sort.Strings(names)
+	for _, testName := range names {
+		scores = append(scores, benchmarkScore{name: testName, unit: unit, biggerIsBetter: true, values: tests[testName]})
+	}
+	return scores
+}
+
+func benchmarkGeomean(values []float64) float64 {
+	sum := 0.0
+	for _, val := range values {
+		sum += math.Log(val)
+	}
+	return math.Exp(sum / float64(len(values)))
+}
+
+// Appends relative standard deviation of runs to browser bars like "chrome.exe (123.45 ±2.1%)"
+func benchmarkAddVariance(chartBars map[string][]chart.Value, raw map[string]map[string][]float64, precision int) map[string][]chart.Value {
+	for setName, bars := range chartBars {
+		for i, bar := range bars {
+			for browserName, values := range raw[setName] {
+				if !strings.HasPrefix(bar.Label, browserName+" (") || len(values) < 2 {
+					continue
+				}
+				mean := 0.0
+				for _, val := range values {
+					mean += val
+				}
+				mean /= float64(len(values))
+				variance := 0.0
+				for _, val := range values {
+					variance += (val - mean) * (val - mean)
+				}
+				stdev := math.Sqrt(variance / float64(len(values)-1))
+				if mean != 0 {
+					bars[i].Label = fmt.Sprintf("%s (%s ±%.1f%%)", browserName, big.NewFloat(bar.Value).Text('f', precision), stdev*100/mean)
+				}
+			}
+		}
+	}
+
+	return chartBars
+}
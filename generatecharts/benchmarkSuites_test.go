@@ -0,0 +1,241 @@
+package main
+
+import (
+	"github.com/wcharczuk/go-chart"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBenchmarkParsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		parser   benchmarkParser
+		content  string
+		expected map[string][]float64 // score name (unit) > values
+		err      bool
+	}{
+		{
+			name:   "Speedometer 3 metrics",
+			parser: benchmarkParseSpeedometer,
+			content: `{"Score": {"unit": "score", "values": [20.1, 21.3]},
+				"Total": {"unit": "ms", "values": [450.5, 430.2]},
+				"TodoMVC-React/Total": {"unit": "ms", "values": [10, 11]},
+				"Iteration-0-Total": {"unit": "ms", "values": [450.5]},
+				"Geomean": {"unit": "ms", "values": []}}`,
+			expected: map[string][]float64{
+				"Score (score)": {20.1, 21.3},
+				"Total (ms)":    {450.5, 430.2},
+			},
+		},
+		{
+			name:   "Speedometer 2 runs",
+			parser: benchmarkParseSpeedometer,
+			content: `[{"tests": {"VanillaJS-TodoMVC": {"total": 50}, "React-TodoMVC": {"total": 200}}, "total": 250},
+				{"tests": {"VanillaJS-TodoMVC": {"total": 40}, "React-TodoMVC": {"total": 160}}, "total": 200, "score": 150}]`,
+			expected: map[string][]float64{
+				"Score (runs per minute)": {60 * 1000 / 100 / benchmarkSpeedometer2CorrectionFactor, 150},
+				"Total (ms)":              {250, 200},
+				"VanillaJS-TodoMVC (ms)":  {50, 40},
+				"React-TodoMVC (ms)":      {200, 160},
+			},
+		},
+		{
+			name:    "Speedometer garbage",
+			parser:  benchmarkParseSpeedometer,
+			content: `"done"`,
+			err:     true,
+		},
+		{
+			name:   "JetStream resultsJSON",
+			parser: benchmarkParseJetStream,
+			content: `{"JetStream2.0": {"tests": {
+				"3d-cube-SP": {"metrics": {"Score": {"current": [100, 400]}, "Average": {"current": [5, 6]}}},
+				"Box2D": {"metrics": {"Score": {"current": [400, 100]}}}}}}`,
+			expected: map[string][]float64{
+				"Score (score)":      {200, 200},
+				"3d-cube-SP (score)": {100, 400},
+				"Box2D (score)":      {400, 100},
+			},
+		},
+		{
+			name:    "JetStream resultsObject",
+			parser:  benchmarkParseJetStream,
+			content: `{"3d-cube-SP": {"Score": 50, "First": 10.1, "Worst": 8.2, "Average": 9.4}, "Box2D": {"Score": 200}, "Notes": {}}`,
+			expected: map[string][]float64{
+				"Score (score)":      {100},
+				"3d-cube-SP (score)": {50},
+				"Box2D (score)":      {200},
+			},
+		},
+		{
+			name:    "JetStream garbage",
+			parser:  benchmarkParseJetStream,
+			content: `[1, 2]`,
+			err:     true,
+		},
+		{
+			name:   "MotionMark results",
+			parser: benchmarkParseMotionMark,
+			content: `{"score": 512.3, "iterationsResults": [
+				{"score": 510.1, "testsResults": {"MotionMark": {"Multiply": {"score": 623.4}, "Leaves": {"score": 401.2}}}},
+				{"score": 514.5, "testsResults": {"MotionMark": {"Multiply": {"score": 625.0}, "Leaves": {"score": 399.8}}}}]}`,
+			expected: map[string][]float64{
+				"Score (score)":    {510.1, 514.5},
+				"Multiply (score)": {623.4, 625.0},
+				"Leaves (score)":   {401.2, 399.8},
+			},
+		},
+		{
+			name:    "MotionMark nested results",
+			parser:  benchmarkParseMotionMark,
+			content: `{"version": "1.3", "results": {"iterationsResults": [{"score": 300, "testsResults": {"MotionMark": {"Suits": {"score": 280}}}}]}}`,
+			expected: map[string][]float64{
+				"Score (score)": {300},
+				"Suits (score)": {280},
+			},
+		},
+		{
+			name:     "MotionMark without iterations",
+			parser:   benchmarkParseMotionMark,
+			content:  `{"score": 512.3}`,
+			expected: map[string][]float64{},
+		},
+		{
+			name:   "Octane d8 output",
+			parser: benchmarkParseOctane,
+			content: "Richards: 28342\nDeltaBlue: 51123\n----\nScore (version 9): 32521\n" +
+				"Richards: 28000\nDeltaBlue: 50000\n----\nScore (version 9): 32000\nwarning: skipped\n",
+			expected: map[string][]float64{
+				"Richards (score)":  {28342, 28000},
+				"DeltaBlue (score)": {51123, 50000},
+				"Score (score)":     {32521, 32000},
+			},
+		},
+		{
+			name:    "Octane JSON",
+			parser:  benchmarkParseOctane,
+			content: `{"Richards": 28342, "Score": 32521}`,
+			expected: map[string][]float64{
+				"Richards (score)": {28342},
+				"Score (score)":    {32521},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		scores, err := test.parser([]byte(test.content))
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		got := map[string][]float64{}
+		for _, score := range scores {
+			got[score.name+" ("+score.unit+")"] = score.values
+			if score.biggerIsBetter != (score.unit != "ms") {
+				t.Errorf("%s: %s bigger is better %v", test.name, score.name, score.biggerIsBetter)
+			}
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.name, got, test.expected)
+			continue
+		}
+		for name, values := range test.expected {
+			if len(got[name]) != len(values) {
+				t.Errorf("%s: %s: got %v, expected %v", test.name, name, got[name], values)
+				continue
+			}
+			for i := range values {
+				if math.Abs(got[name][i]-values[i]) > 1e-9 {
+					t.Errorf("%s: %s: got %v, expected %v", test.name, name, got[name], values)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestBenchmarkGetMeasures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "benchmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "chrome_default_1_speedometer_20180120_224843.json")
+	err = ioutil.WriteFile(filePath, []byte(`{"Score": {"unit": "score", "values": [20, 22]}, "Total": {"unit": "ms", "values": [450]}}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	measures, err := benchmarkGetMeasures(filePath, benchmarkParseSpeedometer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Runs of suite are iterations of file iteration
+	expected := map[string]float64{
+		"Score (score) 1.0": 20,
+		"Score (score) 1.1": 22,
+		"Total (ms) 1":      450,
+	}
+	got := map[string]float64{}
+	for _, m := range measures {
+		got[m.measureName+" "+m.iteration] = m.value
+		if m.measureSet != "benchmarkSpeedometer" || m.browser != chromeProcessName {
+			t.Errorf("%s: got meta %v", m.measureName, m)
+		}
+	}
+	if len(got) != len(expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+	for name, value := range expected {
+		if got[name] != value {
+			t.Errorf("%s: got %v, expected %v", name, got[name], value)
+		}
+	}
+	if !excludedFromBad[getMeasureSetFullName("benchmarkSpeedometer", chromeProcessName, "Score (score)", "default")] {
+		t.Errorf("bigger score is not excluded from bad")
+	}
+
+	err = ioutil.WriteFile(filePath, []byte(`{}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = benchmarkGetMeasures(filePath, benchmarkParseSpeedometer)
+	if err == nil {
+		t.Errorf("no error for file without scores")
+	}
+}
+
+func TestBenchmarkAddVariance(t *testing.T) {
+	chartBars := map[string][]chart.Value{
+		"benchmarkOctane Score": {
+			{Label: "chrome.exe (100.00)", Value: 100},
+			{Label: "browser.exe (90.00)", Value: 90},
+		},
+	}
+	raw := map[string]map[string][]float64{
+		"benchmarkOctane Score": {
+			"chrome.exe":  {90, 110},
+			"browser.exe": {90},
+		},
+	}
+
+	bars := benchmarkAddVariance(chartBars, raw, 2)["benchmarkOctane Score"]
+	// Sample standard deviation of 90 and 110 is 14.14
+	if bars[0].Label != "chrome.exe (100.00 ±14.1%)" {
+		t.Errorf("got %s, expected chrome.exe (100.00 ±14.1%%)", bars[0].Label)
+	}
+	if bars[1].Label != "browser.exe (90.00)" {
+		t.Errorf("got %s for single run, expected browser.exe (90.00)", bars[1].Label)
+	}
+}
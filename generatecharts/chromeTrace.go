@@ -0,0 +1,319 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// chrome://tracing JSON of Chromium based browsers
+const (
+	chromeTraceMeasureSet     = "chromeTrace"
+	chromeTraceFileToken      = "_trace_"
+	chromeTraceLongTaskMs     = 50.0
+	chromeTraceTopLevel       = "toplevel"
+	chromeTraceProcessGpu     = "GPU Process"
+	chromeTraceProcessBrowser = "Browser"
+	chromeTraceProcessRender  = "Renderer"
+)
+
+// Main threads of browser, renderer and GPU processes
+var chromeTraceMainThreads = map[string]string{
+	"CrBrowserMain":  chromeTraceProcessBrowser,
+	"CrRendererMain": chromeTraceProcessRender,
+	"CrGpuMain":      "GPU",
+}
+
+// Frame events, first found name is counted
+var chromeTraceFrameEvents = []string{"DrawFrame", "Display::DrawAndSwap"}
+
+type chromeTraceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat"`
+	Ph   string                 `json:"ph"`
+	Pid  json.Number            `json:"pid"`
+	Tid  json.Number            `json:"tid"`
+	Ts   float64                `json:"ts"`  // microseconds
+	Dur  float64                `json:"dur"` // microseconds
+	Args map[string]interface{} `json:"args"`
+}
+
+type chromeTraceSpan struct {
+	start float64
+	end   float64
+}
+
+type chromeTraceThread struct {
+	pid   string
+	name  string
+	spans []chromeTraceSpan
+	open  []float64 // starts of "B" events
+}
+
+func generateChartsForChromeTraceFiles(files []os.FileInfo) error {
+	measures := []Measure{}
+
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if ext != ".json" && ext != ".gz" {
+			continue
+		}
+
+		if strings.Contains(f.Name(), chromeTraceFileToken) {
+			m, err := chromeTraceGetMeasures(filepath.Join(*csvPath, f.Name()))
+			if err != nil {
+				fmt.Printf("chromeTrace %s err %v", f.Name(), err)
+				return err
+			}
+			measures = append(measures, m...)
+		}
+	}
+
+	chartBars := getChartBarsFromRawResults(groupMeasuresBySet(measures), 2)
+
+	for measureSet, barValues := range chartBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	groupedBars := getIterationsBarsFromGroupedMeasures(groupMeasuresByIterations(measures), 2)
+	for measureSet, barValues := range groupedBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// File like chrome_yandexstaticfavicon_0_trace_20180120_224843.json or .json.gz
+func chromeTraceGetMeasures(traceFilePath string) ([]Measure, error) {
+	msrs := []Measure{}
+
+	metaMeasure, err := generalGetFileMeta(traceFilePath)
+	if err != nil {
+		return msrs, err
+	}
+	metaMeasure.measureSet = chromeTraceMeasureSet
+
+	processNames := map[string]string{}        // pid > process name
+	threads := map[string]*chromeTraceThread{} // pid:tid > thread
+	frames := map[string]float64{}             // frame event name > count
+	traceStart, traceEnd := 0.0, 0.0
+	getThread := func(e chromeTraceEvent) *chromeTraceThread {
+		key := e.Pid.String() + ":" + e.Tid.String()
+		t, found := threads[key]
+		if !found {
+			t = &chromeTraceThread{pid: e.Pid.String()}
+			threads[key] = t
+		}
+		return t
+	}
+
+	err = chromeTraceReadEvents(traceFilePath, func(e chromeTraceEvent) error {
+		if e.Ph == "M" {
+			name, _ := e.Args["name"].(string)
+			switch e.Name {
+			case "process_name":
+				processNames[e.Pid.String()] = name
+			case "thread_name":
+				getThread(e).name = name
+			}
+			return nil
+		}
+
+		if e.Ts > 0 && (traceStart == 0 || e.Ts < traceStart) {
+			traceStart = e.Ts
+		}
+		if e.Ts+e.Dur > traceEnd {
+			traceEnd = e.Ts + e.Dur
+		}
+
+		for _, frameEvent := range chromeTraceFrameEvents {
+			if e.Name == frameEvent && e.Ph != "E" {
+				frames[frameEvent]++
+			}
+		}
+
+		if !chromeTraceHasCategory(e.Cat, chromeTraceTopLevel) {
+			return nil
+		}
+		t := getThread(e)
+		switch e.Ph {
+		case "X":
+			t.spans = append(t.spans, chromeTraceSpan{start: e.Ts, end: e.Ts + e.Dur})
+		case "B":
+			t.open = append(t.open, e.Ts)
+		case "E":
+			if len(t.open) > 0 {
+				t.spans = append(t.spans, chromeTraceSpan{start: t.open[len(t.open)-1], end: e.Ts})
+				t.open = t.open[:len(t.open)-1]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return msrs, fmt.Errorf("chromeTraceGetMeasures: %s: %v", traceFilePath, err)
+	}
+
+	totals := map[string]float64{}
+	for _, t := range threads {
+		busyMs, tasks, longTasks, blockingMs := chromeTraceGetTaskStats(t.spans)
+		if tasks == 0 {
+			continue
+		}
+
+		if processNames[t.pid] == chromeTraceProcessGpu {
+			totals["GPU Process Busy Time (ms)"] += busyMs
+			totals["GPU Process Tasks"] += float64(tasks)
+		}
+
+		processType, isMainThread := chromeTraceMainThreads[t.name]
+		if !isMainThread {
+			continue
+		}
+		totals[processType+" Main Thread Busy Time (ms)"] += busyMs
+		if processType == chromeTraceProcessBrowser || processType == chromeTraceProcessRender {
+			totals["Main Thread Busy Time (ms)"] += busyMs
+			totals["Main Thread Tasks"] += float64(tasks)
+			totals["Long Tasks"] += float64(longTasks)
+			totals["Total Blocking Time (ms)"] += blockingMs
+		}
+	}
+	if totals["Main Thread Tasks"] > 0 {
+		totals["Average Main Thread Task Duration (ms)"] = totals["Main Thread Busy Time (ms)"] / totals["Main Thread Tasks"]
+	}
+
+	for _, frameEvent := range chromeTraceFrameEvents {
+		if frames[frameEvent] == 0 {
+			continue
+		}
+		totals["Frames"] = frames[frameEvent]
+		if traceEnd > traceStart {
+			totals["Frames per Second"] = frames[frameEvent] * 1000000 / (traceEnd - traceStart)
+		}
+		break
+	}
+
+	for measureName, val := range totals {
+		m := metaMeasure
+		m.measureName = measureName
+		m.value = val
+		msrs = append(msrs, m)
+	}
+
+	return msrs, nil
+}
+
+// Returns busy time, tasks count, count of tasks longer than 50ms and sum of their time above 50ms.
+// Nested top level tasks are counted as part of outer task.
+func chromeTraceGetTaskStats(spans []chromeTraceSpan) (float64, int, int, float64) {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	busyMs, blockingMs := 0.0, 0.0
+	tasks, longTasks := 0, 0
+	lastEnd := 0.0
+	for _, span := range spans {
+		if tasks > 0 && span.start < lastEnd {
+			continue
+		}
+		durationMs := (span.end - span.start) / 1000
+		busyMs += durationMs
+		tasks++
+		if durationMs > chromeTraceLongTaskMs {
+			longTasks++
+			blockingMs += durationMs - chromeTraceLongTaskMs
+		}
+		lastEnd = span.end
+	}
+
+	return busyMs, tasks, longTasks, blockingMs
+}
+
+// Categories like "disabled-by-default-devtools.timeline,toplevel"
+func chromeTraceHasCategory(categories, category string) bool {
+	for _, c := range strings.Split(categories, ",") {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Streams events of {"traceEvents": [...]} or [...] trace, traces can take hundreds of megabytes
+func chromeTraceReadEvents(traceFilePath string, f func(chromeTraceEvent) error) error {
+	file, err := os.Open(traceFilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if filepath.Ext(traceFilePath) == ".gz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	token, err := d.Token()
+	if err != nil {
+		return err
+	}
+
+	if token == json.Delim('{') {
+		for {
+			key, err := d.Token()
+			if err != nil {
+				return err
+			}
+			if key == json.Delim('}') {
+				return fmt.Errorf("traceEvents not found")
+			}
+			if key == "traceEvents" {
+				token, err = d.Token()
+				if err != nil {
+					return err
+				}
+				break
+			}
+			// Skip value of other keys like "metadata"
+			var skip json.RawMessage
+			err = d.Decode(&skip)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if token != json.Delim('[') {
+		return fmt.Errorf("expected array of trace events, got %v", token)
+	}
+
+	for d.More() {
+		var e chromeTraceEvent
+		err = d.Decode(&e)
+		if err != nil {
+			return err
+		}
+		err = f(e)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
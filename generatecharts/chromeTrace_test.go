@@ -0,0 +1,159 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Browser, renderer and GPU main threads with one top level task each, 2 DrawFrame events in 0.4s
+const chromeTraceTestEvents = `[
+{"name":"process_name","ph":"M","pid":1,"tid":1,"args":{"name":"Browser"}},
+{"name":"process_name","ph":"M","pid":2,"tid":2,"args":{"name":"Renderer"}},
+{"name":"process_name","ph":"M","pid":3,"tid":3,"args":{"name":"GPU Process"}},
+{"name":"thread_name","ph":"M","pid":1,"tid":1,"args":{"name":"CrBrowserMain"}},
+{"name":"thread_name","ph":"M","pid":2,"tid":2,"args":{"name":"CrRendererMain"}},
+{"name":"thread_name","ph":"M","pid":3,"tid":3,"args":{"name":"CrGpuMain"}},
+{"name":"ThreadControllerImpl::RunTask","cat":"toplevel","ph":"X","pid":1,"tid":1,"ts":1000000,"dur":10000,"args":{}},
+{"name":"MessageLoop::RunTask","cat":"toplevel","ph":"X","pid":1,"tid":1,"ts":1002000,"dur":1000,"args":{}},
+{"name":"DrawFrame","cat":"cc","ph":"X","pid":3,"tid":3,"ts":1010000,"dur":1000,"args":{}},
+{"name":"DrawFrame","cat":"cc","ph":"X","pid":3,"tid":3,"ts":1020000,"dur":1000,"args":{}},
+{"name":"Display::DrawAndSwap","cat":"viz","ph":"X","pid":3,"tid":3,"ts":1020000,"dur":1000,"args":{}},
+{"name":"ThreadControllerImpl::RunTask","cat":"toplevel","ph":"B","pid":2,"tid":2,"ts":1100000,"args":{}},
+{"name":"ThreadControllerImpl::RunTask","cat":"toplevel","ph":"E","pid":2,"tid":2,"ts":1180000,"args":{}},
+{"name":"ThreadControllerImpl::RunTask","cat":"disabled-by-default-devtools.timeline,toplevel","ph":"X","pid":3,"tid":3,"ts":1200000,"dur":5000,"args":{}},
+{"name":"V8.GC","cat":"v8","ph":"X","pid":1,"tid":1,"ts":1300000,"dur":100000,"args":{}}
+]`
+
+var chromeTraceTestExpected = map[string]float64{
+	"Browser Main Thread Busy Time (ms)":     10,
+	"Renderer Main Thread Busy Time (ms)":    80,
+	"GPU Main Thread Busy Time (ms)":         5,
+	"GPU Process Busy Time (ms)":             5,
+	"GPU Process Tasks":                      1,
+	"Main Thread Busy Time (ms)":             90,
+	"Main Thread Tasks":                      2,
+	"Long Tasks":                             1,
+	"Total Blocking Time (ms)":               30,
+	"Average Main Thread Task Duration (ms)": 45,
+	"Frames":                                 2,
+	"Frames per Second":                      5,
+}
+
+func TestChromeTraceGetMeasures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chromeTrace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		err      bool
+	}{
+		{
+			name:     "object with metadata",
+			fileName: "chrome_youtube_0_trace_20180120_224843.json",
+			content:  `{"metadata":{"clock-domain":"WIN_QPC","trace-config":{"included_categories":["toplevel"]}},"traceEvents":` + chromeTraceTestEvents + `}`,
+		},
+		{
+			name:     "gzipped array",
+			fileName: "chrome_youtube_0_trace_20180120_224843.json.gz",
+			content:  chromeTraceTestEvents,
+		},
+		{
+			name:     "no trace events",
+			fileName: "chrome_youtube_0_trace_20180120_224843.json",
+			content:  `{"metadata":{}}`,
+			err:      true,
+		},
+		{
+			name:     "not array",
+			fileName: "chrome_youtube_0_trace_20180120_224843.json",
+			content:  `{"traceEvents":{}}`,
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			traceFilePath := filepath.Join(dir, test.fileName)
+			f, err := os.Create(traceFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.Ext(traceFilePath) == ".gz" {
+				gz := gzip.NewWriter(f)
+				_, err = gz.Write([]byte(test.content))
+				if err == nil {
+					err = gz.Close()
+				}
+			} else {
+				_, err = f.Write([]byte(test.content))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			measures, err := chromeTraceGetMeasures(traceFilePath)
+			if test.err {
+				if err == nil {
+					t.Errorf("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]float64{}
+			for _, m := range measures {
+				got[m.measureName] = m.value
+				if m.measureSet != chromeTraceMeasureSet || m.browser != chromeProcessName || m.scenarioName != "youtube" {
+					t.Errorf("%s: got meta %v", m.measureName, m)
+				}
+			}
+			for measureName, value := range chromeTraceTestExpected {
+				if math.Abs(got[measureName]-value) > 1e-9 {
+					t.Errorf("%s: got %v, expected %v", measureName, got[measureName], value)
+				}
+			}
+			if len(got) != len(chromeTraceTestExpected) {
+				t.Errorf("got measures %v, expected %v", got, chromeTraceTestExpected)
+			}
+		})
+	}
+}
+
+func TestChromeTraceGetTaskStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		spans      []chromeTraceSpan
+		busyMs     float64
+		tasks      int
+		longTasks  int
+		blockingMs float64
+	}{
+		{"no tasks", nil, 0, 0, 0, 0},
+		{"unsorted", []chromeTraceSpan{{300000, 360000}, {0, 20000}}, 80, 2, 1, 10},
+		{"nested", []chromeTraceSpan{{0, 100000}, {10000, 90000}, {100000, 110000}}, 110, 2, 1, 50},
+		{"exactly 50ms", []chromeTraceSpan{{0, 50000}}, 50, 1, 0, 0},
+	}
+
+	for _, test := range tests {
+		busyMs, tasks, longTasks, blockingMs := chromeTraceGetTaskStats(test.spans)
+		if busyMs != test.busyMs || tasks != test.tasks || longTasks != test.longTasks || blockingMs != test.blockingMs {
+			t.Errorf("%s: got %v %v %v %v, expected %v %v %v %v", test.name,
+				busyMs, tasks, longTasks, blockingMs, test.busyMs, test.tasks, test.longTasks, test.blockingMs)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
 	"image"
 	"image/draw"
 	"image/png"
@@ -11,84 +13,404 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
-func mergePng(inputPath1, inputPath2, outPath string) error {
-	inFiles1, err := ioutil.ReadDir(inputPath1)
-	if err != nil {
-		return fmt.Errorf("failed to ReadDir %s err %s", inputPath1, err)
+const (
+	cmpCaptionHeight     = 44
+	cmpCaptionFontSize   = 10.0
+	cmpCaptionLineHeight = 16
+	cmpUnmatchedFileName = "unmatched.txt"
+)
+
+// Bars of chart are saved next to PNG file, so charts of runs can be rendered with one y-axis range
+type chartData struct {
+	MeasureSet string         `json:"measureSet"`
+	Date       time.Time      `json:"date"`
+	Bars       []chartBarData `json:"bars"`
+}
+
+// chart.Value has function fields and can't be encoded as is
+type chartBarData struct {
+	Label       string        `json:"label"`
+	Value       float64       `json:"value"`
+	Show        bool          `json:"show"`
+	FillColor   drawing.Color `json:"fillColor"`
+	StrokeColor drawing.Color `json:"strokeColor"`
+}
+
+// Directory of generatecharts output
+type cmpRun struct {
+	name     string
+	path     string
+	manifest runManifest
+	pngs     map[string]os.FileInfo
+}
+
+// Runs like "before=C:\runs\1,after=C:\runs\2", name of run is its directory name by default
+func parseCmpRuns(runs []string) []cmpRun {
+	var parsed []cmpRun
+	for _, run := range runs {
+		run = strings.Trim(run, " ")
+		if run == "" {
+			continue
+		}
+		r := cmpRun{path: run, name: filepath.Base(run)}
+		if parts := strings.SplitN(run, "=", 2); len(parts) == 2 {
+			r.name, r.path = parts[0], parts[1]
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed
+}
+
+// Writes PNG file per chart with charts of runs in grid of columns, every chart has caption with
+// run name, date and browser versions. Charts with saved bars are rendered again with one y-axis range,
+// or as one chart with bars of runs grouped by browser if combined is set.
+// Charts missing in some runs are listed in unmatched.txt.
+func mergePng(runs []cmpRun, outPath string, columns int, combined bool) error {
+	if len(runs) < 2 {
+		return fmt.Errorf("at least 2 runs are required, got %d", len(runs))
 	}
-	inFiles2, err := ioutil.ReadDir(inputPath2)
+	if columns < 1 {
+		columns = 1
+	}
+	err := os.MkdirAll(outPath, 0755)
 	if err != nil {
-		return fmt.Errorf("failed to ReadDir %s err %s", inputPath2, err)
+		return fmt.Errorf("failed to Mkdir %s err %s", outPath, err)
 	}
-	if _, err := os.Stat(outPath); os.IsNotExist(err) {
-		err = os.Mkdir(outPath, 0666)
+
+	charts := map[string]bool{}
+	for i := range runs {
+		files, err := ioutil.ReadDir(runs[i].path)
 		if err != nil {
-			return fmt.Errorf("failed to Mkdir %s err %s", outPath, err)
+			return fmt.Errorf("failed to ReadDir %s err %s", runs[i].path, err)
+		}
+		runs[i].pngs = map[string]os.FileInfo{}
+		for _, f := range files {
+			if filepath.Ext(f.Name()) == ".png" {
+				runs[i].pngs[f.Name()] = f
+				charts[f.Name()] = true
+			}
+		}
+		runs[i].manifest, err = loadRunManifestFromDir(runs[i].path)
+		if err != nil {
+			return err
 		}
 	}
 
-	for _, inF1 := range inFiles1 {
-		if filepath.Ext(inF1.Name()) != ".png" {
+	var unmatched []string
+	for _, chartName := range scenarioSortedKeys(charts) {
+		var missing []string
+		for _, run := range runs {
+			if _, found := run.pngs[chartName]; !found {
+				missing = append(missing, run.name)
+			}
+		}
+		if len(missing) > 0 {
+			unmatched = append(unmatched, fmt.Sprintf("%s: missing in %s", chartName, strings.Join(missing, ", ")))
+		}
+		if len(runs)-len(missing) < 2 {
 			continue
 		}
-		for _, inF2 := range inFiles2 {
-			//fmt.Println(f.Name(), filepath.Ext(f.Name()))
-			if inF1.Name() != inF2.Name() {
-				continue
-			}
 
-			imgFile1, err := os.Open(filepath.Join(inputPath1, inF1.Name()))
-			if err != nil {
-				return err
-			}
-			imgFile2, err := os.Open(filepath.Join(inputPath2, inF2.Name()))
-			if err != nil {
-				return err
-			}
+		err = mergeChartOfRuns(runs, chartName, outPath, columns, combined)
+		if err != nil {
+			return fmt.Errorf("%s: %s", chartName, err)
+		}
+	}
 
-			img1, _, err := image.Decode(imgFile1)
-			if err != nil {
-				return err
+	if len(unmatched) > 0 {
+		fmt.Printf("Charts missing in some runs:\n%s\n", strings.Join(unmatched, "\n"))
+	}
+	return ioutil.WriteFile(filepath.Join(outPath, cmpUnmatchedFileName), []byte(strings.Join(unmatched, "\n")), 0644)
+}
+
+func mergeChartOfRuns(runs []cmpRun, chartName, outPath string, columns int, combined bool) error {
+	// Bars are rendered again only if all runs have them, otherwise images are not comparable anyway
+	chartDatas := map[string]chartData{}
+	max := 0.0
+	for _, run := range runs {
+		if _, found := run.pngs[chartName]; !found {
+			continue
+		}
+		data, err := loadChartData(filepath.Join(run.path, strings.TrimSuffix(chartName, ".png")+".json"))
+		if err != nil {
+			chartDatas = nil
+			break
+		}
+		chartDatas[run.name] = data
+		for _, bar := range data.Bars {
+			if bar.Value > max {
+				max = bar.Value
 			}
-			img2, _, err := image.Decode(imgFile2)
+		}
+	}
+
+	if combined && chartDatas != nil {
+		drawn, err := drawCombinedChart(runs, chartName, chartDatas, outPath)
+		if err != nil || drawn {
+			return err
+		}
+	}
+
+	var panels []image.Image
+	var captions [][]string
+	cellSize := image.Point{}
+	for _, run := range runs {
+		info, found := run.pngs[chartName]
+		if !found {
+			panels = append(panels, nil)
+			captions = append(captions, []string{run.name + ": missing"})
+			continue
+		}
+
+		var img image.Image
+		var err error
+		date := info.ModTime()
+		if data, found := chartDatas[run.name]; found {
+			date = data.Date
+			img, err = drawChartData(data, max)
+		} else {
+			img, err = readPng(filepath.Join(run.path, chartName))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", run.name, err)
+		}
+		panels = append(panels, img)
+		captions = append(captions, []string{
+			fmt.Sprintf("%s %s", run.name, date.Format("2006-01-02 15:04:05")),
+			run.manifest.browserVersions(),
+		})
+
+		if img.Bounds().Dx() > cellSize.X {
+			cellSize.X = img.Bounds().Dx()
+		}
+		if img.Bounds().Dy() > cellSize.Y {
+			cellSize.Y = img.Bounds().Dy()
+		}
+	}
+	cellSize.Y += cmpCaptionHeight
+
+	if columns > len(runs) {
+		columns = len(runs)
+	}
+	rows := (len(runs) + columns - 1) / columns
+	rgba := image.NewRGBA(image.Rect(0, 0, cellSize.X*columns, cellSize.Y*rows))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+
+	gc, err := drawing.NewRasterGraphicContext(rgba)
+	if err != nil {
+		return err
+	}
+	font, err := chart.GetDefaultFont()
+	if err != nil {
+		return err
+	}
+	gc.SetFont(font)
+	gc.SetFontSize(cmpCaptionFontSize)
+	gc.SetFillColor(drawing.ColorBlack)
+
+	for i, panel := range panels {
+		cell := image.Point{X: i % columns * cellSize.X, Y: i / columns * cellSize.Y}
+		for line, caption := range captions[i] {
+			_, err = gc.FillStringAt(caption, float64(cell.X+10), float64(cell.Y+(line+1)*cmpCaptionLineHeight))
 			if err != nil {
 				return err
 			}
+		}
+		if panel == nil {
+			continue
+		}
+		origin := cell.Add(image.Point{Y: cmpCaptionHeight})
+		draw.Draw(rgba, panel.Bounds().Sub(panel.Bounds().Min).Add(origin), panel, panel.Bounds().Min, draw.Src)
+	}
 
-			// starting position of the second image (bottom left)
-			sp2 := image.Point{img1.Bounds().Dx(), 0}
+	out, err := os.Create(filepath.Join(outPath, chartName))
+	if err != nil {
+		return err
+	}
+	err = png.Encode(out, rgba)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return ioClose(chartName, out)
+}
 
-			// new rectangle for the second image
-			r2 := image.Rectangle{sp2, sp2.Add(img2.Bounds().Size())}
+func readPng(pngFilePath string) (image.Image, error) {
+	imgFile, err := os.Open(pngFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer imgFile.Close()
 
-			// rectangle for the big image
-			r := image.Rectangle{image.Point{0, 0}, r2.Max}
+	img, _, err := image.Decode(imgFile)
+	return img, err
+}
 
-			// create new image
-			rgba := image.NewRGBA(r)
+func drawChartData(data chartData, max float64) (image.Image, error) {
+	var bars []chart.Value
+	for _, bar := range data.Bars {
+		bars = append(bars, chart.Value{
+			Label: bar.Label,
+			Value: bar.Value,
+			Style: chart.Style{
+				Show:        bar.Show,
+				FillColor:   bar.FillColor,
+				StrokeColor: bar.StrokeColor,
+			},
+		})
+	}
 
-			// draw the two images into this new image
-			draw.Draw(rgba, img1.Bounds(), img1, image.Point{0, 0}, draw.Src)
-			draw.Draw(rgba, r2, img2, image.Point{0, 0}, draw.Src)
+	buf := &bytes.Buffer{}
+	title := theme.label("title", map[string]string{
+		"MeasureSet": data.MeasureSet,
+		"Date":       data.Date.Format("2006-01-02 15:04:05"),
+	})
+	err := renderBarChart(buf, data.MeasureSet, title, bars, defaultAxisPolicy(data.MeasureSet), max)
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(buf)
+}
 
-			// save result
-			out, err := os.Create(filepath.Join(outPath, inF2.Name()))
-			if err != nil {
-				return err
+// Bars of browser are grouped and colored with shades of browser color from dark for the first run
+// to light for the last one. Bar of Yandex Browser is annotated with diff vs the first run,
+// bars of competitors with diff of Yandex Browser vs competitor in the same run.
+// Returns false if bars are not bars of browsers like bars of iterations.
+func drawCombinedChart(runs []cmpRun, chartName string, chartDatas map[string]chartData, outPath string) (bool, error) {
+	// browser > run > value
+	values := map[string]map[string]float64{}
+	var runNames []string
+	max := 0.0
+	for _, run := range runs {
+		data, found := chartDatas[run.name]
+		if !found {
+			continue
+		}
+		runNames = append(runNames, run.name)
+		for _, bar := range data.Bars {
+			browser := chartBarBrowser(bar.Label)
+			if browser == "" {
+				continue
+			}
+			if values[browser] == nil {
+				values[browser] = map[string]float64{}
+			}
+			values[browser][run.name] = bar.Value
+			if bar.Value > max {
+				max = bar.Value
 			}
+		}
+	}
+	if len(values) == 0 {
+		return false, nil
+	}
 
-			err = png.Encode(out, rgba)
-			if err != nil {
-				return err
+	var groups [][]chart.Value
+	for _, browser := range scenarioSortedKeys(chartBarBrowsers(values)) {
+		var group []chart.Value
+		baseRun := ""
+		for i, runName := range runNames {
+			val, found := values[browser][runName]
+			if !found {
+				continue
 			}
+
+			label := fmt.Sprintf("%s: %s (%.2f)", runName, browser, val)
+			if browser == yaBrowserProcessName {
+				if baseRun == "" {
+					baseRun = runName
+				} else if base := values[browser][baseRun]; base != 0 {
+					label += fmt.Sprintf(" %+.0f%% vs %s", (val-base)*100/base, baseRun)
+				}
+			} else if yaBrowser, found := values[yaBrowserProcessName][runName]; found && val != 0 {
+				label += fmt.Sprintf(" %s %+.0f%%", yaBrowserProcessName, (yaBrowser-val)*100/val)
+			}
+
+			color := chartBarShade(processNameChartColor[browser], i, len(runNames))
+			group = append(group, chart.Value{
+				Label: label,
+				Value: val,
+				Style: chart.Style{
+					Show:        true,
+					FillColor:   color,
+					StrokeColor: color,
+				},
+			})
 		}
+		groups = append(groups, group)
 	}
-	return nil
+
+	out, err := os.Create(filepath.Join(outPath, chartName))
+	if err != nil {
+		return true, err
+	}
+	title := fmt.Sprintf("%s %s", strings.TrimSuffix(chartName, ".png"), strings.Join(runNames, " vs "))
+	err = drawBarGrouped(out, strings.TrimSuffix(chartName, ".png"), title, groups, max)
+	if err != nil {
+		out.Close()
+		return true, err
+	}
+	return true, ioClose(chartName, out)
+}
+
+// "chrome.exe (10.50)" > chrome.exe, empty for diff bars and bars of iterations
+func chartBarBrowser(label string) string {
+	browser := strings.SplitN(label, " (", 2)[0]
+	if processNames[browser] {
+		return browser
+	}
+	return ""
+}
+
+func chartBarBrowsers(values map[string]map[string]float64) map[string]bool {
+	browsers := map[string]bool{}
+	for browser := range values {
+		browsers[browser] = true
+	}
+	return browsers
+}
+
+// Mixes color with white up to 60% for the last of runs
+func chartBarShade(c drawing.Color, run, runs int) drawing.Color {
+	if runs < 2 {
+		return c
+	}
+	white := 0.6 * float64(run) / float64(runs-1)
+	mix := func(v uint8) uint8 {
+		return uint8(float64(v) + (255-float64(v))*white)
+	}
+	return drawing.Color{R: mix(c.R), G: mix(c.G), B: mix(c.B), A: 255}
+}
+
+// "yabro 18.7.0.85, chrome 65.0.3325.181"
+func (m runManifest) browserVersions() string {
+	var versions []string
+	for browser, b := range m.Browsers {
+		if b.Version != "" {
+			versions = append(versions, browser+" "+b.Version)
+		}
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ", ")
 }
 
 func serializeChartBars(measureSet string, chartBars []chart.Value) error {
+	data := chartData{MeasureSet: measureSet, Date: chartDate}
+	for _, bar := range chartBars {
+		data.Bars = append(data.Bars, chartBarData{
+			Label:       bar.Label,
+			Value:       bar.Value,
+			Show:        bar.Style.Show,
+			FillColor:   bar.Style.FillColor,
+			StrokeColor: bar.Style.StrokeColor,
+		})
+	}
+
 	jsonFilePath := filepath.Join(*pngPath, measureSet+".json")
 	jsonFile, err := os.Create(jsonFilePath)
 	if err != nil {
@@ -96,13 +418,27 @@ func serializeChartBars(measureSet string, chartBars []chart.Value) error {
 		return fmt.Errorf("Create JSON file %s err %v\n", jsonFilePath, err)
 	}
 
-	err = json.NewEncoder(jsonFile).Encode(chartBars)
+	err = json.NewEncoder(jsonFile).Encode(data)
 	if err != nil {
+		jsonFile.Close()
 		return fmt.Errorf("Failed to encode JSON to file %s err %v\n", jsonFilePath, err)
 	}
 	return ioClose(jsonFilePath, jsonFile)
 }
 
+func loadChartData(jsonFilePath string) (chartData, error) {
+	data := chartData{}
+	content, err := ioutil.ReadFile(jsonFilePath)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return data, fmt.Errorf("failed to decode %s: %s", jsonFilePath, err)
+	}
+	return data, nil
+}
+
 func ioClose(description string, c io.Closer) error {
 	if err := c.Close(); err != nil {
 		fmt.Printf("Failed to close %s: %v\n", description, err)
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Data quality issues of run are collected while files are parsed and measures are grouped,
+// the report lists them and -strict fails the run if there are any
+const (
+	dataQualityReport = "dataQuality"
+
+	dataQualityMissingIterations = "missing iterations"
+	dataQualityUnbalanced        = "unbalanced iterations"
+	dataQualityMissingBrowser    = "missing browser"
+	dataQualityUnparseable       = "unparseable row"
+	dataQualityZeroValue         = "zero value"
+	dataQualityNegativeValue     = "negative value"
+	dataQualityTimestamp         = "out of range timestamp"
+	dataQualityUnmatchedMetric   = "unmatched score metric"
+	dataQualityEnergyMismatch    = "energy mismatch"
+)
+
+type dataQualityIssue struct {
+	Kind      string `json:"kind"`
+	Source    string `json:"source"`
+	Browser   string `json:"browser"`
+	Scenario  string `json:"scenario"`
+	Iteration string `json:"iteration"`
+	Details   string `json:"details"`
+}
+
+type dataQualityIssueSort []dataQualityIssue
+
+func (s dataQualityIssueSort) Len() int {
+	return len(s)
+}
+func (s dataQualityIssueSort) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s dataQualityIssueSort) Less(i, j int) bool {
+	if s[i].Kind != s[j].Kind {
+		return s[i].Kind < s[j].Kind
+	}
+	if s[i].Source != s[j].Source {
+		return s[i].Source < s[j].Source
+	}
+	if s[i].Scenario != s[j].Scenario {
+		return s[i].Scenario < s[j].Scenario
+	}
+	if s[i].Browser != s[j].Browser {
+		return s[i].Browser < s[j].Browser
+	}
+	return s[i].Iteration < s[j].Iteration
+}
+
+// Energy and power of running browser are never zero, zero means counter was not collected.
+// Counts and percents like "Long Tasks" or "Package Hot_0 %" are zero normally.
+var dataQualityZeroIsMissingRegExp = regexp.MustCompile(`(?i)(energy|power)[^(]*\((milli joules|joules|mj|j|mwh|watt|mw|w)\)`)
+
+var (
+	dataQualityIssues []dataQualityIssue
+	// measure set > scenario > browser > iterations
+	dataQualityIterations = map[string]map[string]map[string]map[string]bool{}
+	// Zero and negative values are reported once per chart, browser and iteration
+	dataQualityValueIssues = map[string]bool{}
+	dataQualityManifest    *runManifest
+)
+
+// Source is file name or measure set, measure gives browser, scenario and iteration if known
+func dataQualityAdd(kind, source string, m Measure, format string, args ...interface{}) {
+	issue := dataQualityIssue{
+		Kind:      kind,
+		Source:    filepath.Base(source),
+		Browser:   m.browser,
+		Scenario:  m.scenarioName,
+		Iteration: m.iteration,
+		Details:   fmt.Sprintf(format, args...),
+	}
+	fmt.Printf("Data quality: %s: %s %s %s %s: %s\n", issue.Kind, issue.Source, issue.Browser, issue.Scenario, issue.Iteration, issue.Details)
+	dataQualityIssues = append(dataQualityIssues, issue)
+}
+
+// Called for every measure of charts
+func dataQualityAddMeasure(fullSetName string, m Measure) {
+	if dataQualityIterations[m.measureSet] == nil {
+		dataQualityIterations[m.measureSet] = map[string]map[string]map[string]bool{}
+	}
+	scenarios := dataQualityIterations[m.measureSet]
+	if scenarios[m.scenarioName] == nil {
+		scenarios[m.scenarioName] = map[string]map[string]bool{}
+	}
+	if scenarios[m.scenarioName][m.browser] == nil {
+		scenarios[m.scenarioName][m.browser] = map[string]bool{}
+	}
+	scenarios[m.scenarioName][m.browser][m.iteration] = true
+
+	key := strings.Join([]string{fullSetName, m.browser, m.iteration}, "|")
+	zeroIsMissing := m.value == 0 && dataQualityZeroIsMissingRegExp.MatchString(m.measureName)
+	if (m.value < 0 || zeroIsMissing) && !dataQualityValueIssues[key] {
+		dataQualityValueIssues[key] = true
+		kind := dataQualityZeroValue
+		if m.value < 0 {
+			kind = dataQualityNegativeValue
+		}
+		dataQualityAdd(kind, m.measureSet, m, "%s = %v", fullSetName, m.value)
+	}
+
+	dataQualityCheckDate(m)
+}
+
+// Date of file must be in the past and in run window of manifest if there is one
+func dataQualityCheckDate(m Measure) {
+	if m.date.IsZero() {
+		return
+	}
+	if m.date.After(time.Now()) {
+		dataQualityAdd(dataQualityTimestamp, m.measureSet, m, "date %s is in the future", m.date.Format(time.RFC3339))
+		return
+	}
+
+	for _, run := range dataQualityGetManifest().Runs {
+		if run.Browser != m.browserShortName || run.Scenario != m.scenarioName || run.Iteration != m.iteration {
+			continue
+		}
+		// Dates of file names have no time zone, seconds are truncated
+		date := time.Date(m.date.Year(), m.date.Month(), m.date.Day(), m.date.Hour(), m.date.Minute(), m.date.Second(), 0, run.Start.Location())
+		if date.Before(run.Start.Truncate(time.Second)) || (!run.End.IsZero() && date.After(run.End)) {
+			dataQualityAdd(dataQualityTimestamp, m.measureSet, m, "date %s is out of run %s - %s", m.date.Format("2006-01-02 15:04:05"), run.Start.Format(time.RFC3339), run.End.Format(time.RFC3339))
+		}
+		return
+	}
+}
+
+func dataQualityGetManifest() *runManifest {
+	if dataQualityManifest == nil {
+		manifest, err := loadRunManifest()
+		if err != nil {
+			fmt.Printf("Data quality: %s\n", err)
+		}
+		dataQualityManifest = &manifest
+	}
+	return dataQualityManifest
+}
+
+// Returns browser process names of run manifest by scenario, browsers without runs are expected in all scenarios ("")
+func dataQualityManifestBrowsers() map[string]map[string]bool {
+	manifestBrowsers := map[string]map[string]bool{}
+	manifest := dataQualityGetManifest()
+	for _, run := range manifest.Runs {
+		if manifestBrowsers[run.Scenario] == nil {
+			manifestBrowsers[run.Scenario] = map[string]bool{}
+		}
+		manifestBrowsers[run.Scenario][browserNameToProcessName[run.Browser]] = true
+	}
+	if len(manifest.Runs) == 0 {
+		for browserShortName := range manifest.Browsers {
+			if manifestBrowsers[""] == nil {
+				manifestBrowsers[""] = map[string]bool{}
+			}
+			manifestBrowsers[""][browserNameToProcessName[browserShortName]] = true
+		}
+	}
+	return manifestBrowsers
+}
+
+// Compares iterations of browsers in every measure set and scenario
+func dataQualityCheckIterations() {
+	manifestBrowsers := dataQualityManifestBrowsers()
+	for _, measureSet := range dataQualitySortedKeys(dataQualityIterations) {
+		scenarios := dataQualityIterations[measureSet]
+
+		// Browsers of measure set in any scenario are expected in all scenarios
+		browsers := map[string]bool{}
+		for _, scenarioBrowsers := range scenarios {
+			for browser := range scenarioBrowsers {
+				browsers[browser] = true
+			}
+		}
+
+		for _, scenario := range dataQualitySortedKeys(scenarios) {
+			scenarioBrowsers := scenarios[scenario]
+			// Browser failed for whole run has no measures in any scenario, it is found in run manifest
+			expectedBrowsers := map[string]bool{}
+			for _, manifestScenario := range []string{"", scenario} {
+				for browser := range manifestBrowsers[manifestScenario] {
+					if browser != "" && !browsers[browser] {
+						expectedBrowsers[browser] = true
+					}
+				}
+			}
+			for _, browser := range scenarioSortedKeys(expectedBrowsers) {
+				dataQualityAdd(dataQualityMissingBrowser, measureSet, Measure{browser: browser, scenarioName: scenario}, "no measures in any scenario, browser is in run manifest")
+			}
+
+			iterations := map[string]bool{}
+			counts := map[int]bool{}
+			for _, browserIterations := range scenarioBrowsers {
+				counts[len(browserIterations)] = true
+				for iteration := range browserIterations {
+					iterations[iteration] = true
+				}
+			}
+
+			for _, browser := range scenarioSortedKeys(browsers) {
+				m := Measure{browser: browser, scenarioName: scenario}
+				browserIterations, found := scenarioBrowsers[browser]
+				if !found {
+					dataQualityAdd(dataQualityMissingBrowser, measureSet, m, "no measures, other scenarios have them")
+					continue
+				}
+				var missing []string
+				for iteration := range iterations {
+					if !browserIterations[iteration] {
+						missing = append(missing, iteration)
+					}
+				}
+				if len(missing) > 0 {
+					sort.Strings(missing)
+					dataQualityAdd(dataQualityMissingIterations, measureSet, m, "iterations %s are measured for other browsers", strings.Join(missing, ", "))
+				}
+			}
+
+			if len(counts) > 1 {
+				var perBrowser []string
+				for _, browser := range scenarioSortedKeys(dataQualityBrowsers(scenarioBrowsers)) {
+					perBrowser = append(perBrowser, fmt.Sprintf("%s: %d", browser, len(scenarioBrowsers[browser])))
+				}
+				dataQualityAdd(dataQualityUnbalanced, measureSet, Measure{scenarioName: scenario}, "%s", strings.Join(perBrowser, ", "))
+			}
+		}
+	}
+}
+
+// Writes dataQuality.json and dataQuality.html, returns error in -strict mode if there are issues
+func generateDataQualityReport() error {
+	dataQualityCheckIterations()
+	sort.Sort(dataQualityIssueSort(dataQualityIssues))
+
+	reportJsonFileName := dataQualityReport + ".json"
+	reportJsonFile, err := os.Create(filepath.Join(*pngPath, reportJsonFileName))
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(reportJsonFile).Encode(dataQualityIssues)
+	if err != nil {
+		reportJsonFile.Close()
+		return fmt.Errorf("failed to json encode %s: %s", reportJsonFileName, err)
+	}
+	err = ioClose(reportJsonFileName, reportJsonFile)
+	if err != nil {
+		return err
+	}
+
+	err = scenarioReportWriteHtml(dataQualityReport+".html", dataQualityReportTpl, dataQualityIssues)
+	if err != nil {
+		return err
+	}
+
+	if *strict && len(dataQualityIssues) > 0 {
+		return fmt.Errorf("%d data quality issues, see %s", len(dataQualityIssues), reportJsonFileName)
+	}
+	return nil
+}
+
+func dataQualitySortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]map[string]map[string]map[string]bool:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]map[string]map[string]bool:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func dataQualityBrowsers(browsers map[string]map[string]bool) map[string]bool {
+	set := map[string]bool{}
+	for browser := range browsers {
+		set[browser] = true
+	}
+	return set
+}
+
+const dataQualityReportTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8">
+		<title>Data Quality</title>
+		<style>
+			table { border-collapse: collapse; }
+			td, th { border: 1px solid #ccc; padding: 2px 6px; }
+		</style>
+	</head>
+	<body>
+		<table>
+			<tr>
+				<th>Issue</th><th>Source</th><th>Browser</th><th>Scenario</th><th>Iteration</th><th>Details</th>
+			</tr>
+		{{range $issue := . }}
+			<tr>
+				<td>{{ $issue.Kind }}</td>
+				<td>{{ $issue.Source }}</td>
+				<td>{{ $issue.Browser }}</td>
+				<td>{{ $issue.Scenario }}</td>
+				<td>{{ $issue.Iteration }}</td>
+				<td>{{ $issue.Details }}</td>
+			</tr>
+		{{else}}
+			<tr><td colspan="6"><strong>no issues</strong></td></tr>
+		{{end}}
+		</table>
+	</body>
+</html>`
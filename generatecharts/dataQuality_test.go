@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDataQualityAddMeasure(t *testing.T) {
+	oldIssues := dataQualityIssues
+	oldValueIssues := dataQualityValueIssues
+	oldIterations := dataQualityIterations
+	defer func() {
+		dataQualityIssues = oldIssues
+		dataQualityValueIssues = oldValueIssues
+		dataQualityIterations = oldIterations
+	}()
+	dataQualityValueIssues = map[string]bool{}
+	dataQualityIterations = map[string]map[string]map[string]map[string]bool{}
+
+	tests := []struct {
+		measureSet  string
+		measureName string
+		value       float64
+		kind        string
+	}{
+		{"rapl", "package-0 Energy (Joules)", 0, dataQualityZeroValue},
+		{"rapl", "package-0 Average Power (Watt)", 0, dataQualityZeroValue},
+		{"intelPowerLog", "Cumulative GT Energy_0 (Joules)", 0, dataQualityZeroValue},
+		{"energy", "Energy (mWh)", 0, dataQualityZeroValue},
+		{"intelPowerLog", "Package Hot_0 %", 0, ""},
+		{"chromeTrace", "Long Tasks", 0, ""},
+		{"procfs", "Involuntary Context Switches", 0, ""},
+		{"procfs", "Write Bytes", 0, ""},
+		{"cpuUsage", "CPU chrome.exe Utilization %", 0, ""},
+		{"rapl", "package-0 core Energy (Joules)", 12.5, ""},
+		{"chromeTrace", "Long Tasks", -1, dataQualityNegativeValue},
+	}
+
+	for _, test := range tests {
+		m := Measure{measureSet: test.measureSet, measureName: test.measureName, value: test.value, browser: chromeProcessName, scenarioName: "youtube", iteration: "0"}
+		issues := len(dataQualityIssues)
+		dataQualityAddMeasure(getMeasureSetFullName(m.measureSet, m.browser, m.measureName, m.scenarioName), m)
+
+		kind := ""
+		if len(dataQualityIssues) > issues {
+			kind = dataQualityIssues[len(dataQualityIssues)-1].Kind
+		}
+		if kind != test.kind {
+			t.Errorf("%s = %v: got issue '%s', expected '%s'", test.measureName, test.value, kind, test.kind)
+		}
+	}
+}
+
+func TestDataQualityCheckIterations(t *testing.T) {
+	oldIssues, oldIterations, oldManifest := dataQualityIssues, dataQualityIterations, dataQualityManifest
+	defer func() {
+		dataQualityIssues, dataQualityIterations, dataQualityManifest = oldIssues, oldIterations, oldManifest
+	}()
+
+	tests := []struct {
+		name     string
+		manifest runManifest
+		expected []string // browser scenario of missing browser issues
+	}{
+		{
+			name:     "without manifest",
+			expected: []string{"chrome.exe idle"},
+		},
+		{
+			name: "runs of browser failed for whole run",
+			manifest: runManifest{Runs: []runManifestRun{
+				{Browser: yaBrowserShortName, Scenario: "youtube", Iteration: "0"},
+				{Browser: chromeShortName, Scenario: "youtube", Iteration: "0"},
+				{Browser: operaShortName, Scenario: "youtube", Iteration: "0"},
+			}},
+			expected: []string{"chrome.exe idle", "opera.exe youtube"},
+		},
+		{
+			name:     "browsers of manifest without runs",
+			manifest: runManifest{Browsers: map[string]runManifestBrowser{operaShortName: {Version: "52.0"}}},
+			expected: []string{"opera.exe idle", "chrome.exe idle", "opera.exe youtube"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataQualityIssues = nil
+			manifest := test.manifest
+			dataQualityManifest = &manifest
+			dataQualityIterations = map[string]map[string]map[string]map[string]bool{
+				"cpuUsage": {
+					"youtube": {yaBrowserProcessName: {"0": true}, chromeProcessName: {"0": true}},
+					"idle":    {yaBrowserProcessName: {"0": true}},
+				},
+			}
+
+			dataQualityCheckIterations()
+
+			var got []string
+			for _, issue := range dataQualityIssues {
+				if issue.Kind == dataQualityMissingBrowser {
+					got = append(got, issue.Browser+" "+issue.Scenario)
+				}
+			}
+			if strings.Join(got, ", ") != strings.Join(test.expected, ", ") {
+				t.Errorf("got %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
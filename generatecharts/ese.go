@@ -0,0 +1,576 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+	"unicode/utf16"
+)
+
+// Minimal read-only reader of ESE (JET Blue) database files like SRUDB.dat.
+// Supports tables B-trees, catalog, fixed, variable and inline tagged columns.
+// Long values and XPRESS compressed values are not supported, they are counted as skipped values.
+
+const (
+	eseSignature           = 0x89abcdef
+	eseCatalogPage         = 4
+	eseLargePageSize       = 16384
+	eseRevisionLargeHeader = 0x11
+
+	esePageFlagLeaf   = 0x0002
+	esePageFlagParent = 0x0004
+	esePageFlagEmpty  = 0x0008
+	esePageFlagSpace  = 0x0020
+	esePageFlagLong   = 0x0080
+
+	eseTagFlagDefunct   = 0x2
+	eseTagFlagCommonKey = 0x4
+
+	eseCatalogTypeTable  = 1
+	eseCatalogTypeColumn = 2
+
+	eseTaggedFlagCompressed = 0x02
+	eseTaggedFlagLongValue  = 0x04
+)
+
+// Column types
+const (
+	eseColumnTypeBit           = 1
+	eseColumnTypeUnsignedByte  = 2
+	eseColumnTypeShort         = 3
+	eseColumnTypeLong          = 4
+	eseColumnTypeCurrency      = 5
+	eseColumnTypeIEEESingle    = 6
+	eseColumnTypeIEEEDouble    = 7
+	eseColumnTypeDateTime      = 8
+	eseColumnTypeBinary        = 9
+	eseColumnTypeText          = 10
+	eseColumnTypeLongBinary    = 11
+	eseColumnTypeLongText      = 12
+	eseColumnTypeUnsignedLong  = 14
+	eseColumnTypeLongLong      = 15
+	eseColumnTypeGUID          = 16
+	eseColumnTypeUnsignedShort = 17
+)
+
+type eseDatabase struct {
+	file     *os.File
+	pageSize uint32
+	revision uint32
+	tables   map[string]*eseTable
+	// "table column: reason" > count of tagged values which are not read
+	skipped map[string]int
+}
+
+type eseTable struct {
+	name    string
+	objId   uint32
+	fdpPage uint32
+	columns map[uint32]eseColumn // column id > column
+}
+
+type eseColumn struct {
+	id      uint32
+	name    string
+	colType uint32
+	size    uint32
+}
+
+// Column id > raw column value, null columns are absent
+type eseRecord map[uint32][]byte
+
+type esePage struct {
+	number uint32
+	data   []byte
+	flags  uint32
+	values []esePageValue
+}
+
+type esePageValue struct {
+	flags uint16
+	data  []byte
+}
+
+func eseOpen(dbFilePath string) (*eseDatabase, error) {
+	f, err := os.Open(dbFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 240)
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: failed to read header: %s", dbFilePath, err)
+	}
+	if binary.LittleEndian.Uint32(header[4:8]) != eseSignature {
+		f.Close()
+		return nil, fmt.Errorf("%s is not ESE database", dbFilePath)
+	}
+
+	db := &eseDatabase{
+		file:     f,
+		revision: binary.LittleEndian.Uint32(header[232:236]),
+		pageSize: binary.LittleEndian.Uint32(header[236:240]),
+		tables:   map[string]*eseTable{},
+		skipped:  map[string]int{},
+	}
+	if db.pageSize == 0 {
+		db.pageSize = 4096
+	}
+
+	err = db.loadCatalog()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: failed to load catalog: %s", dbFilePath, err)
+	}
+
+	return db, nil
+}
+
+func (db *eseDatabase) Close() error {
+	return db.file.Close()
+}
+
+func (db *eseDatabase) isLargePage() bool {
+	return db.pageSize >= eseLargePageSize
+}
+
+// Database pages follow two header pages, page numbers start from 1
+func (db *eseDatabase) readPage(number uint32) (*esePage, error) {
+	data := make([]byte, db.pageSize)
+	_, err := db.file.ReadAt(data, int64(number+1)*int64(db.pageSize))
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %s", number, err)
+	}
+
+	headerSize := uint32(40)
+	if db.isLargePage() && db.revision >= eseRevisionLargeHeader {
+		headerSize = 80
+	}
+
+	p := &esePage{
+		number: number,
+		data:   data,
+		flags:  binary.LittleEndian.Uint32(data[36:40]),
+	}
+
+	tagsCount := uint32(binary.LittleEndian.Uint16(data[34:36]))
+	offsetMask := uint16(0x1fff)
+	if db.isLargePage() {
+		offsetMask = 0x7fff
+	}
+	for i := uint32(0); i < tagsCount; i++ {
+		tagPos := db.pageSize - 4*(i+1)
+		if tagPos < headerSize {
+			return nil, fmt.Errorf("page %d: too many tags %d", number, tagsCount)
+		}
+		sizeField := binary.LittleEndian.Uint16(data[tagPos : tagPos+2])
+		offsetField := binary.LittleEndian.Uint16(data[tagPos+2 : tagPos+4])
+		size := uint32(sizeField & offsetMask)
+		start := headerSize + uint32(offsetField&offsetMask)
+		if start+size > db.pageSize {
+			return nil, fmt.Errorf("page %d: tag %d out of page bounds", number, i)
+		}
+
+		value := esePageValue{
+			flags: offsetField >> 13,
+			data:  data[start : start+size],
+		}
+		// Large pages keep tag flags in upper bits of first value word
+		if db.isLargePage() && size >= 2 {
+			firstWord := binary.LittleEndian.Uint16(value.data[0:2])
+			value.flags = firstWord >> 13
+			value.data = append([]byte{}, value.data...)
+			binary.LittleEndian.PutUint16(value.data[0:2], firstWord&0x1fff)
+		}
+		p.values = append(p.values, value)
+	}
+
+	return p, nil
+}
+
+// Returns data part of B-tree entry after common and local keys
+func eseEntryData(value esePageValue) ([]byte, error) {
+	pos := 0
+	if value.flags&eseTagFlagCommonKey != 0 {
+		pos += 2
+	}
+	if len(value.data) < pos+2 {
+		return nil, fmt.Errorf("entry is too short")
+	}
+	localKeySize := int(binary.LittleEndian.Uint16(value.data[pos : pos+2]))
+	pos += 2 + localKeySize
+	if len(value.data) < pos {
+		return nil, fmt.Errorf("entry key is out of bounds")
+	}
+
+	return value.data[pos:], nil
+}
+
+// Calls f for every leaf entry data of B-tree with root at fdpPage
+func (db *eseDatabase) walkTree(fdpPage uint32, f func([]byte) error) error {
+	visited := map[uint32]bool{}
+	var walk func(number uint32) error
+	walk = func(number uint32) error {
+		if visited[number] {
+			return fmt.Errorf("page %d: loop in tree", number)
+		}
+		visited[number] = true
+
+		p, err := db.readPage(number)
+		if err != nil {
+			return err
+		}
+		if p.flags&(esePageFlagEmpty|esePageFlagSpace|esePageFlagLong) != 0 {
+			return nil
+		}
+
+		// Value 0 is page header, entries start from 1
+		for i := 1; i < len(p.values); i++ {
+			if p.values[i].flags&eseTagFlagDefunct != 0 {
+				continue
+			}
+			data, err := eseEntryData(p.values[i])
+			if err != nil {
+				return fmt.Errorf("page %d value %d: %s", number, i, err)
+			}
+
+			if p.flags&esePageFlagLeaf != 0 {
+				err = f(data)
+			} else if p.flags&esePageFlagParent != 0 && len(data) >= 4 {
+				err = walk(binary.LittleEndian.Uint32(data[0:4]))
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return walk(fdpPage)
+}
+
+// MSysObjects fixed columns: 1 ObjidTable, 2 Type, 3 Id, 4 ColtypOrPgnoFDP, 5 SpaceUsage; variable 128 Name
+func (db *eseDatabase) loadCatalog() error {
+	catalogColumns := map[uint32]eseColumn{
+		1:   {id: 1, colType: eseColumnTypeLong},
+		2:   {id: 2, colType: eseColumnTypeShort},
+		3:   {id: 3, colType: eseColumnTypeLong},
+		4:   {id: 4, colType: eseColumnTypeLong},
+		5:   {id: 5, colType: eseColumnTypeLong},
+		6:   {id: 6, colType: eseColumnTypeLong},
+		7:   {id: 7, colType: eseColumnTypeLong},
+		8:   {id: 8, colType: eseColumnTypeUnsignedByte},
+		9:   {id: 9, colType: eseColumnTypeShort},
+		10:  {id: 10, colType: eseColumnTypeLong},
+		11:  {id: 11, colType: eseColumnTypeUnsignedShort},
+		128: {id: 128, colType: eseColumnTypeText},
+	}
+	catalog := &eseTable{name: "MSysObjects", columns: catalogColumns}
+
+	tablesByObjId := map[uint32]*eseTable{}
+	var columns []struct {
+		objId  uint32
+		column eseColumn
+	}
+
+	err := db.walkTree(eseCatalogPage, func(data []byte) error {
+		record, err := db.parseRecord(data, catalog)
+		if err != nil {
+			return err
+		}
+		objId := eseUint32(record[1])
+		id := eseUint32(record[3])
+		colTypeOrFdp := eseUint32(record[4])
+		name := string(record[128])
+
+		switch eseUint32(record[2]) {
+		case eseCatalogTypeTable:
+			t := &eseTable{
+				name:    name,
+				objId:   objId,
+				fdpPage: colTypeOrFdp,
+				columns: map[uint32]eseColumn{},
+			}
+			tablesByObjId[objId] = t
+			db.tables[name] = t
+		case eseCatalogTypeColumn:
+			columns = append(columns, struct {
+				objId  uint32
+				column eseColumn
+			}{objId, eseColumn{id: id, name: name, colType: colTypeOrFdp, size: eseUint32(record[5])}})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range columns {
+		if t, found := tablesByObjId[c.objId]; found {
+			t.columns[c.column.id] = c.column
+		}
+	}
+
+	return nil
+}
+
+// Calls f for every record of table
+func (db *eseDatabase) walkTable(tableName string, f func(eseRecord) error) error {
+	t, found := db.tables[tableName]
+	if !found {
+		return fmt.Errorf("table %s not found", tableName)
+	}
+
+	return db.walkTree(t.fdpPage, func(data []byte) error {
+		record, err := db.parseRecord(data, t)
+		if err != nil {
+			return fmt.Errorf("table %s: %s", tableName, err)
+		}
+		return f(record)
+	})
+}
+
+func (t *eseTable) columnId(name string) (uint32, bool) {
+	for id, column := range t.columns {
+		if column.name == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func eseFixedSize(column eseColumn) int {
+	switch column.colType {
+	case eseColumnTypeBit, eseColumnTypeUnsignedByte:
+		return 1
+	case eseColumnTypeShort, eseColumnTypeUnsignedShort:
+		return 2
+	case eseColumnTypeLong, eseColumnTypeUnsignedLong, eseColumnTypeIEEESingle:
+		return 4
+	case eseColumnTypeCurrency, eseColumnTypeIEEEDouble, eseColumnTypeDateTime, eseColumnTypeLongLong:
+		return 8
+	case eseColumnTypeGUID:
+		return 16
+	}
+	return int(column.size)
+}
+
+// Record: last fixed column id, last variable column id, offset of variable data,
+// fixed data, null bitmap, variable offsets, variable data, tagged data
+func (db *eseDatabase) parseRecord(data []byte, t *eseTable) (eseRecord, error) {
+	record := eseRecord{}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("record is too short")
+	}
+	lastFixed := uint32(data[0])
+	lastVariable := uint32(data[1])
+	variableOffset := int(binary.LittleEndian.Uint16(data[2:4]))
+	if variableOffset > len(data) || variableOffset-int((lastFixed+7)/8) < 4 {
+		return nil, fmt.Errorf("variable data offset %d out of record", variableOffset)
+	}
+
+	nullBitmap := data[variableOffset-int((lastFixed+7)/8) : variableOffset]
+	pos := 4
+	for id := uint32(1); id <= lastFixed; id++ {
+		column, found := t.columns[id]
+		if !found {
+			break // size of following fixed columns is unknown
+		}
+		size := eseFixedSize(column)
+		if pos+size > variableOffset {
+			return nil, fmt.Errorf("fixed column %d out of record", id)
+		}
+		if nullBitmap[(id-1)/8]&(1<<((id-1)%8)) == 0 {
+			record[id] = data[pos : pos+size]
+		}
+		pos += size
+	}
+
+	variableDataStart := variableOffset
+	previousEnd := 0
+	if lastVariable >= 128 {
+		count := int(lastVariable - 127)
+		variableDataStart = variableOffset + count*2
+		if variableDataStart > len(data) {
+			return nil, fmt.Errorf("variable offsets out of record")
+		}
+		for i := 0; i < count; i++ {
+			end := binary.LittleEndian.Uint16(data[variableOffset+i*2:])
+			if end&0x8000 != 0 {
+				previousEnd = int(end & 0x7fff)
+				continue // null
+			}
+			if variableDataStart+int(end) > len(data) || int(end) < previousEnd {
+				return nil, fmt.Errorf("variable column %d out of record", 128+i)
+			}
+			record[uint32(128+i)] = data[variableDataStart+previousEnd : variableDataStart+int(end)]
+			previousEnd = int(end)
+		}
+	}
+
+	tagged := data[variableDataStart+previousEnd:]
+	if len(tagged) < 4 {
+		return record, nil
+	}
+	offsetMask := uint16(0x3fff)
+	if db.isLargePage() {
+		offsetMask = 0x7fff
+	}
+	arraySize := int(binary.LittleEndian.Uint16(tagged[2:4]) & offsetMask)
+	if arraySize < 4 || arraySize > len(tagged) {
+		return nil, fmt.Errorf("tagged data array out of record")
+	}
+	for i := 0; i < arraySize/4; i++ {
+		id := uint32(binary.LittleEndian.Uint16(tagged[i*4:]))
+		offsetField := binary.LittleEndian.Uint16(tagged[i*4+2:])
+		start := int(offsetField & offsetMask)
+		end := len(tagged)
+		if i+1 < arraySize/4 {
+			end = int(binary.LittleEndian.Uint16(tagged[(i+1)*4+2:]) & offsetMask)
+		}
+		if start > end || end > len(tagged) {
+			return nil, fmt.Errorf("tagged column %d out of record", id)
+		}
+		value := tagged[start:end]
+
+		hasFlags := db.isLargePage() || offsetField&0x4000 != 0
+		if hasFlags && len(value) > 0 {
+			flags := value[0]
+			value = value[1:]
+			if flags&eseTaggedFlagLongValue != 0 {
+				db.skip(t, id, "long value")
+				continue
+			}
+			if flags&eseTaggedFlagCompressed != 0 {
+				decompressed, err := eseDecompress(value)
+				if err != nil {
+					db.skip(t, id, err.Error())
+					continue
+				}
+				value = decompressed
+			}
+		}
+		record[id] = value
+	}
+
+	return record, nil
+}
+
+func (db *eseDatabase) skip(t *eseTable, columnId uint32, reason string) {
+	name := t.columns[columnId].name
+	if name == "" {
+		name = fmt.Sprintf("%d", columnId)
+	}
+	db.skipped[fmt.Sprintf("table %s column %s: %s", t.name, name, reason)]++
+}
+
+// Returns descriptions of skipped values like "table T column C: long value, 2 values"
+func (db *eseDatabase) skippedValues() []string {
+	var l []string
+	for description, count := range db.skipped {
+		l = append(l, fmt.Sprintf("%s, %d values", description, count))
+	}
+	sort.Strings(l)
+	return l
+}
+
+// Supports 7-bit ASCII and 7-bit Unicode compression only
+func eseDecompress(data []byte) ([]byte, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("empty compressed value")
+	}
+	compressionType := data[0] >> 3
+	if compressionType != 1 && compressionType != 2 {
+		return nil, fmt.Errorf("unsupported compression type %d", compressionType)
+	}
+
+	var out []byte
+	bitBuffer := uint32(0)
+	bitCount := uint32(0)
+	for _, b := range data[1:] {
+		bitBuffer |= uint32(b) << bitCount
+		bitCount += 8
+		for bitCount >= 7 {
+			char := byte(bitBuffer & 0x7f)
+			out = append(out, char)
+			if compressionType == 2 {
+				out = append(out, 0) // UTF-16LE
+			}
+			bitBuffer >>= 7
+			bitCount -= 7
+		}
+	}
+
+	return out, nil
+}
+
+func eseUint32(b []byte) uint32 {
+	switch len(b) {
+	case 1:
+		return uint32(b[0])
+	case 2:
+		return uint32(binary.LittleEndian.Uint16(b))
+	case 4, 8:
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// Returns numeric column value as float64
+func eseFloat64(column eseColumn, b []byte) (float64, error) {
+	if len(b) < eseFixedSize(column) {
+		return 0, fmt.Errorf("column %s has %d bytes", column.name, len(b))
+	}
+	switch column.colType {
+	case eseColumnTypeBit, eseColumnTypeUnsignedByte:
+		return float64(b[0]), nil
+	case eseColumnTypeShort:
+		return float64(int16(binary.LittleEndian.Uint16(b))), nil
+	case eseColumnTypeUnsignedShort:
+		return float64(binary.LittleEndian.Uint16(b)), nil
+	case eseColumnTypeLong:
+		return float64(int32(binary.LittleEndian.Uint32(b))), nil
+	case eseColumnTypeUnsignedLong:
+		return float64(binary.LittleEndian.Uint32(b)), nil
+	case eseColumnTypeLongLong, eseColumnTypeCurrency:
+		return float64(int64(binary.LittleEndian.Uint64(b))), nil
+	case eseColumnTypeIEEESingle:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case eseColumnTypeIEEEDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	}
+	return 0, fmt.Errorf("column %s of type %d is not numeric", column.name, column.colType)
+}
+
+// DateTime is OLE Automation date: days since 1899-12-30
+func eseTime(b []byte) (time.Time, error) {
+	if len(b) < 8 {
+		return time.Time{}, fmt.Errorf("datetime has %d bytes", len(b))
+	}
+	days := math.Float64frombits(binary.LittleEndian.Uint64(b))
+	oleEpoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return oleEpoch.Add(time.Duration(days * 24 * float64(time.Hour))), nil
+}
+
+// Decodes UTF-16LE blob, returns as is if it is not UTF-16
+func eseString(b []byte) string {
+	if len(b) < 2 || len(b)%2 != 0 || b[1] != 0 {
+		return string(b)
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// Test databases are written with 4 KB pages: header and shadow header, catalog at page 4 and
+// tables from page 5. Table records are split to leaf pages of eseTestRecordsPerPage records,
+// root of table with several leaf pages is parent page.
+const (
+	eseTestPageSize       = 4096
+	eseTestRevision       = 0x0c
+	eseTestRecordsPerPage = 2
+)
+
+type eseTestColumn struct {
+	id      uint32
+	name    string
+	colType uint32
+}
+
+// Value of tagged column starts with flags byte
+type eseTestTable struct {
+	name    string
+	columns []eseTestColumn
+	records []map[uint32][]byte
+}
+
+var eseTestCatalogColumns = []eseTestColumn{
+	{1, "ObjidTable", eseColumnTypeLong},
+	{2, "Type", eseColumnTypeShort},
+	{3, "Id", eseColumnTypeLong},
+	{4, "ColtypOrPgnoFDP", eseColumnTypeLong},
+	{5, "SpaceUsage", eseColumnTypeLong},
+	{128, "Name", eseColumnTypeText},
+}
+
+func eseTestWriteDatabase(t *testing.T, dbFilePath string, tables []eseTestTable) {
+	pages := [][]byte{nil, nil, nil, nil} // pages 1-3 are not used, catalog page is written last
+	var catalog []map[uint32][]byte
+	for i, table := range tables {
+		objId := uint32(i + 2)
+		var leafs []uint32
+		for start := 0; start < len(table.records) || start == 0; start += eseTestRecordsPerPage {
+			end := start + eseTestRecordsPerPage
+			if end > len(table.records) {
+				end = len(table.records)
+			}
+			var entries [][]byte
+			for _, record := range table.records[start:end] {
+				entries = append(entries, eseTestRecord(table.columns, record))
+			}
+			pages = append(pages, eseTestPage(esePageFlagLeaf, entries))
+			leafs = append(leafs, uint32(len(pages)))
+		}
+		fdpPage := leafs[0]
+		if len(leafs) > 1 {
+			var entries [][]byte
+			for _, leaf := range leafs {
+				entries = append(entries, eseTestUint32(leaf))
+			}
+			pages = append(pages, eseTestPage(esePageFlagParent, entries))
+			fdpPage = uint32(len(pages))
+		}
+
+		catalog = append(catalog, map[uint32][]byte{
+			1: eseTestUint32(objId), 2: {eseCatalogTypeTable, 0}, 3: eseTestUint32(objId),
+			4: eseTestUint32(fdpPage), 5: eseTestUint32(0), 128: []byte(table.name),
+		})
+		for _, column := range table.columns {
+			catalog = append(catalog, map[uint32][]byte{
+				1: eseTestUint32(objId), 2: {eseCatalogTypeColumn, 0}, 3: eseTestUint32(column.id),
+				4: eseTestUint32(column.colType), 5: eseTestUint32(0), 128: []byte(column.name),
+			})
+		}
+	}
+	var catalogEntries [][]byte
+	for _, record := range catalog {
+		catalogEntries = append(catalogEntries, eseTestRecord(eseTestCatalogColumns, record))
+	}
+	pages[eseCatalogPage-1] = eseTestPage(esePageFlagLeaf, catalogEntries)
+
+	header := make([]byte, eseTestPageSize)
+	binary.LittleEndian.PutUint32(header[4:8], eseSignature)
+	binary.LittleEndian.PutUint32(header[232:236], eseTestRevision)
+	binary.LittleEndian.PutUint32(header[236:240], eseTestPageSize)
+	content := append(append([]byte{}, header...), header...)
+	for _, page := range pages {
+		if page == nil {
+			page = make([]byte, eseTestPageSize)
+		}
+		content = append(content, page...)
+	}
+
+	err := ioutil.WriteFile(dbFilePath, content, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Entries get 4 bytes local key, value 0 is empty page header
+func eseTestPage(flags uint32, entries [][]byte) []byte {
+	page := make([]byte, eseTestPageSize)
+	binary.LittleEndian.PutUint32(page[36:40], flags)
+	binary.LittleEndian.PutUint16(page[34:36], uint16(len(entries)+1))
+	offset := 0
+	for i, entry := range entries {
+		value := append([]byte{4, 0}, eseTestUint32(uint32(i))...)
+		value = append(value, entry...)
+		copy(page[40+offset:], value)
+		tagPos := eseTestPageSize - 4*(i+2)
+		binary.LittleEndian.PutUint16(page[tagPos:], uint16(len(value)))
+		binary.LittleEndian.PutUint16(page[tagPos+2:], uint16(offset))
+		offset += len(value)
+	}
+	return page
+}
+
+func eseTestRecord(columns []eseTestColumn, values map[uint32][]byte) []byte {
+	lastFixed, lastVariable := uint32(0), uint32(127)
+	var tagged []uint32
+	for _, column := range columns {
+		switch {
+		case column.id < 128 && column.id > lastFixed:
+			lastFixed = column.id
+		case column.id >= 128 && column.id < 256 && column.id > lastVariable:
+			lastVariable = column.id
+		case column.id >= 256:
+			if _, found := values[column.id]; found {
+				tagged = append(tagged, column.id)
+			}
+		}
+	}
+	byId := map[uint32]eseTestColumn{}
+	for _, column := range columns {
+		byId[column.id] = column
+	}
+
+	record := []byte{byte(lastFixed), byte(lastVariable), 0, 0}
+	bitmap := make([]byte, (lastFixed+7)/8)
+	for id := uint32(1); id <= lastFixed; id++ {
+		column := eseColumn{colType: byId[id].colType}
+		value, found := values[id]
+		if !found {
+			bitmap[(id-1)/8] |= 1 << ((id - 1) % 8)
+			value = make([]byte, eseFixedSize(column))
+		}
+		record = append(record, value...)
+	}
+	record = append(record, bitmap...)
+	binary.LittleEndian.PutUint16(record[2:4], uint16(len(record)))
+
+	var variableData []byte
+	for id := uint32(128); id <= lastVariable; id++ {
+		value, found := values[id]
+		end := uint16(len(variableData) + len(value))
+		if !found {
+			end |= 0x8000
+		}
+		record = append(record, byte(end), byte(end>>8))
+		variableData = append(variableData, value...)
+	}
+	record = append(record, variableData...)
+
+	sort.Slice(tagged, func(i, j int) bool { return tagged[i] < tagged[j] })
+	offset := 4 * len(tagged)
+	var taggedData []byte
+	for _, id := range tagged {
+		record = append(record, byte(id), byte(id>>8), byte(offset), byte(offset>>8)|0x40)
+		taggedData = append(taggedData, values[id]...)
+		offset += len(values[id])
+	}
+	return append(record, taggedData...)
+}
+
+func eseTestUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func eseTestUint64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+func eseTestTime(t time.Time) []byte {
+	days := t.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+	return eseTestUint64(math.Float64bits(days))
+}
+
+func eseTestUtf16(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	return append(b, 0, 0)
+}
+
+// 7-bit compression of ASCII text, compression type 2 decompresses to UTF-16
+func eseTestCompress7bit(s string, compressionType byte) []byte {
+	out := []byte{compressionType << 3}
+	bitBuffer, bitCount := uint32(0), uint32(0)
+	for _, c := range []byte(s) {
+		bitBuffer |= uint32(c&0x7f) << bitCount
+		bitCount += 7
+		for bitCount >= 8 {
+			out = append(out, byte(bitBuffer))
+			bitBuffer >>= 8
+			bitCount -= 8
+		}
+	}
+	if bitCount > 0 {
+		out = append(out, byte(bitBuffer))
+	}
+	return out
+}
+
+func eseTestTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ese")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func eseTestOpen(t *testing.T, tables []eseTestTable) *eseDatabase {
+	dbFilePath := filepath.Join(eseTestTempDir(t), "test.dat")
+	eseTestWriteDatabase(t, dbFilePath, tables)
+
+	db, err := eseOpen(dbFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestEseWalkTable(t *testing.T) {
+	columns := []eseTestColumn{
+		{1, "Long", eseColumnTypeLong},
+		{2, "Short", eseColumnTypeShort},
+		{3, "Double", eseColumnTypeIEEEDouble},
+		{4, "LongLong", eseColumnTypeLongLong},
+		{128, "Text", eseColumnTypeText},
+		{129, "Binary", eseColumnTypeBinary},
+		{256, "LongBinary", eseColumnTypeLongBinary},
+		{257, "LongText", eseColumnTypeLongText},
+	}
+	tests := []struct {
+		name     string
+		values   map[uint32][]byte
+		expected eseRecord
+		skipped  int
+	}{
+		{
+			name: "all columns",
+			values: map[uint32][]byte{
+				1: eseTestUint32(0xfffffffe), 2: {7, 0}, 3: eseTestUint64(math.Float64bits(1.5)), 4: eseTestUint64(1 << 40),
+				128: []byte("text"), 129: {1, 2, 3}, 256: {0, 9, 8}, 257: append([]byte{0}, eseTestUtf16("path")...),
+			},
+			expected: eseRecord{
+				1: eseTestUint32(0xfffffffe), 2: {7, 0}, 3: eseTestUint64(math.Float64bits(1.5)), 4: eseTestUint64(1 << 40),
+				128: []byte("text"), 129: {1, 2, 3}, 256: {9, 8}, 257: eseTestUtf16("path"),
+			},
+		},
+		{
+			name:     "null columns",
+			values:   map[uint32][]byte{2: {1, 0}, 129: {5}},
+			expected: eseRecord{2: {1, 0}, 129: {5}},
+		},
+		{
+			name:     "7-bit ASCII compressed",
+			values:   map[uint32][]byte{1: eseTestUint32(1), 257: append([]byte{eseTaggedFlagCompressed}, eseTestCompress7bit("chrome.exe", 1)...)},
+			expected: eseRecord{1: eseTestUint32(1), 257: []byte("chrome.exe")},
+		},
+		{
+			name:     "7-bit Unicode compressed",
+			values:   map[uint32][]byte{1: eseTestUint32(1), 257: append([]byte{eseTaggedFlagCompressed}, eseTestCompress7bit("ab", 2)...)},
+			expected: eseRecord{1: eseTestUint32(1), 257: {'a', 0, 'b', 0}},
+		},
+		{
+			name:     "long value",
+			values:   map[uint32][]byte{1: eseTestUint32(1), 256: append([]byte{eseTaggedFlagLongValue}, eseTestUint32(0x80000001)...)},
+			expected: eseRecord{1: eseTestUint32(1)},
+			skipped:  1,
+		},
+		{
+			name:     "XPRESS compressed",
+			values:   map[uint32][]byte{1: eseTestUint32(1), 256: {eseTaggedFlagCompressed, 3 << 3, 1, 2}},
+			expected: eseRecord{1: eseTestUint32(1)},
+			skipped:  1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Several records check walk of parent page
+			table := eseTestTable{name: "Test", columns: columns}
+			for i := 0; i < eseTestRecordsPerPage*2+1; i++ {
+				table.records = append(table.records, test.values)
+			}
+			db := eseTestOpen(t, []eseTestTable{table})
+
+			records := 0
+			err := db.walkTable("Test", func(record eseRecord) error {
+				records++
+				if len(record) != len(test.expected) {
+					t.Errorf("got %v, expected %v", record, test.expected)
+				}
+				for id, value := range test.expected {
+					if string(record[id]) != string(value) {
+						t.Errorf("column %d: got %v, expected %v", id, record[id], value)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if records != len(table.records) {
+				t.Errorf("got %d records, expected %d", records, len(table.records))
+			}
+			if len(db.skippedValues()) != test.skipped {
+				t.Errorf("got skipped %v, expected %d", db.skippedValues(), test.skipped)
+			}
+		})
+	}
+}
+
+func TestEseCatalog(t *testing.T) {
+	db := eseTestOpen(t, []eseTestTable{
+		{name: "First", columns: []eseTestColumn{{1, "Id", eseColumnTypeLong}}},
+		{name: "Second", columns: []eseTestColumn{{1, "Id", eseColumnTypeLong}, {256, "Blob", eseColumnTypeLongBinary}}},
+	})
+
+	if len(db.tables) != 2 {
+		t.Fatalf("got %d tables, expected 2", len(db.tables))
+	}
+	id, found := db.tables["Second"].columnId("Blob")
+	if !found || id != 256 || db.tables["Second"].columns[id].colType != eseColumnTypeLongBinary {
+		t.Errorf("column Blob of table Second: got id %d found %t", id, found)
+	}
+	err := db.walkTable("Third", func(eseRecord) error { return nil })
+	if err == nil {
+		t.Errorf("walk of unknown table has no error")
+	}
+}
+
+func TestEseValues(t *testing.T) {
+	tests := []struct {
+		colType  uint32
+		value    []byte
+		expected float64
+	}{
+		{eseColumnTypeUnsignedByte, []byte{200}, 200},
+		{eseColumnTypeShort, []byte{0xff, 0xff}, -1},
+		{eseColumnTypeUnsignedShort, []byte{0xff, 0xff}, 65535},
+		{eseColumnTypeLong, eseTestUint32(0xffffffff), -1},
+		{eseColumnTypeUnsignedLong, eseTestUint32(0xffffffff), 4294967295},
+		{eseColumnTypeLongLong, eseTestUint64(1 << 40), 1 << 40},
+		{eseColumnTypeIEEESingle, eseTestUint32(math.Float32bits(0.5)), 0.5},
+		{eseColumnTypeIEEEDouble, eseTestUint64(math.Float64bits(2.25)), 2.25},
+	}
+	for _, test := range tests {
+		value, err := eseFloat64(eseColumn{name: "test", colType: test.colType}, test.value)
+		if err != nil || value != test.expected {
+			t.Errorf("type %d %v: got %v %v, expected %v", test.colType, test.value, value, err, test.expected)
+		}
+	}
+
+	_, err := eseFloat64(eseColumn{name: "test", colType: eseColumnTypeLong}, []byte{1})
+	if err == nil {
+		t.Errorf("short value has no error")
+	}
+
+	expectedTime := time.Date(2017, 12, 17, 1, 6, 58, 0, time.UTC)
+	ts, err := eseTime(eseTestTime(expectedTime))
+	if err != nil || ts.Sub(expectedTime) > time.Millisecond || expectedTime.Sub(ts) > time.Millisecond {
+		t.Errorf("got %s %v, expected %s", ts, err, expectedTime)
+	}
+
+	if s := eseString(eseTestUtf16(`\Device\chrome.exe`)); s != `\Device\chrome.exe` {
+		t.Errorf("got '%s'", s)
+	}
+}
@@ -3,23 +3,37 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
 const (
-	intelPowerMeasureSet                   = "Intel Power"
-	patternCumulativeGTEnergyJoules        = "Cumulative GT Energy_0 (Joules)"
-	patternCumulativeGTEnergyMwh           = "Cumulative GT Energy_0 (mWh)"
-	patternCumulativeProcessorEnergyJoules = "Cumulative Processor Energy_0 (Joules)"
-	patternCumulativeProcessorEnergyMwh    = "Cumulative Processor Energy_0 (mWh)"
-	patternCumulativeDramEnergyJoules      = "Cumulative DRAM Energy_0 (Joules)"
-	patternCumulativeIaEnergyJoules        = "Cumulative IA Energy_0 (Joules)"
+	intelPowerMeasureSet        = "Intel Power"
+	intelPowerLogColElapsedTime = "Elapsed Time (sec)"
+	intelPowerLogColSystemTime  = "System Time"
+	intelPowerLogJoulesPerMwh   = 3.6
 )
 
+// "Cumulative GT Energy_0 (mWh)" in summary or "Cumulative GT Energy_0(mWh)" in samples header
+var intelPowerLogEnergyRegExp = regexp.MustCompile(`^Cumulative (.+) Energy_([0-9]+) ?\((Joules|mWh)\)$`)
+
+// "GT Power_0(Watt)", "CPU Frequency_0(MHz)", "Package Temperature_0(C)", "CPU Utilization(%)"
+var intelPowerLogColumnRegExp = regexp.MustCompile(`^(.+?) ?\((Watt|MHz|C|%)\)$`)
+
+// Summary line like "Average Processor Power_0 (Watt) = 2.44"
+var intelPowerLogSummaryRegExp = regexp.MustCompile(`^\s*(.+?)\s*=\s*([-+0-9.eE]+)\s*$`)
+
+type intelPowerLogData struct {
+	header  []string
+	samples [][]float64 // NaN for System Time and empty cells
+	// Cumulative energies by normalized name like "Cumulative GT Energy_0 (Joules)", mWh converted to Joules
+	summary map[string]float64
+}
+
 func generateChartsForIntelPowerLogFiles(files []os.FileInfo) error {
 	measures := []Measure{}
 
@@ -66,7 +80,12 @@ func groupMeasuresByIterations(measures []Measure) map[string]map[string][]Measu
 		browserProcessName := m.browser
 		fullSetName := getMeasureSetFullName(
 			m.measureSet, browserProcessName, m.measureName, m.scenarioName,
-		) + " by iterations"
+		)
+		if !scenarioMeasureSelected(m, fullSetName) {
+			continue
+		}
+		fullSetName += " by iterations"
+		scenarioReportAddIterationsChart(fullSetName, m.scenarioName)
 
 		if browserResults[fullSetName] == nil {
 			browserResults[fullSetName] = make(map[string][]Measure)
@@ -78,61 +97,236 @@ func groupMeasuresByIterations(measures []Measure) map[string]map[string][]Measu
 	return browserResults
 }
 
-//Search for total values like:
-//Cumulative GT Energy_0 (Joules) = 1.712036
-//Cumulative GT Energy_0 (mWh) = 0.475566
+// Summary section with total values like:
+//
+//	Cumulative GT Energy_0 (Joules) = 1.712036
+//	Cumulative GT Energy_0 (mWh) = 0.475566
+//
+// is preceded by sampled section:
+//
+//	System Time,RDTSC,Elapsed Time (sec),CPU Utilization(%),CPU Frequency_0(MHz),Processor Power_0(Watt),...
+//	12:49:19:676,5404011564212,1.003,3.000,2494,2.482,...
 func intelPowerLogGetMeasures(csvFilePath string) ([]Measure, error) {
 	msrs := []Measure{}
 
-	f, err := os.Open(csvFilePath)
+	metaMeasure, err := generalGetFileMeta(csvFilePath)
+	if err != nil {
+		metaMeasure, err = intelPowerLogGetFileMeta(csvFilePath)
+		if err != nil {
+			return msrs, err
+		}
+	}
+	metaMeasure.measureSet = intelPowerMeasureSet
+
+	data, err := intelPowerLogReadFile(csvFilePath)
 	if err != nil {
 		return msrs, err
 	}
 
+	energies := intelPowerLogGetEnergies(csvFilePath, metaMeasure, data)
+	for name, val := range energies {
+		m := metaMeasure
+		m.measureName = name
+		m.value = val
+		msrs = append(msrs, m)
+	}
+
+	for name, val := range intelPowerLogGetSampleStats(data) {
+		m := metaMeasure
+		m.measureName = name
+		m.value = val
+		msrs = append(msrs, m)
+	}
+
+	//fmt.Printf("%#v\n", msrs)
+	return msrs, nil
+}
+
+func intelPowerLogReadFile(csvFilePath string) (intelPowerLogData, error) {
+	data := intelPowerLogData{summary: map[string]float64{}}
+
+	f, err := os.Open(csvFilePath)
+	if err != nil {
+		return data, err
+	}
+	defer f.Close()
+
+	lineNumber := 0
+	inSamples := false
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return msrs, err
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r ")
+
+		if strings.HasPrefix(line, intelPowerLogColSystemTime) {
+			for _, colTitle := range strings.Split(line, ",") {
+				data.header = append(data.header, strings.Trim(colTitle, " "))
+			}
+			inSamples = true
+			continue
+		}
+
+		if match := intelPowerLogSummaryRegExp.FindStringSubmatch(line); len(match) == 3 {
+			inSamples = false
+			energy := intelPowerLogEnergyRegExp.FindStringSubmatch(match[1])
+			if len(energy) != 4 {
+				continue
+			}
+			val, err := intelPowerLogParse(line)
+			if err != nil {
+				return data, fmt.Errorf("%s: line %d: %v", csvFilePath, lineNumber, err)
+			}
+			name, val := intelPowerLogNormalizeEnergy(energy, val)
+			// Joules are more precise than mWh, don't override them
+			if _, found := data.summary[name]; !found || energy[3] == "Joules" {
+				data.summary[name] = val
+			}
+			continue
 		}
-		m, err := intelPowerLogGetMeasureFromLogString(csvFilePath, scanner.Text())
-		if err == io.EOF {
+
+		if !inSamples || line == "" {
+			inSamples = false
 			continue
 		}
-		if err != nil {
-			return msrs, err
+
+		cells := strings.Split(line, ",")
+		sample := make([]float64, len(data.header))
+		for colId := range sample {
+			sample[colId] = math.NaN()
+			if colId == 0 || colId >= len(cells) || strings.Trim(cells[colId], " ") == "" {
+				continue // System Time is not a number
+			}
+			val, err := strconv.ParseFloat(strings.Trim(cells[colId], " "), 64)
+			if err != nil {
+				return data, fmt.Errorf("%s: line %d column %s: %v", csvFilePath, lineNumber, data.header[colId], err)
+			}
+			sample[colId] = val
 		}
-		msrs = append(msrs, m)
+		data.samples = append(data.samples, sample)
 	}
-	//fmt.Printf("%#v\n", msrs)
-	return msrs, nil
+	if err := scanner.Err(); err != nil {
+		return data, fmt.Errorf("%s: %v", csvFilePath, err)
+	}
+
+	return data, nil
 }
 
-func intelPowerLogGetMeasureFromLogString(csvFilePath, logString string) (Measure, error) {
-	var m Measure
-	var err error
-	patterns := []string{
-		patternCumulativeGTEnergyJoules,
-		patternCumulativeProcessorEnergyJoules,
-		patternCumulativeDramEnergyJoules,
-		patternCumulativeIaEnergyJoules,
-	}
-	for _, pattern := range patterns {
-		if strings.Contains(logString, pattern) {
-			m, err = generalGetFileMeta(csvFilePath)
-			if err != nil {
-				return m, err
+// Returns name like "Cumulative GT Energy_0 (Joules)" and value in Joules
+func intelPowerLogNormalizeEnergy(match []string, val float64) (string, float64) {
+	if match[3] == "mWh" {
+		val *= intelPowerLogJoulesPerMwh
+	}
+	return fmt.Sprintf("Cumulative %s Energy_%s (Joules)", match[1], match[2]), val
+}
+
+// Energies from summary, if there is no summary from last cumulative sample or integrated power.
+// Summary is validated against power integrated over elapsed time, mismatch is data quality issue.
+func intelPowerLogGetEnergies(csvFilePath string, meta Measure, data intelPowerLogData) map[string]float64 {
+	energies := map[string]float64{}
+	for name, val := range data.summary {
+		energies[name] = val
+	}
+
+	colElapsed := -1
+	for colId, colTitle := range data.header {
+		if colTitle == intelPowerLogColElapsedTime {
+			colElapsed = colId
+		}
+	}
+
+	for colId, colTitle := range data.header {
+		if match := intelPowerLogEnergyRegExp.FindStringSubmatch(colTitle); len(match) == 4 {
+			name, val := intelPowerLogNormalizeEnergy(match, intelPowerLogLastSample(data.samples, colId))
+			if _, found := energies[name]; !found && !math.IsNaN(val) {
+				energies[name] = val
 			}
-			m.measureSet = intelPowerMeasureSet
-			m.measureName = pattern
-			val, err := intelPowerLogParse(logString)
-			if err != nil {
-				return m, err
+			continue
+		}
+
+		// "GT Power_0(Watt)" > "Cumulative GT Energy_0 (Joules)"
+		match := intelPowerLogColumnRegExp.FindStringSubmatch(colTitle)
+		if colElapsed < 0 || len(match) != 3 || match[2] != "Watt" || !strings.Contains(match[1], " Power_") {
+			continue
+		}
+		name := "Cumulative " + strings.Replace(match[1], " Power_", " Energy_", 1) + " (Joules)"
+
+		integrated := 0.0
+		previousElapsed := 0.0
+		for _, sample := range data.samples {
+			if !math.IsNaN(sample[colElapsed]) && !math.IsNaN(sample[colId]) {
+				integrated += sample[colId] * (sample[colElapsed] - previousElapsed)
 			}
-			m.value = val
-			return m, nil
+			if !math.IsNaN(sample[colElapsed]) {
+				previousElapsed = sample[colElapsed]
+			}
+		}
+		if len(data.samples) == 0 {
+			continue
+		}
+
+		summaryVal, found := energies[name]
+		if !found {
+			energies[name] = integrated
+			continue
+		}
+		if summaryVal > 0 && math.Abs(summaryVal-integrated)*100/summaryVal > *intelPowerTolerancePercent {
+			dataQualityAdd(dataQualityEnergyMismatch, csvFilePath, meta, "%s = %.3f differs from integrated %s = %.3f more than %.1f%%",
+				name, summaryVal, colTitle, integrated, *intelPowerTolerancePercent)
+		}
+	}
+
+	return energies
+}
+
+func intelPowerLogLastSample(samples [][]float64, colId int) float64 {
+	for i := len(samples) - 1; i >= 0; i-- {
+		if !math.IsNaN(samples[i][colId]) {
+			return samples[i][colId]
+		}
+	}
+	return math.NaN()
+}
+
+// Average and max of power, frequency and temperature, average utilization and share of "Package Hot" samples
+func intelPowerLogGetSampleStats(data intelPowerLogData) map[string]float64 {
+	stats := map[string]float64{}
+	for colId, colTitle := range data.header {
+		sum, max, count := 0.0, 0.0, 0
+		for _, sample := range data.samples {
+			if math.IsNaN(sample[colId]) {
+				continue
+			}
+			sum += sample[colId]
+			if count == 0 || sample[colId] > max {
+				max = sample[colId]
+			}
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(colTitle, "Package Hot") {
+			// 1 if package is throttled in sample
+			stats[colTitle+" (% of samples)"] = sum * 100 / float64(count)
+			continue
+		}
+
+		match := intelPowerLogColumnRegExp.FindStringSubmatch(colTitle)
+		if len(match) != 3 {
+			continue
+		}
+		// "Package PL1_0(Watt)" is power limit, not consumption
+		if match[2] == "Watt" && !strings.Contains(match[1], " Power") {
+			continue
+		}
+		stats[fmt.Sprintf("Average %s (%s)", match[1], match[2])] = sum / float64(count)
+		if match[2] != "%" {
+			stats[fmt.Sprintf("Max %s (%s)", match[1], match[2])] = max
 		}
 	}
-	return m, io.EOF
+
+	return stats
 }
 
 func intelPowerLogParse(token string) (float64, error) {
@@ -149,14 +343,17 @@ func intelPowerLogParse(token string) (float64, error) {
 	return 0.0, fmt.Errorf("intelPowerLogParse value not found in '%s'", token)
 }
 
+// Old file name like IntelPowerLog_chrome_0_yandexstaticfavicon.csv
 func intelPowerLogGetFileMeta(csvFilePath string) (Measure, error) {
 	base := filepath.Base(csvFilePath)
-	fileMetaTokens := strings.Split(base, "_")
+	fileMetaTokens := strings.Split(strings.TrimSuffix(base, filepath.Ext(base)), "_")
 	m := Measure{}
 	if len(fileMetaTokens) != 4 {
 		return m, fmt.Errorf("intelPowerLogGetFileMeta not enough tokens in '%s'", csvFilePath)
 	}
 	m.browser = browserNameToProcessName[fileMetaTokens[1]]
+	m.browserShortName = fileMetaTokens[1]
+	m.browserProcesses = browserShortNameToProcesses[m.browserShortName]
 	m.iteration = fileMetaTokens[2]
 	m.scenarioName = fileMetaTokens[3]
 	return m, nil
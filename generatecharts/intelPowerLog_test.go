@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Processor power of 2W and 4W during two 1s samples is 6 Joules
+const intelPowerLogTestSamples = "System Time,RDTSC,Elapsed Time (sec),CPU Utilization(%),Processor Power_0(Watt),Cumulative Processor Energy_0(Joules),Package Hot_0\r\n" +
+	"12:49:19:676,5404011564212,1.000,3.000,2.000,2.000,0\r\n" +
+	"12:49:20:676,5404011564213,2.000,5.000,4.000,6.000,1\r\n" +
+	"\r\n"
+
+func TestIntelPowerLogGetMeasures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "intelPowerLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]float64
+		issues   int
+	}{
+		{
+			name: "summary in Joules and mWh",
+			content: intelPowerLogTestSamples +
+				"Total Elapsed Time (sec) = 2.000\r\n" +
+				"Cumulative Processor Energy_0 (Joules) = 6.100000\r\n" +
+				"Cumulative Processor Energy_0 (mWh) = 1.700000\r\n",
+			expected: map[string]float64{
+				"Cumulative Processor Energy_0 (Joules)": 6.1,
+				"Average CPU Utilization (%)":            4,
+				"Average Processor Power_0 (Watt)":       3,
+				"Max Processor Power_0 (Watt)":           4,
+				"Package Hot_0 (% of samples)":           50,
+			},
+		},
+		{
+			name:    "summary in mWh",
+			content: intelPowerLogTestSamples + "Cumulative Processor Energy_0 (mWh) = 1.700000\r\n",
+			expected: map[string]float64{
+				"Cumulative Processor Energy_0 (Joules)": 1.7 * intelPowerLogJoulesPerMwh,
+			},
+		},
+		{
+			name:    "summary differs from integrated power",
+			content: intelPowerLogTestSamples + "Cumulative Processor Energy_0 (Joules) = 9.000000\r\n",
+			expected: map[string]float64{
+				"Cumulative Processor Energy_0 (Joules)": 9,
+			},
+			issues: 1,
+		},
+		{
+			name:    "samples without summary",
+			content: intelPowerLogTestSamples,
+			expected: map[string]float64{
+				"Cumulative Processor Energy_0 (Joules)": 6,
+			},
+		},
+		{
+			name: "integrated power without cumulative energy",
+			content: "System Time,RDTSC,Elapsed Time (sec),GT Power_0(Watt)\r\n" +
+				"12:49:19:676,5404011564212,0.500,2.000\r\n" +
+				"12:49:20:176,5404011564213,1.000,\r\n" +
+				"12:49:20:676,5404011564214,1.500,4.000\r\n",
+			expected: map[string]float64{
+				"Cumulative GT Energy_0 (Joules)": 3,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			csvFilePath := filepath.Join(dir, "yabro_youtube_1_IntelPowerLog_20180120_224843.csv")
+			err := ioutil.WriteFile(csvFilePath, []byte(test.content), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldIssues := dataQualityIssues
+			defer func() { dataQualityIssues = oldIssues }()
+
+			measures, err := intelPowerLogGetMeasures(csvFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]float64{}
+			for _, m := range measures {
+				got[m.measureName] = m.value
+				if m.measureSet != intelPowerMeasureSet || m.browser != yaBrowserProcessName {
+					t.Errorf("%s: got meta %v", m.measureName, m)
+				}
+			}
+			for name, value := range test.expected {
+				if val, found := got[name]; !found || math.Abs(val-value) > 1e-9 {
+					t.Errorf("%s: got %v, expected %v", name, got[name], value)
+				}
+			}
+			if issues := len(dataQualityIssues) - len(oldIssues); issues != test.issues {
+				t.Errorf("got %d data quality issues, expected %d", issues, test.issues)
+			}
+		})
+	}
+}
@@ -130,6 +130,7 @@ func ippetGetMeasures(csvFilePath string) ([]Measure, error) {
 	var msrs []Measure
 	for measureName, measureVal := range accum {
 		if measureVal == 0 {
+			dataQualityAdd(dataQualityZeroValue, csvFilePath, metaMeasure, "%s is dropped", measureName)
 			continue
 		}
 		m := metaMeasure
@@ -7,13 +7,13 @@ import (
 	"github.com/pkg/errors"
 	"github.com/wcharczuk/go-chart"
 	"github.com/wcharczuk/go-chart/drawing"
+	"io"
 	"io/ioutil"
 	"math/big"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -21,6 +21,7 @@ import (
 const (
 	csvColIdTest                    = 1
 	csvColIdIteration               = 2
+	csvColIdBrowser                 = 3
 	csvColIdMeasureSet              = 6
 	csvColIdMeasure                 = 7
 	csvColIdResult                  = 8
@@ -39,17 +40,49 @@ const (
 	microsoftEdgeShortName          = "edge"
 	microsoftEdgeProcessName        = "MicrosoftEdge.exe"
 	microsoftEdgeContentProcessName = "MicrosoftEdgeCP.exe"
+	gpuPercentageMeasureSet         = "gpuUsage GPU Percentage"
+	cpuUtilizationMeasureSet        = "cpuUsage CPU  Utilization %"
 )
 
 var (
-	chartDate    time.Time
-	csvPath      *string
-	pngPath      *string
-	cmpIn1       *string
-	cmpIn2       *string
-	cmpOut       *string
-	withSymbols  *bool
-	processNames = map[string]bool{
+	chartDate   time.Time
+	csvPath     *string
+	pngPath     *string
+	cmpIn1      *string
+	cmpIn2      *string
+	cmpOut      *string
+	cmpRuns     *string
+	cmpColumns  *int
+	cmpCombined *bool
+	themePath   *string
+	withSymbols *bool
+	// scenarios
+	scenarios             *string
+	measureSets           *string
+	scenarioReportEnabled *bool
+	// composite score
+	scoreConfigPath *string
+	// data quality report
+	strict *bool
+	// timer resolution report
+	idleScenarios               *string
+	timerScenarioDuration       *float64
+	timerMaxBelowDefaultPercent *float64
+	timerFailOnIdle1ms          *bool
+	// AMDuProf hotspots report
+	amdProfCliBaselineRun *string
+	// Intel Power Gadget log
+	intelPowerTolerancePercent *float64
+	// symbol store
+	symbolStore     *string
+	symbolsOffline  *bool
+	symbolsBrowser  *string
+	symbolsVersion  *string
+	symbolsBinaries *string
+	symbolsImport   *string
+	symbolsFetch    *bool
+	symbolsValidate *bool
+	processNames    = map[string]bool{
 		yaBrowserProcessName: true, yaBrowserDefaultProcessName: true,
 		chromeProcessName:   true,
 		chromiumProcessName: true,
@@ -110,18 +143,68 @@ func init() {
 	csvPath = flag.String("csv", "", "Path to directory with PerformanceResults_nnnn_nnnn.csv")
 	pngPath = flag.String("png", "", "Path to output directory for PNG files")
 	withSymbols = flag.Bool("withSymbols", false, "Process data with symbols paths")
+	themePath = flag.String("theme", "", "Path to JSON theme of chart sizes, font, colors, y-axis policies and label templates")
+	// scenarios
+	scenarios = flag.String("scenarios", "", "Comma separated scenario names to generate charts for. Default: all")
+	measureSets = flag.String("measureSets", "", "Comma separated measure sets like srum or prefixes of chart names like 'cpuUsage CPU' to generate charts for. Default: all")
+	scenarioReportEnabled = flag.Bool("scenarioReport", false, "Generate scenarios.html with scenario × browser heatmap of diffs vs Yandex Browser and page of charts per scenario")
+	// composite score
+	scoreConfigPath = flag.String("scoreConfig", "", "Path to JSON config of composite efficiency score metrics and weights, score.html is generated if set")
+	// data quality report
+	strict = flag.Bool("strict", false, "Fail if data quality report has missing iterations, unparseable rows, zero values, out of range timestamps or energy mismatches")
+	// timer resolution report
+	idleScenarios = flag.String("idleScenarios", "", "Comma separated idle scenario names, scenarios with 'idle' in name are idle anyway")
+	timerScenarioDuration = flag.Float64("timerScenarioDuration", 0, "Scenario duration in seconds if SocWatch file has no collection duration")
+	timerMaxBelowDefaultPercent = flag.Float64("timerMaxBelowDefaultPercent", 0, "Fail if browser keeps timer resolution below 15.6ms longer than percent of scenario. Default: disabled")
+	timerFailOnIdle1ms = flag.Bool("timerFailOnIdle1ms", false, "Fail if browser requests 1ms timer resolution during idle scenario")
+	// AMDuProf hotspots report
+	amdProfCliBaselineRun = flag.String("amdProfCliBaselineRun", "", "Path to directory of previous run to diff AMDuProf hotspots with")
+	// Intel Power Gadget log
+	intelPowerTolerancePercent = flag.Float64("intelPowerTolerancePercent", 5, "Warn if cumulative energy in IntelPowerLog summary differs from integrated samples more than percent")
+	// symbol store
+	symbolStore = flag.String("symbolStore", "SymbolStore", "Path to local symbol store with PDB files per browser version")
+	symbolsOffline = flag.Bool("symbolsOffline", false, "Use only local symbol store, do not use symbol servers")
+	symbolsBrowser = flag.String("symbolsBrowser", "", "Browser short name for -symbolsImport, -symbolsFetch, -symbolsValidate")
+	symbolsVersion = flag.String("symbolsVersion", "", "Browser version for symbol store. Default: from run manifest or Local State")
+	symbolsBinaries = flag.String("symbolsBinaries", "", "Path to browser binaries directory. Default: from run manifest")
+	symbolsImport = flag.String("symbolsImport", "", "Path to directory with PDB files to import to symbol store")
+	symbolsFetch = flag.Bool("symbolsFetch", false, "Download PDB files of browser binaries from symbol servers to symbol store")
+	symbolsValidate = flag.Bool("symbolsValidate", false, "Check PDB files in symbol store match browser binaries")
 	// comparing
 	cmpIn1 = flag.String("cmpIn1", "", "Path to first directory for comparing")
 	cmpIn2 = flag.String("cmpIn2", "", "Path to second directory for comparing")
 	cmpOut = flag.String("cmpOut", "", "Path to output directory for result of comparing")
+	cmpRuns = flag.String("cmpRuns", "", "Comma separated directories of runs for comparing with optional display names like before=C:\\runs\\1,after=C:\\runs\\2")
+	cmpColumns = flag.Int("cmpColumns", 2, "Count of runs in a row of comparing image")
+	cmpCombined = flag.Bool("cmpCombined", false, "Render one chart with bars of runs grouped by browser instead of grid of run charts, requires chart data JSON files of runs")
 }
 
 func main() {
 	flag.Parse()
 
-	if *cmpIn1 != "" && *cmpIn2 != "" && *cmpOut != "" {
-		if err := mergePng(*cmpIn1, *cmpIn2, *cmpOut); err != nil {
-			fmt.Printf("failed mergePng: %s", err)
+	if *themePath != "" {
+		if err := loadChartTheme(*themePath); err != nil {
+			fmt.Printf("failed to load theme: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *cmpOut != "" && (*cmpRuns != "" || (*cmpIn1 != "" && *cmpIn2 != "")) {
+		runs := parseCmpRuns(strings.Split(*cmpRuns, ","))
+		if *cmpRuns == "" {
+			runs = parseCmpRuns([]string{*cmpIn1, *cmpIn2})
+		}
+		if err := mergePng(runs, *cmpOut, *cmpColumns, *cmpCombined); err != nil {
+			fmt.Printf("failed mergePng: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *symbolsImport != "" || *symbolsFetch || *symbolsValidate {
+		if err := symbolsRunCommands(); err != nil {
+			fmt.Printf("failed symbols: %s\n", err)
+			os.Exit(1)
 		}
 		return
 	}
@@ -139,52 +222,103 @@ func main() {
 		return
 	}
 
-	err = generateChartsForPerformanceCsv(files)
+	// Data quality report lists issues found before failure too
+	reportsFailed := generateReports(files)
+	err = generateDataQualityReport()
+	if err != nil {
+		fmt.Printf("generateDataQualityReport:\n%v\n", err)
+		os.Exit(1)
+	}
+	if reportsFailed {
+		os.Exit(1)
+	}
+}
+
+// Returns true if charts or reports failed, the rest are not generated after failure
+// except for AMDuProf hotspots which other reports do not depend on
+func generateReports(files []os.FileInfo) bool {
+	reportsFailed := false
+
+	err := generateChartsForPerformanceCsv(files)
 	if err != nil {
 		fmt.Printf("generateChartsForPerformanceCsv err %v\n", err)
-		return
+		return true
 	}
 
 	err = generateChartsForIntelPowerLogFiles(files)
 	if err != nil {
 		fmt.Printf("generateChartsForIntelPowerLogFiles err %v\n", err)
-		return
+		return true
 	}
 
 	err = generateChartsForYandexBenchmarkFiles(files)
 	if err != nil {
 		fmt.Printf("generateChartsForYandexBenchmarkFiles err %v\n", err)
-		return
+		return true
+	}
+
+	err = generateChartsForBenchmarkSuiteFiles(files)
+	if err != nil {
+		fmt.Printf("generateChartsForBenchmarkSuiteFiles err %v\n", err)
+		return true
 	}
 
 	err = generateChartsForSrumFiles(files)
 	if err != nil {
 		fmt.Printf("generateChartsForSrumFiles err %v\n", err)
-		return
+		return true
 	}
 
 	err = generateChartsForProcmonFiles(files)
 	if err != nil {
 		fmt.Printf("generateChartsForProcmonFiles err %v\n", err)
-		return
+		return true
 	}
 
 	err = generateChartsForIppetFiles(files)
 	if err != nil {
 		fmt.Printf("generateChartsForIppetFiles err %v\n", err)
-		return
+		return true
+	}
+
+	err = generateChartsForRaplFiles(files)
+	if err != nil {
+		fmt.Printf("generateChartsForRaplFiles err %v\n", err)
+		return true
+	}
+
+	err = generateChartsForProcfsFiles(files)
+	if err != nil {
+		fmt.Printf("generateChartsForProcfsFiles err %v\n", err)
+		return true
+	}
+
+	err = generateChartsForChromeTraceFiles(files)
+	if err != nil {
+		fmt.Printf("generateChartsForChromeTraceFiles err %v\n", err)
+		return true
 	}
 
 	if _, err := os.Stat(filepath.Join(*csvPath, socWatch)); err == nil {
 		files, err = ioutil.ReadDir(filepath.Join(*csvPath, socWatch))
 		if err != nil {
 			fmt.Printf("readdir %s: %v\n", filepath.Join(*csvPath, socWatch), err)
-			return
+			return true
 		}
 		err = generateChartsForSocWatchFiles(files)
 		if err != nil {
 			fmt.Printf("generateChartsForSocWatchFiles:\n%v\n", err)
-			return
+			return true
+		}
+		violations, err := generateTimerResolutionReport(files)
+		if err != nil {
+			fmt.Printf("generateTimerResolutionReport:\n%v\n", err)
+			return true
+		}
+		if len(violations) > 0 {
+			// Other reports are generated for run which exceeded thresholds
+			fmt.Printf("timer resolution thresholds exceeded or not checked:\n%s\n", strings.Join(violations, "\n"))
+			reportsFailed = true
 		}
 	}
 
@@ -192,14 +326,38 @@ func main() {
 		files, err = ioutil.ReadDir(filepath.Join(*csvPath, amdProfCli))
 		if err != nil {
 			fmt.Printf("readdir %s: %v\n", filepath.Join(*csvPath, amdProfCli), err)
-			return
+			return true
 		}
 		err = generateChartsForAmdProfCliFiles(files)
 		if err != nil {
 			fmt.Printf("generateChartsForAmdProfCliFiles:\n%v\n", err)
-			return
+			return true
+		}
+		err = generateAmdProfCliHotspotsReport(files)
+		if err != nil {
+			// Scenario, score and data quality reports do not depend on hotspots
+			fmt.Printf("generateAmdProfCliHotspotsReport:\n%v\n", err)
+			reportsFailed = true
+		}
+	}
+
+	if *scenarioReportEnabled {
+		err = generateScenarioReport()
+		if err != nil {
+			fmt.Printf("generateScenarioReport err %v\n", err)
+			return true
+		}
+	}
+
+	if *scoreConfigPath != "" {
+		err = generateScoreReport()
+		if err != nil {
+			fmt.Printf("generateScoreReport err %v\n", err)
+			return true
 		}
 	}
+
+	return reportsFailed
 }
 
 func generalGetFileMeta(csvFilePath string) (Measure, error) {
@@ -239,18 +397,13 @@ func generateChartsForPerformanceCsv(files []os.FileInfo) error {
 }
 
 func processCsvFile(csvFilePath string) error {
-	csvFile, err := os.OpenFile(csvFilePath, os.O_RDONLY, 0666)
+	measures, err := performanceCsvGetMeasures(csvFilePath)
 	if err != nil {
-		return fmt.Errorf("Open CSV file %s err %v\n", csvFilePath, err)
+		fmt.Printf("performanceCsvGetMeasures %s\n", err)
+		return err
 	}
 
-	records, err := getRecordsFromCsvFile(csvFile, ',')
-	if err != nil {
-		fmt.Printf("getRecordsFromCsvFile %s err %v\n", csvFilePath, err)
-		return fmt.Errorf("getRecordsFromCsvFile %s err %v\n", csvFilePath, err)
-	}
-
-	chartBars := getChartBarsFromRawResults(groupCsvRecordsByMeasureSet(records), 2)
+	chartBars := getChartBarsFromRawResults(groupMeasuresBySet(measures), 2)
 
 	for measureSet, barValues := range chartBars {
 		err := drawBars(measureSet, barValues)
@@ -259,7 +412,7 @@ func processCsvFile(csvFilePath string) error {
 		}
 	}
 
-	groupedBars := getIterationsBarsFromGroupedMeasures(groupCsvRecordsByIteration(records), 2)
+	groupedBars := getIterationsBarsFromGroupedMeasures(groupMeasuresByIterations(measures), 2)
 	for measureSet, barValues := range groupedBars {
 		err := drawBars(measureSet, barValues)
 		if err != nil {
@@ -276,7 +429,10 @@ func getChartBarsFromRawResults(raw map[string]map[string][]float64, precision i
 		for browserName, resultList := range setResults {
 			barValue := median(resultList)
 			value := chart.Value{
-				Label: fmt.Sprintf("%s (%s)", browserName, big.NewFloat(barValue).Text('f', precision)),
+				Label: theme.label("bar", map[string]string{
+					"Browser": browserName,
+					"Value":   big.NewFloat(barValue).Text('f', precision),
+				}),
 				Value: barValue,
 				Style: chart.Style{
 					Show:        true,
@@ -375,14 +531,13 @@ func getDiffBars(setName string, bars []chart.Value, precision int) []chart.Valu
 			}
 		}
 
-		diffBar.Label = fmt.Sprintf(
-			"%s vs %s (%s) diff %.0f%% (%s)",
-			diffKind,
-			competitorProcessName,
-			diffKindExplain,
-			diffBarValue*100/competitorBar.Value*diffKindSign,
-			big.NewFloat(diffBar.Value).Text('f', precision),
-		)
+		diffBar.Label = theme.label("diff", map[string]string{
+			"Kind":       diffKind,
+			"Competitor": competitorProcessName,
+			"Explain":    diffKindExplain,
+			"Percent":    fmt.Sprintf("%.0f", diffBarValue*100/competitorBar.Value*diffKindSign),
+			"Value":      big.NewFloat(diffBar.Value).Text('f', precision),
+		})
 		diffBar.Style.FillColor = diffBarColor[diffKind]
 		diffBar.Style.StrokeColor = diffBarStrokeColor[diffKind]
 		diffBars = append(diffBars, diffBar)
@@ -397,7 +552,11 @@ func getIterationsBarsFromGroupedMeasures(raw map[string]map[string][]Measure, p
 		for iteration, measures := range setResults {
 			for _, measure := range measures {
 				value := chart.Value{
-					Label: fmt.Sprintf("%s: %s (%s) ", iteration, measure.browser, big.NewFloat(measure.value).Text('f', precision)),
+					Label: theme.label("iteration", map[string]string{
+						"Iteration": iteration,
+						"Browser":   measure.browser,
+						"Value":     big.NewFloat(measure.value).Text('f', precision),
+					}),
 					Value: measure.value,
 					Style: chart.Style{
 						Show:        true,
@@ -421,77 +580,6 @@ func getIterationsBarsFromGroupedMeasures(raw map[string]map[string][]Measure, p
 	return chartBars
 }
 
-func groupCsvRecordsByIteration(records [][]string) map[string]map[string][]Measure {
-	//fmt.Printf("records: %#v\n", records)
-
-	browserResults := map[string]map[string][]Measure{}
-
-	// "gpuUsage GPU time  (us)" > 0 > [Measure0, Measure1]
-	for _, row := range records {
-		for browserName := range processNames {
-			if strings.Contains(row[csvColIdMeasure], browserName) {
-				iteration := row[csvColIdIteration]
-				measureName := row[csvColIdMeasure]
-				fullSetName := getMeasureSetFullName(
-					row[csvColIdMeasureSet], browserName, measureName, row[csvColIdTest]) + " by iterations"
-
-				if browserResults[fullSetName] == nil {
-					browserResults[fullSetName] = make(map[string][]Measure)
-				}
-				measureValue, err := strconv.ParseFloat(strings.Replace(row[csvColIdResult], ",", ".", 1), 64)
-				if err != nil {
-					fmt.Printf("ParseFloat(%s) err %s\n", row[csvColIdResult], err)
-					continue
-				}
-
-				m := Measure{
-					iteration:   iteration,
-					measureSet:  fullSetName,
-					measureName: measureName,
-					browser:     browserName,
-					value:       measureValue,
-				}
-				browserResults[fullSetName][iteration] = append(browserResults[fullSetName][iteration], m)
-			}
-		}
-	}
-
-	//fmt.Printf("Results: %#v\n", browserResults)
-	return browserResults
-}
-
-func groupCsvRecordsByMeasureSet(records [][]string) map[string]map[string][]float64 {
-	//fmt.Printf("records: %#v\n", records)
-
-	browserResults := map[string]map[string][]float64{}
-
-	// "gpuUsage GPU time  (us)" > "browser.exe" : [1.23, 3.45, 5,67]
-	//                           > "chrome.exe"  : [1.23, 3.45, 5,67]
-	for _, row := range records {
-		for browserName := range processNames {
-			if strings.Contains(row[csvColIdMeasure], browserName) {
-				fullSetName := getMeasureSetFullName(
-					row[csvColIdMeasureSet], browserName, row[csvColIdMeasure], row[csvColIdTest],
-				)
-
-				if browserResults[fullSetName] == nil {
-					browserResults[fullSetName] = make(map[string][]float64)
-				}
-				measureResultFloat64, err := strconv.ParseFloat(strings.Replace(row[csvColIdResult], ",", ".", 1), 64)
-				if err != nil {
-					fmt.Printf("ParseFloat(%s) err %s\n", row[csvColIdResult], err)
-					continue
-				}
-
-				browserResults[fullSetName][browserName] = append(browserResults[fullSetName][browserName], measureResultFloat64)
-			}
-		}
-	}
-
-	//fmt.Printf("Results: %#v\n", browserResults)
-	return browserResults
-}
-
 func groupMeasuresBySet(measures []Measure) map[string]map[string][]float64 {
 	browserResults := map[string]map[string][]float64{}
 	for _, m := range measures {
@@ -499,6 +587,11 @@ func groupMeasuresBySet(measures []Measure) map[string]map[string][]float64 {
 		fullSetName := getMeasureSetFullName(
 			m.measureSet, browserProcessName, m.measureName, m.scenarioName,
 		)
+		if !scenarioMeasureSelected(m, fullSetName) {
+			continue
+		}
+		scenarioReportAddMeasure(fullSetName, m)
+		dataQualityAddMeasure(fullSetName, m)
 
 		if browserResults[fullSetName] == nil {
 			browserResults[fullSetName] = make(map[string][]float64)
@@ -551,24 +644,30 @@ type barDrawer func(*os.File, string, []chart.Value)
 // measureSet like "CPU  Utilization %" or "GPU Time  (us)"
 func drawBars(measureSet string, chartBars []chart.Value) error {
 	drawers := map[string]barDrawer{
-		srumMeasureSet:                drawBarGpuTime,
-		yandexBenchmark:               drawBarGpuTime,
-		intelPowerMeasureSet:          drawBarGpuTime,
-		socWatch:                      drawBarGpuTime,
-		amdProfCli:                    drawBarGpuTime,
-		"ippet":                       drawBarGpuTime,
-		"diskIo Disk IO Time":         drawBarGpuTime,
-		"diskIo Disk IO Size":         drawBarGpuTime,
-		"diskIo Disk Service Time":    drawBarGpuTime,
-		"fileIo File IO Duration":     drawBarGpuTime,
-		"fileIo File IO Size":         drawBarGpuTime,
-		"memSet WorkingSet":           drawBarGpuTime,
-		"memSet PrivateWorkingSet":    drawBarGpuTime,
-		"memSet VirtualSize":          drawBarGpuTime,
-		"gpuUsage GPU Time":           drawBarGpuTime,
-		"gpuUsage GPU Packets":        drawBarGpuTime,
-		"gpuUsage GPU Percentage":     drawBarCpuPercentage,
-		"cpuUsage CPU  Utilization %": drawBarCpuPercentage,
+		srumMeasureSet:             drawBarGpuTime,
+		yandexBenchmark:            drawBarGpuTime,
+		intelPowerMeasureSet:       drawBarGpuTime,
+		socWatch:                   drawBarGpuTime,
+		amdProfCli:                 drawBarGpuTime,
+		procmonMeasureSet:          drawBarGpuTime,
+		raplMeasureSet:             drawBarGpuTime,
+		procfsMeasureSet:           drawBarGpuTime,
+		perfMeasureSet:             drawBarGpuTime,
+		chromeTraceMeasureSet:      drawBarGpuTime,
+		benchmarkMeasureSet:        drawBarGpuTime,
+		"ippet":                    drawBarGpuTime,
+		"diskIo Disk IO Time":      drawBarGpuTime,
+		"diskIo Disk IO Size":      drawBarGpuTime,
+		"diskIo Disk Service Time": drawBarGpuTime,
+		"fileIo File IO Duration":  drawBarGpuTime,
+		"fileIo File IO Size":      drawBarGpuTime,
+		"memSet WorkingSet":        drawBarGpuTime,
+		"memSet PrivateWorkingSet": drawBarGpuTime,
+		"memSet VirtualSize":       drawBarGpuTime,
+		"gpuUsage GPU Time":        drawBarGpuTime,
+		"gpuUsage GPU Packets":     drawBarGpuTime,
+		gpuPercentageMeasureSet:    drawBarCpuPercentage,
+		cpuUtilizationMeasureSet:   drawBarCpuPercentage,
 	}
 
 	for drawerId, drawerFunc := range drawers {
@@ -582,12 +681,31 @@ func drawBars(measureSet string, chartBars []chart.Value) error {
 			}
 			//fmt.Printf("Bars: \n%#v\n", chartBars)
 			drawerFunc(pngFile, measureSet, chartBars)
+			err = ioClose(pngFile.Name(), pngFile)
+			if err != nil {
+				return err
+			}
+			err = serializeChartBars(measureSet, chartBars)
+			if err != nil {
+				return err
+			}
+			scenarioReportAddChart(measureSet)
 		}
 	}
 
 	return nil
 }
 
+// Y-axis policy of drawer of measure set, charts redrawn from chart data keep axis of original ones
+func defaultAxisPolicy(measureSet string) string {
+	for _, prefix := range []string{gpuPercentageMeasureSet, cpuUtilizationMeasureSet} {
+		if strings.HasPrefix(measureSet, prefix) {
+			return axisPercent
+		}
+	}
+	return axisZero
+}
+
 type chartValueSortByBrowser []chart.Value
 
 func (s chartValueSortByBrowser) Len() int {
@@ -601,19 +719,33 @@ func (s chartValueSortByBrowser) Less(i, j int) bool {
 }
 
 func drawBarGpuTime(fileWriter *os.File, measureSet string, chartBars []chart.Value) {
-	barWidth := 60
-	chartWidth := 1024
-	fontSize := 10.0
-	if len(chartBars) > 9 {
-		barWidth = 40
-		chartWidth += (len(chartBars) - 9) * 100
-		fontSize = 8.0
-	}
-
-	max := 0.0
-	for _, bar := range chartBars {
-		if bar.Value > max {
-			max = bar.Value
+	title := theme.label("title", map[string]string{
+		"MeasureSet": measureSet,
+		"Date":       chartDate.Format("2006-01-02 15:04:05"),
+	})
+	err := renderBarChart(fileWriter, measureSet, title, chartBars, axisZero, 0)
+	if err != nil {
+		fmt.Printf("Error rendering chart: %v\n", err)
+	}
+}
+
+// Axis policy of theme is used instead of default policy if set, max is upper bound of y-axis,
+// 0 for max bar
+func renderBarChart(w io.Writer, measureSet, title string, chartBars []chart.Value, defaultPolicy string, max float64) error {
+	barWidth := theme.BarWidth
+	chartWidth := theme.Width
+	fontSize := theme.FontSize
+	if len(chartBars) > theme.DenseBars {
+		barWidth = theme.DenseBarWidth
+		chartWidth += (len(chartBars) - theme.DenseBars) * theme.DenseExtraWidth
+		fontSize = theme.DenseFontSize
+	}
+
+	if max == 0 {
+		for _, bar := range chartBars {
+			if bar.Value > max {
+				max = bar.Value
+			}
 		}
 	}
 
@@ -623,66 +755,47 @@ func drawBarGpuTime(fileWriter *os.File, measureSet string, chartBars []chart.Va
 				Top: 40,
 			},
 		},
-		Title:      fmt.Sprintf("%s %s", measureSet, chartDate.Format("2006-01-02 15:04:05")),
+		Title:      strings.TrimSpace(title),
 		TitleStyle: chart.StyleShow(),
 		Width:      chartWidth,
-		//Height:   512,
-		BarWidth: barWidth,
+		Height:     theme.Height,
+		Font:       theme.font,
+		BarWidth:   barWidth,
 		XAxis: chart.Style{
 			Show:     true,
 			FontSize: fontSize,
 		},
-		YAxis: chart.YAxis{
-			Style: chart.Style{
-				Show: true,
-			},
-			Range: &chart.ContinuousRange{
-				Min: 0,
-				Max: max,
-			},
-		},
-		Bars: chartBars,
+		YAxis: theme.yAxis(theme.axisPolicy(measureSet, defaultPolicy), chartBars, max),
+		Bars:  chartBars,
 	}
 
-	err := sbc.Render(chart.PNG, fileWriter)
-	if err != nil {
-		fmt.Printf("Error rendering chart: %v\n", err)
-	}
+	return sbc.Render(chart.PNG, w)
 }
 
-func drawBarCpuPercentage(fileWriter *os.File, measureSet string, chartBars []chart.Value) {
-	barWidth := 60
-	chartWidth := 1024
-	fontSize := 10.0
-	if len(chartBars) > 9 {
-		barWidth = 40
-		chartWidth += (len(chartBars) - 9) * 100
-		fontSize = 8.0
+// Groups of bars are separated by empty bar
+func drawBarGrouped(w io.Writer, measureSet, title string, groups [][]chart.Value, max float64) error {
+	var chartBars []chart.Value
+	for i, group := range groups {
+		if i > 0 {
+			chartBars = append(chartBars, chart.Value{
+				Style: chart.Style{
+					FillColor:   drawing.ColorWhite,
+					StrokeColor: drawing.ColorWhite,
+				},
+			})
+		}
+		chartBars = append(chartBars, group...)
 	}
 
-	sbc := chart.BarChart{
-		Title:      measureSet,
-		TitleStyle: chart.StyleShow(),
-		Width:      chartWidth,
-		//Height:   512,
-		BarWidth: barWidth,
-		XAxis: chart.Style{
-			Show:     true,
-			FontSize: fontSize,
-		},
-		YAxis: chart.YAxis{
-			Style: chart.Style{
-				Show: true,
-			},
-			Range: &chart.ContinuousRange{
-				Min: 0,
-				Max: 100,
-			},
-		},
-		Bars: chartBars,
-	}
+	return renderBarChart(w, measureSet, title, chartBars, defaultAxisPolicy(measureSet), max)
+}
 
-	err := sbc.Render(chart.PNG, fileWriter)
+func drawBarCpuPercentage(fileWriter *os.File, measureSet string, chartBars []chart.Value) {
+	title := theme.label("title", map[string]string{
+		"MeasureSet": measureSet,
+		"Date":       "",
+	})
+	err := renderBarChart(fileWriter, measureSet, title, chartBars, axisPercent, 0)
 	if err != nil {
 		fmt.Printf("Error rendering chart: %v\n", err)
 	}
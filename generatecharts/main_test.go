@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDefaultAxisPolicy(t *testing.T) {
+	tests := []struct {
+		measureSet string
+		expected   string
+	}{
+		{"cpuUsage CPU  Utilization % youtube", axisPercent},
+		{"gpuUsage GPU Percentage youtube", axisPercent},
+		{"gpuUsage GPU Time (us) youtube", axisZero},
+		{"rapl package-0 Energy (Joules) youtube", axisZero},
+	}
+
+	for _, test := range tests {
+		if got := defaultAxisPolicy(test.measureSet); got != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.measureSet, got, test.expected)
+		}
+	}
+}
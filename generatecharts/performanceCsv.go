@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Logical columns of PerformanceResults_*.csv
+const (
+	perfCsvColScenario   = "Scenario"
+	perfCsvColIteration  = "Iteration"
+	perfCsvColBrowser    = "Browser"
+	perfCsvColMeasureSet = "MeasureSet"
+	perfCsvColMeasure    = "Measure"
+	perfCsvColResult     = "Result"
+)
+
+// Header of PerfProcessor output version, the first matched schema is used
+type performanceCsvSchema struct {
+	version string
+	columns []string
+}
+
+var performanceCsvSchemas = []performanceCsvSchema{
+	// PerfProcessor FormatResults, process is part of measure name like "CPU chrome.exe Utilization %"
+	// or measure is browser wide like "Energy (mWh)"
+	{version: "1", columns: []string{"EtlFileName", perfCsvColScenario, perfCsvColIteration, perfCsvColBrowser, "DateStamp", "TimeStamp", perfCsvColMeasureSet, perfCsvColMeasure, perfCsvColResult}},
+}
+
+// Files without header row have version 1 columns order
+var performanceCsvLegacyColumns = map[string]int{
+	perfCsvColScenario:   csvColIdTest,
+	perfCsvColIteration:  csvColIdIteration,
+	perfCsvColBrowser:    csvColIdBrowser,
+	perfCsvColMeasureSet: csvColIdMeasureSet,
+	perfCsvColMeasure:    csvColIdMeasure,
+	perfCsvColResult:     csvColIdResult,
+}
+
+func performanceCsvGetMeasures(csvFilePath string) ([]Measure, error) {
+	msrs := []Measure{}
+
+	csvFile, err := os.Open(csvFilePath)
+	if err != nil {
+		return msrs, err
+	}
+	defer csvFile.Close()
+
+	r := csv.NewReader(csvFile)
+	r.FieldsPerRecord = -1 // Responsiveness rows are appended by test harness
+	records, err := r.ReadAll()
+	if err != nil {
+		return msrs, fmt.Errorf("%s: %v", csvFilePath, err)
+	}
+	if len(records) == 0 {
+		return msrs, nil
+	}
+
+	cols, version := performanceCsvGetColumns(records[0])
+	firstRow := 1
+	if version == "" {
+		cols = performanceCsvLegacyColumns
+		firstRow = 0
+	}
+
+	for i := firstRow; i < len(records); i++ {
+		row := records[i]
+		if len(row) <= cols[perfCsvColResult] {
+			dataQualityAdd(dataQualityUnparseable, csvFilePath, Measure{}, "row %d has %d columns, expected %d", i+1, len(row), cols[perfCsvColResult]+1)
+			continue
+		}
+
+		measureName := strings.TrimSpace(row[cols[perfCsvColMeasure]])
+		processName := performanceCsvGetMeasureProcess(measureName)
+		if processName == "" {
+			// Browser wide metric, "chrome|AdBlock 3.1" when extensions are enabled
+			browser := strings.SplitN(row[cols[perfCsvColBrowser]], "|", 2)[0]
+			processName = browserNameToProcessName[strings.TrimSpace(browser)]
+		}
+		if !processNames[processName] {
+			continue
+		}
+
+		m := Measure{
+			iteration:    strings.TrimSpace(row[cols[perfCsvColIteration]]),
+			measureSet:   strings.TrimSpace(row[cols[perfCsvColMeasureSet]]),
+			measureName:  measureName,
+			scenarioName: strings.TrimSpace(row[cols[perfCsvColScenario]]),
+			browser:      processName,
+		}
+		m.value, err = parseLocaleFloat(row[cols[perfCsvColResult]])
+		if err != nil {
+			dataQualityAdd(dataQualityUnparseable, csvFilePath, m, "row %d column %s: %v", i+1, perfCsvColResult, err)
+			continue
+		}
+
+		msrs = append(msrs, m)
+	}
+
+	return msrs, nil
+}
+
+// Returns column ids by logical names and schema version, empty version if row is not a known header
+func performanceCsvGetColumns(header []string) (map[string]int, string) {
+	titles := map[string]int{}
+	for colId, colTitle := range header {
+		titles[strings.TrimSpace(colTitle)] = colId
+	}
+
+	for _, schema := range performanceCsvSchemas {
+		cols := map[string]int{}
+		for _, colTitle := range schema.columns {
+			colId, found := titles[colTitle]
+			if !found {
+				break
+			}
+			cols[colTitle] = colId
+		}
+		if len(cols) == len(schema.columns) {
+			return cols, schema.version
+		}
+	}
+
+	return nil, ""
+}
+
+// Returns process name which is a whole word of measure name, so "chrome.exe" is not found
+// in "notchrome.exe" and "CPU dwm.exe Utilization %" is not a browser measure
+func performanceCsvGetMeasureProcess(measureName string) string {
+	words := strings.FieldsFunc(measureName, func(r rune) bool {
+		return r == ' ' || r == '|' || r == '(' || r == ')' || r == ':' || r == ','
+	})
+	for _, word := range words {
+		if processNames[word] || strings.HasSuffix(strings.ToLower(word), ".exe") {
+			return word
+		}
+	}
+	return ""
+}
+
+// Parses numbers written with invariant or current culture of test machine:
+// "1234.5", "1,234.5", "1234,5", "1 234,5", "1.234,5", "1'234.5".
+// Single comma is decimal separator, PerfProcessor writes decimals of ru-RU culture like "0,017505".
+func parseLocaleFloat(s string) (float64, error) {
+	s = strings.Trim(s, "\" ")
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "'", "").Replace(s)
+
+	lastComma := strings.LastIndex(s, ",")
+	lastDot := strings.LastIndex(s, ".")
+	switch {
+	case lastComma >= 0 && lastDot >= 0:
+		// The last separator is decimal one
+		if lastComma > lastDot {
+			s = strings.Replace(strings.Replace(s, ".", "", -1), ",", ".", 1)
+		} else {
+			s = strings.Replace(s, ",", "", -1)
+		}
+	case strings.Count(s, ",") > 1:
+		s = strings.Replace(s, ",", "", -1)
+	case lastComma >= 0:
+		s = strings.Replace(s, ",", ".", 1)
+	case strings.Count(s, ".") > 1:
+		s = strings.Replace(s, ".", "", -1)
+	}
+
+	val, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a number '%s'", s)
+	}
+	return val, nil
+}
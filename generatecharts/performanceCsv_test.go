@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPerformanceCsvGetMeasures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "performanceCsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]float64 // browser measure > value
+		issues   int
+	}{
+		{
+			name: "version 1 with process in measure or browser column",
+			content: "EtlFileName,Scenario,Iteration,Browser,DateStamp,TimeStamp,MeasureSet,Measure,Result\n" +
+				"a.etl,youtube,0,chrome,20180120,224843,cpuUsage,CPU chrome.exe Utilization %,0.5\n" +
+				"a.etl,youtube,0,chrome,20180120,224843,cpuUsage,CPU notchrome.exe Utilization %,1.5\n" +
+				"a.etl,youtube,0,chrome,20180120,224843,cpuUsage,CPU dwm.exe Utilization %,2.5\n" +
+				"a.etl,youtube,0,chrome|AdBlock 3.1,20180120,224843,energy,Energy (mWh),\"1 234,5\"\n" +
+				"a.etl,youtube,0,chrome,20180120,224843,cpuUsage,CPU browser.exe Utilization %,2.5\n" +
+				"a.etl,youtube,0,chrome,20180120,224843,gpuUsage,GPU time (us),n/a\n" +
+				"a.etl,youtube,0,chrome,20180120,224843,cpuUsage\n",
+			expected: map[string]float64{
+				"chrome.exe CPU chrome.exe Utilization %":   0.5,
+				"chrome.exe Energy (mWh)":                   1234.5,
+				"browser.exe CPU browser.exe Utilization %": 2.5,
+			},
+			issues: 2,
+		},
+		{
+			name: "legacy without header",
+			content: "a.etl,youtube,0,chrome,20180120,224843,cpuUsage,CPU chrome.exe Utilization %,0.5\n" +
+				"a.etl,youtube,1,chrome,20180120,224843,cpuUsage,CPU dwm.exe Utilization %,1.5\n" +
+				"a.etl,youtube,0,chrome,20180120,224843,energy,Energy (mWh),3.5\n",
+			expected: map[string]float64{
+				"chrome.exe CPU chrome.exe Utilization %": 0.5,
+				"chrome.exe Energy (mWh)":                 3.5,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			csvFilePath := filepath.Join(dir, "PerformanceResults_0000_0000.csv")
+			err := ioutil.WriteFile(csvFilePath, []byte(test.content), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldIssues := dataQualityIssues
+			defer func() { dataQualityIssues = oldIssues }()
+
+			measures, err := performanceCsvGetMeasures(csvFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]float64{}
+			for _, m := range measures {
+				got[m.browser+" "+m.measureName] = m.value
+				if m.scenarioName != "youtube" || m.iteration != "0" {
+					t.Errorf("%s: got meta %v", m.measureName, m)
+				}
+			}
+			if len(got) != len(test.expected) {
+				t.Errorf("got %v, expected %v", got, test.expected)
+			}
+			for name, value := range test.expected {
+				if got[name] != value {
+					t.Errorf("%s: got %v, expected %v", name, got[name], value)
+				}
+			}
+			if issues := len(dataQualityIssues) - len(oldIssues); issues != test.issues {
+				t.Errorf("got %d data quality issues, expected %d: %v", issues, test.issues, dataQualityIssues[len(oldIssues):])
+			}
+		})
+	}
+}
+
+func TestParseLocaleFloat(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected float64
+		err      bool
+	}{
+		{s: "1234.5", expected: 1234.5},
+		{s: "1,234.5", expected: 1234.5},
+		{s: "1234,5", expected: 1234.5},
+		{s: "0,017505", expected: 0.017505},
+		{s: "1 234,5", expected: 1234.5},
+		{s: "1\u00a0234,5", expected: 1234.5},
+		{s: "1\u202f234,5", expected: 1234.5},
+		{s: "1.234,5", expected: 1234.5},
+		{s: "1'234.5", expected: 1234.5},
+		{s: "1,234,567", expected: 1234567},
+		{s: "1.234.567", expected: 1234567},
+		{s: "1.234.567,89", expected: 1234567.89},
+		{s: "\" -12,5 \"", expected: -12.5},
+		{s: "1e3", expected: 1000},
+		{s: "", err: true},
+		{s: "n/a", err: true},
+		{s: "1,2.3,4", err: true},
+	}
+
+	for _, test := range tests {
+		val, err := parseLocaleFloat(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: no error, got %v", test.s, val)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		if val != test.expected {
+			t.Errorf("%q: got %v, expected %v", test.s, val, test.expected)
+		}
+	}
+}
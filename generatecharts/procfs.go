@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Linux per-process CPU, memory and I/O of browser process family:
+// samples of /proc/<pid>/{stat,status,io} recorded by procrecorder
+// or "perf stat -x, -o <file>" output
+const (
+	procfsMeasureSet  = "procfs"
+	perfMeasureSet    = "perf"
+	procfsColTime     = "timestamp"
+	procfsColPid      = "pid"
+	procfsColUtime    = "utime_ms"
+	procfsColStime    = "stime_ms"
+	procfsColVolCtx   = "voluntary_ctxt_switches"
+	procfsColInvolCtx = "nonvoluntary_ctxt_switches"
+	procfsColRss      = "rss_kb"
+	procfsColRead     = "read_bytes"
+	procfsColWrite    = "write_bytes"
+)
+
+// Cumulative counters of process, delta between first and last sample is measured
+var procfsCounters = map[string]string{
+	procfsColUtime:    "CPU User Time (ms)",
+	procfsColStime:    "CPU System Time (ms)",
+	procfsColVolCtx:   "Voluntary Context Switches",
+	procfsColInvolCtx: "Involuntary Context Switches",
+	procfsColRead:     "Read Bytes",
+	procfsColWrite:    "Write Bytes",
+}
+
+// perf stat event > measure name
+var perfEvents = map[string]string{
+	"task-clock":          "CPU Time (ms)",
+	"cpu-clock":           "CPU Time (ms)",
+	"context-switches":    "Context Switches",
+	"cs":                  "Context Switches",
+	"cpu-migrations":      "CPU Migrations",
+	"page-faults":         "Page Faults",
+	"sched:sched_wakeup":  "Wakeups",
+	"power:cpu_idle":      "CPU Idle Events",
+	"cycles":              "Cycles",
+	"instructions":        "Instructions",
+	"syscalls:sys_enter_": "Syscalls",
+}
+
+// Alias events count the same as their primary events, alias is dropped if both are recorded
+var perfEventAliases = map[string]string{
+	"cpu-clock": "task-clock",
+	"cs":        "context-switches",
+}
+
+type procfsProcess struct {
+	first     map[string]float64
+	last      map[string]float64
+	firstSeen time.Time
+}
+
+func generateChartsForProcfsFiles(files []os.FileInfo) error {
+	measures := []Measure{}
+
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".csv" {
+			continue
+		}
+
+		var m []Measure
+		var err error
+		switch {
+		case strings.Contains(f.Name(), "_"+procfsMeasureSet+"_"):
+			m, err = procfsGetMeasures(filepath.Join(*csvPath, f.Name()))
+		case strings.Contains(f.Name(), "_"+perfMeasureSet+"_"):
+			m, err = perfGetMeasures(filepath.Join(*csvPath, f.Name()))
+		default:
+			continue
+		}
+		if err != nil {
+			fmt.Printf("procfs %s err %v", f.Name(), err)
+			return err
+		}
+		measures = append(measures, m...)
+	}
+
+	chartBars := getChartBarsFromRawResults(groupMeasuresBySet(measures), 2)
+
+	for measureSet, barValues := range chartBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	groupedBars := getIterationsBarsFromGroupedMeasures(groupMeasuresByIterations(measures), 2)
+	for measureSet, barValues := range groupedBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// File like chrome_yandexstaticfavicon_0_procfs_20180120_224843.csv:
+//
+//	timestamp,pid,comm,utime_ms,stime_ms,voluntary_ctxt_switches,nonvoluntary_ctxt_switches,rss_kb,read_bytes,write_bytes
+//	2018-01-20T22:48:43.123456789Z,4242,chrome,1520,310,2048,51,183420,1048576,4096
+func procfsGetMeasures(csvFilePath string) ([]Measure, error) {
+	msrs := []Measure{}
+
+	metaMeasure, err := generalGetFileMeta(csvFilePath)
+	if err != nil {
+		return msrs, err
+	}
+	metaMeasure.measureSet = procfsMeasureSet
+
+	csvFile, err := os.Open(csvFilePath)
+	if err != nil {
+		return msrs, err
+	}
+	defer csvFile.Close()
+
+	records, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		return msrs, fmt.Errorf("procfsGetMeasures: %s: %v", csvFilePath, err)
+	}
+	if len(records) < 2 {
+		return msrs, nil
+	}
+
+	cols := map[string]int{}
+	for colId, colTitle := range records[0] {
+		cols[strings.Trim(colTitle, " ")] = colId
+	}
+	for _, colTitle := range []string{procfsColTime, procfsColPid, procfsColRss} {
+		if _, found := cols[colTitle]; !found {
+			return msrs, fmt.Errorf("procfsGetMeasures: %s: column %s not found in header", csvFilePath, colTitle)
+		}
+	}
+
+	var recordingStart time.Time
+	processes := map[string]*procfsProcess{}
+	rssBySample := map[time.Time]float64{}
+	var sampleTimes []time.Time
+	for i, line := range records[1:] {
+		t, err := time.Parse(time.RFC3339Nano, line[cols[procfsColTime]])
+		if err != nil {
+			return msrs, fmt.Errorf("procfsGetMeasures: %s: row %d: %v", csvFilePath, i+2, err)
+		}
+		if recordingStart.IsZero() {
+			recordingStart = t
+		}
+
+		values := map[string]float64{}
+		for colTitle := range procfsCounters {
+			colId, found := cols[colTitle]
+			if !found {
+				continue
+			}
+			values[colTitle], err = strconv.ParseFloat(line[colId], 64)
+			if err != nil {
+				return msrs, fmt.Errorf("procfsGetMeasures: %s: row %d column %s: %v", csvFilePath, i+2, colTitle, err)
+			}
+		}
+		rss, err := strconv.ParseFloat(line[cols[procfsColRss]], 64)
+		if err != nil {
+			return msrs, fmt.Errorf("procfsGetMeasures: %s: row %d column %s: %v", csvFilePath, i+2, procfsColRss, err)
+		}
+		if _, found := rssBySample[t]; !found {
+			sampleTimes = append(sampleTimes, t)
+		}
+		rssBySample[t] += rss
+
+		pid := line[cols[procfsColPid]]
+		p, found := processes[pid]
+		if !found {
+			p = &procfsProcess{first: values, firstSeen: t}
+			processes[pid] = p
+		}
+		p.last = values
+	}
+
+	// Rows of one sample share timestamp of sample start
+	totals := map[string]float64{}
+	for _, p := range processes {
+		for colTitle, measureName := range procfsCounters {
+			if _, found := p.last[colTitle]; !found {
+				continue
+			}
+			// Process started during recording is counted from its start
+			if p.firstSeen.Equal(recordingStart) {
+				totals[measureName] += p.last[colTitle] - p.first[colTitle]
+			} else {
+				totals[measureName] += p.last[colTitle]
+			}
+		}
+	}
+	totals["CPU Time (ms)"] = totals[procfsCounters[procfsColUtime]] + totals[procfsCounters[procfsColStime]]
+	// Voluntary switch is a sleep, every sleep ends with a wakeup
+	totals["Wakeups"] = totals[procfsCounters[procfsColVolCtx]]
+	totals["Processes"] = float64(len(processes))
+
+	maxRss, sumRss := 0.0, 0.0
+	for _, t := range sampleTimes {
+		sumRss += rssBySample[t]
+		if rssBySample[t] > maxRss {
+			maxRss = rssBySample[t]
+		}
+	}
+	totals["Max RSS (MB)"] = maxRss / 1024
+	totals["Average RSS (MB)"] = sumRss / float64(len(sampleTimes)) / 1024
+
+	for measureName, val := range totals {
+		m := metaMeasure
+		m.measureName = measureName
+		m.value = val
+		msrs = append(msrs, m)
+	}
+
+	return msrs, nil
+}
+
+// File like chrome_yandexstaticfavicon_0_perf_20180120_224843.csv from
+// "perf stat -x, -e task-clock,context-switches,sched:sched_wakeup -p <browser pids>":
+//
+//	# started on Sat Jan 20 22:48:43 2018
+//	8743.21,msec,task-clock,8743210000,100.00,0.874,CPUs utilized
+//	12840,,context-switches,8743210000,100.00,0.001,M/sec
+//
+// Lines of "--per-thread" output start with thread "comm-tid" and are summed up.
+func perfGetMeasures(csvFilePath string) ([]Measure, error) {
+	msrs := []Measure{}
+
+	metaMeasure, err := generalGetFileMeta(csvFilePath)
+	if err != nil {
+		return msrs, err
+	}
+	metaMeasure.measureSet = perfMeasureSet
+
+	f, err := os.Open(csvFilePath)
+	if err != nil {
+		return msrs, err
+	}
+	defer f.Close()
+
+	events := map[string]float64{}
+	lineNumber := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) > 0 {
+			if _, err := strconv.ParseFloat(fields[0], 64); err != nil && !strings.HasPrefix(fields[0], "<") {
+				fields = fields[1:] // --per-thread
+			}
+		}
+		if len(fields) < 3 {
+			return msrs, fmt.Errorf("perfGetMeasures: %s: line %d: expected value,unit,event: '%s'", csvFilePath, lineNumber, line)
+		}
+		// "<not counted>" or "<not supported>"
+		if strings.HasPrefix(fields[0], "<") {
+			continue
+		}
+		val, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return msrs, fmt.Errorf("perfGetMeasures: %s: line %d: %v", csvFilePath, lineNumber, err)
+		}
+
+		event := fields[2]
+		// Modifiers like "cycles:u"
+		if idx := strings.LastIndex(event, ":"); idx > 0 && len(event)-idx <= 3 {
+			event = event[:idx]
+		}
+		events[event] += val
+	}
+	if err := scanner.Err(); err != nil {
+		return msrs, fmt.Errorf("perfGetMeasures: %s: %v", csvFilePath, err)
+	}
+
+	totals := map[string]float64{}
+	for event, val := range events {
+		if primary, isAlias := perfEventAliases[event]; isAlias {
+			if _, found := events[primary]; found {
+				continue
+			}
+		}
+		totals[perfGetMeasureName(event)] += val
+	}
+
+	for measureName, val := range totals {
+		m := metaMeasure
+		m.measureName = measureName
+		m.value = val
+		msrs = append(msrs, m)
+	}
+
+	return msrs, nil
+}
+
+func perfGetMeasureName(event string) string {
+	if measureName, found := perfEvents[event]; found {
+		return measureName
+	}
+	for prefix, measureName := range perfEvents {
+		if strings.HasSuffix(prefix, "_") && strings.HasPrefix(event, prefix) {
+			return measureName
+		}
+	}
+	// Tracepoints like "block:block_rq_issue" are not valid in PNG file names
+	return strings.Replace(event, ":", " ", -1)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func procfsTestGetMeasures(t *testing.T, fileName, content string, getMeasures func(string) ([]Measure, error)) (map[string]float64, error) {
+	dir, err := ioutil.TempDir("", "procfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	csvFilePath := filepath.Join(dir, fileName)
+	err = ioutil.WriteFile(csvFilePath, []byte(content), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	measures, err := getMeasures(csvFilePath)
+	got := map[string]float64{}
+	for _, m := range measures {
+		got[m.measureName] = m.value
+		if m.browser != chromeProcessName || m.scenarioName != "youtube" || m.iteration != "0" {
+			t.Errorf("%s: got meta %v", m.measureName, m)
+		}
+	}
+	return got, err
+}
+
+func TestProcfsGetMeasures(t *testing.T) {
+	// Process 4243 starts during recording and is counted from its start
+	content := "timestamp,pid,comm,utime_ms,stime_ms,voluntary_ctxt_switches,nonvoluntary_ctxt_switches,rss_kb,read_bytes,write_bytes\n" +
+		"2018-01-20T22:48:43Z,4242,chrome,1000,200,2000,50,102400,4096,0\n" +
+		"2018-01-20T22:48:44Z,4242,chrome,1500,300,2100,55,102400,8192,0\n" +
+		"2018-01-20T22:48:44Z,4243,chrome,100,20,10,1,204800,0,4096\n"
+
+	got, err := procfsTestGetMeasures(t, "chrome_youtube_0_procfs_20180120_224843.csv", content, procfsGetMeasures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]float64{
+		"CPU User Time (ms)":           600,
+		"CPU System Time (ms)":         120,
+		"CPU Time (ms)":                720,
+		"Voluntary Context Switches":   110,
+		"Involuntary Context Switches": 6,
+		"Wakeups":                      110,
+		"Read Bytes":                   4096,
+		"Write Bytes":                  4096,
+		"Processes":                    2,
+		"Max RSS (MB)":                 300,
+		"Average RSS (MB)":             200,
+	}
+	for name, value := range expected {
+		if got[name] != value {
+			t.Errorf("%s: got %v, expected %v", name, got[name], value)
+		}
+	}
+}
+
+func TestPerfGetMeasures(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]float64
+		err      bool
+	}{
+		{
+			name: "process",
+			content: "# started on Sat Jan 20 22:48:43 2018\n" +
+				"\n" +
+				"8743.21,msec,task-clock,8743210000,100.00,0.874,CPUs utilized\n" +
+				"12840,,context-switches,8743210000,100.00,0.001,M/sec\n" +
+				"<not counted>,,cpu-migrations,0,100.00,,\n" +
+				"<not supported>,,cycles,0,100.00,,\n" +
+				"523,,sched:sched_wakeup,8743210000,100.00,0.060,K/sec\n" +
+				"1200000,,instructions:u,8743210000,100.00,,\n" +
+				"30,,syscalls:sys_enter_read,8743210000,100.00,,\n" +
+				"12,,syscalls:sys_enter_write,8743210000,100.00,,\n" +
+				"5,,block:block_rq_issue,8743210000,100.00,,\n",
+			expected: map[string]float64{
+				"CPU Time (ms)":        8743.21,
+				"Context Switches":     12840,
+				"Wakeups":              523,
+				"Instructions":         1200000,
+				"Syscalls":             42,
+				"block block_rq_issue": 5,
+			},
+		},
+		{
+			name: "per thread",
+			content: "chrome-4242,100.5,msec,task-clock,100500000,100.00,0.100,CPUs utilized\n" +
+				"chrome-4250,200.25,msec,task-clock,200250000,100.00,0.200,CPUs utilized\n" +
+				"chrome-4242,<not counted>,,context-switches,0,100.00,,\n" +
+				"Chrome_IOThread-4251,7,,context-switches,200250000,100.00,,\n",
+			expected: map[string]float64{
+				"CPU Time (ms)":    300.75,
+				"Context Switches": 7,
+			},
+		},
+		{
+			name: "aliases are not added to primary events",
+			content: "8743.21,msec,task-clock,8743210000,100.00,0.874,CPUs utilized\n" +
+				"8740.10,msec,cpu-clock,8743210000,100.00,0.874,CPUs utilized\n" +
+				"12840,,context-switches,8743210000,100.00,0.001,M/sec\n" +
+				"12840,,cs,8743210000,100.00,0.001,M/sec\n",
+			expected: map[string]float64{
+				"CPU Time (ms)":    8743.21,
+				"Context Switches": 12840,
+			},
+		},
+		{
+			name:     "alias only",
+			content:  "8740.1,msec,cpu-clock,8743210000,100.00,0.874,CPUs utilized\n",
+			expected: map[string]float64{"CPU Time (ms)": 8740.1},
+		},
+		{
+			name:    "not perf stat output",
+			content: "8743.21 msec task-clock\n",
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := procfsTestGetMeasures(t, "chrome_youtube_0_perf_20180120_224843.csv", test.content, perfGetMeasures)
+			if test.err {
+				if err == nil {
+					t.Errorf("no error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.expected) {
+				t.Errorf("got %v, expected %v", got, test.expected)
+			}
+			for name, value := range test.expected {
+				if got[name] != value {
+					t.Errorf("%s: got %v, expected %v", name, got[name], value)
+				}
+			}
+		})
+	}
+}
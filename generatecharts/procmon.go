@@ -35,11 +35,27 @@ type procmonEvent struct {
 	Detail       string  `xml:"Detail"`
 	Duration     float64 `xml:"Duration"`
 	Category     string  `xml:"Category"`
+	EventClass   string  `xml:"Event_Class"`
 	RelativeTime string  `xml:"Relative_Time"`
 	TID          int     `xml:"TID"`
 	ParentPID    int     `xml:"Parent_PID"`
 }
 
+const (
+	procmonMeasureSet           = "procmon"
+	procmonEventClassFileSystem = "File System"
+	procmonEventClassRegistry   = "Registry"
+	procmonEventClassNetwork    = "Network"
+)
+
+// Length: 1460, startime: 7208418, endtime: 7208418, seqnum: 0, connid: 0
+// Length: 1 460, seqnum: 0, connid: 0
+//
+// Length is the first field and is followed by other numeric fields, so file system patterns do not fit
+var procmonNetworkLengthRegExp = []*regexp.Regexp{
+	regexp.MustCompile(`^Length: ([\d\s,\x{a0}]*\d)`),
+}
+
 type OperationName string
 
 type OperationParam string
@@ -103,7 +119,7 @@ func (s procmonFileStatsSortByDuration) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 func (s procmonFileStatsSortByDuration) Less(i, j int) bool {
-	return s[i].Length < s[j].Length
+	return s[i].Duration < s[j].Duration
 }
 
 type RelativeTimeSortedList []RelativeTime
@@ -182,6 +198,11 @@ func generateChartsForProcmonFiles(files []os.FileInfo) error {
 
 	// iteration > browser.exe > c:\path
 	procmonStats := map[string]map[string]map[string]procmonFileStats{}
+	// iteration > browser.exe > HKCU\Software\key
+	procmonRegistryStats := map[string]map[string]map[string]procmonFileStats{}
+	// iteration > browser.exe > 13.107.4.50:https
+	procmonNetworkStats := map[string]map[string]map[string]procmonFileStats{}
+	var measures []Measure
 	for _, f := range files {
 		if filepath.Ext(f.Name()) != ".xml" {
 			continue
@@ -213,6 +234,21 @@ func generateChartsForProcmonFiles(files []os.FileInfo) error {
 		}
 
 		for _, event := range p.EventList.Events {
+			switch procmonGetEventClass(event) {
+			case procmonEventClassRegistry:
+				err = procmonAddRegistryEvent(procmonRegistryStats, meta.iteration, event)
+				if err != nil {
+					return err
+				}
+				continue
+			case procmonEventClassNetwork:
+				err = procmonAddNetworkEvent(procmonNetworkStats, meta.iteration, event)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
 			if procmonStats[meta.iteration] == nil {
 				procmonStats[meta.iteration] = map[string]map[string]procmonFileStats{}
 			}
@@ -252,32 +288,195 @@ func generateChartsForProcmonFiles(files []os.FileInfo) error {
 			if event.Operation == "UnlockFileSingle" || event.Operation == "LockFile" {
 				continue // Do not calculate Length for Lock/Unlock Operations
 			}
-			for _, re := range lengthRegExp {
-				match := re.FindStringSubmatch(event.Detail)
-				//fmt.Println(match)
-				if len(match) > 1 {
-					lengthVal := strings.Replace(match[1], "\u00a0", "", -1)
-					lengthVal = strings.Replace(lengthVal, ",", "", -1)
-					lengthVal = strings.Replace(lengthVal, " ", "", -1)
-					length, err := strconv.Atoi(lengthVal)
-					if err != nil {
-						fmt.Println(err)
-						continue
-					}
-					tmp := procmonStats[meta.iteration][event.ProcessName][event.Path]
-					tmp.Length += length
-					procmonStats[meta.iteration][event.ProcessName][event.Path] = tmp
-					procmonStats[meta.iteration][event.ProcessName][event.Path].Operation[OperationName(event.Operation)][OperationParam("Length")] += length
-				}
+			length := procmonGetLength(event.Detail, lengthRegExp)
+			if length > 0 {
+				tmp := procmonStats[meta.iteration][event.ProcessName][event.Path]
+				tmp.Length += length
+				procmonStats[meta.iteration][event.ProcessName][event.Path] = tmp
+				procmonStats[meta.iteration][event.ProcessName][event.Path].Operation[OperationName(event.Operation)][OperationParam("Length")] += length
 			}
 		}
 
 		if xmlFile != nil {
 			xmlFile.Close()
 		}
+
+		measures = append(measures, procmonGetMeasures(p.EventList.Events, meta)...)
 	}
 
 	//fmt.Printf("%s\n", procmonStats)
+	procmonCalculateTotals(procmonStats)
+	procmonCalculateTotals(procmonRegistryStats)
+	procmonCalculateTotals(procmonNetworkStats)
+
+	for iteration, iterationStats := range procmonStats {
+		procmonReportJsonFileName := fmt.Sprintf("procmonFileStat-%s.json", iteration)
+		procmonReportJsonFile, err := os.OpenFile(filepath.Join(*csvPath, procmonReportJsonFileName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			if procmonReportJsonFile != nil {
+				procmonReportJsonFile.Close()
+			}
+			return err
+		}
+		defer procmonReportJsonFile.Close()
+
+		err = json.NewEncoder(procmonReportJsonFile).Encode(iterationStats)
+		if err != nil {
+			fmt.Printf("failed to json encode %s: %s\n", procmonReportJsonFileName, err)
+			return err
+		}
+	}
+
+	err = procmonGenerateReportTopN(procmonStats, procmonRegistryStats, procmonNetworkStats)
+	if err != nil {
+		fmt.Printf("failed to procmonGenerateHtmlReport: %s\n", err)
+		return err
+	}
+
+	chartBars := getChartBarsFromRawResults(groupMeasuresBySet(measures), 2)
+	for measureSet, barValues := range chartBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	groupedBars := getIterationsBarsFromGroupedMeasures(groupMeasuresByIterations(measures), 2)
+	for measureSet, barValues := range groupedBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Procmon exports "Event Class" only when the column is enabled in ProcmonConfiguration.pmc,
+// so fall back to operation names: RegQueryValue, RegSetValue, TCP Send, UDP Receive etc.
+func procmonGetEventClass(event procmonEvent) string {
+	if event.EventClass != "" {
+		return event.EventClass
+	}
+
+	if strings.HasPrefix(event.Operation, "Reg") {
+		return procmonEventClassRegistry
+	}
+	if strings.HasPrefix(event.Operation, "TCP ") || strings.HasPrefix(event.Operation, "UDP ") {
+		return procmonEventClassNetwork
+	}
+	return procmonEventClassFileSystem
+}
+
+func procmonGetStatsEntry(stats map[string]map[string]map[string]procmonFileStats, iteration, processName, path string) procmonFileStats {
+	if stats[iteration] == nil {
+		stats[iteration] = map[string]map[string]procmonFileStats{}
+	}
+	if stats[iteration][processName] == nil {
+		stats[iteration][processName] = map[string]procmonFileStats{}
+	}
+	if _, exists := stats[iteration][processName][path]; !exists {
+		stats[iteration][processName][path] = procmonFileStats{
+			PID:       map[int]RelativeTimeSortedList{},
+			TID:       map[int]RelativeTimeSortedList{},
+			ParentPID: map[int]RelativeTimeSortedList{},
+			Operation: map[OperationName]map[OperationParam]int{},
+			Path:      path,
+		}
+	}
+
+	return stats[iteration][processName][path]
+}
+
+func procmonAddEventTimes(stat *procmonFileStats, event procmonEvent) error {
+	relativeTime, err := time.Parse("15:04:05.0000000", event.RelativeTime)
+	if err != nil {
+		return err
+	}
+	stat.RelativeTime = append(stat.RelativeTime, RelativeTime(relativeTime))
+	stat.PID[event.PID] = append(stat.PID[event.PID], RelativeTime(relativeTime))
+	stat.TID[event.TID] = append(stat.TID[event.TID], RelativeTime(relativeTime))
+	stat.ParentPID[event.ParentPID] = append(stat.ParentPID[event.ParentPID], RelativeTime(relativeTime))
+
+	return nil
+}
+
+func procmonAddOperation(stat *procmonFileStats, event procmonEvent, length int) {
+	if stat.Operation[OperationName(event.Operation)] == nil {
+		stat.Operation[OperationName(event.Operation)] = map[OperationParam]int{}
+	}
+	stat.Operation[OperationName(event.Operation)][OperationParam("Count")]++
+	stat.Operation[OperationName(event.Operation)][OperationParam("Duration")] += int(event.Duration * 10000000)
+	if length > 0 {
+		stat.Operation[OperationName(event.Operation)][OperationParam("Length")] += length
+	}
+}
+
+// Registry stats are keyed by registry key path, Length is not applicable
+func procmonAddRegistryEvent(stats map[string]map[string]map[string]procmonFileStats, iteration string, event procmonEvent) error {
+	stat := procmonGetStatsEntry(stats, iteration, event.ProcessName, event.Path)
+	stat.Count++
+	stat.Duration += int(event.Duration * 10000000)
+	err := procmonAddEventTimes(&stat, event)
+	if err != nil {
+		return err
+	}
+	procmonAddOperation(&stat, event, 0)
+	stats[iteration][event.ProcessName][event.Path] = stat
+
+	return nil
+}
+
+// Network stats are keyed by remote endpoint, Length is bytes sent and received
+func procmonAddNetworkEvent(stats map[string]map[string]map[string]procmonFileStats, iteration string, event procmonEvent) error {
+	endpoint := procmonGetRemoteEndpoint(event.Path)
+	stat := procmonGetStatsEntry(stats, iteration, event.ProcessName, endpoint)
+	stat.Count++
+	stat.Duration += int(event.Duration * 10000000)
+	err := procmonAddEventTimes(&stat, event)
+	if err != nil {
+		return err
+	}
+	length := procmonGetLength(event.Detail, procmonNetworkLengthRegExp)
+	stat.Length += length
+	procmonAddOperation(&stat, event, length)
+	stats[iteration][event.ProcessName][endpoint] = stat
+
+	return nil
+}
+
+// DESKTOP-1:52134 -> 13.107.4.50:https
+//
+// returns "13.107.4.50:https"
+func procmonGetRemoteEndpoint(path string) string {
+	parts := strings.SplitN(path, " -> ", 2)
+	if len(parts) == 2 {
+		return strings.Trim(parts[1], " ")
+	}
+
+	return strings.Trim(path, " ")
+}
+
+func procmonGetLength(detail string, lengthRegExp []*regexp.Regexp) int {
+	for _, re := range lengthRegExp {
+		match := re.FindStringSubmatch(detail)
+		if len(match) > 1 {
+			lengthVal := strings.Replace(match[1], "\u00a0", "", -1)
+			lengthVal = strings.Replace(lengthVal, ",", "", -1)
+			lengthVal = strings.Replace(lengthVal, " ", "", -1)
+			length, err := strconv.Atoi(lengthVal)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			return length
+		}
+	}
+
+	return 0
+}
+
+func procmonCalculateTotals(procmonStats map[string]map[string]map[string]procmonFileStats) {
 	for iteration, iterationStats := range procmonStats {
 		for processName, stats := range iterationStats {
 			totalDuration := 0
@@ -293,9 +492,15 @@ func generateChartsForProcmonFiles(files []os.FileInfo) error {
 				stat.TotalDuration = totalDuration
 				stat.TotalLength = totalLength
 				stat.TotalCount = totalCount
-				stat.PercentDuration = stat.Duration * 100 / totalDuration
-				stat.PercentLength = stat.Length * 100 / totalLength
-				stat.PercentCount = stat.Count * 100 / totalCount
+				if totalDuration > 0 {
+					stat.PercentDuration = stat.Duration * 100 / totalDuration
+				}
+				if totalLength > 0 {
+					stat.PercentLength = stat.Length * 100 / totalLength
+				}
+				if totalCount > 0 {
+					stat.PercentCount = stat.Count * 100 / totalCount
+				}
 				sort.Sort(RelativeTimeSortedList(stat.RelativeTime))
 				if len(stat.RelativeTime) > 0 {
 					stat.RelativeTimeMin = stat.RelativeTime[0]
@@ -311,37 +516,61 @@ func generateChartsForProcmonFiles(files []os.FileInfo) error {
 				for ParentPID := range stat.ParentPID {
 					sort.Sort(RelativeTimeSortedList(stat.ParentPID[ParentPID]))
 				}
-				sort.Sort(RelativeTimeSortedList(stat.RelativeTime))
 				procmonStats[iteration][processName][path] = stat
 			}
 		}
 	}
+}
 
-	for iteration, iterationStats := range procmonStats {
-		procmonReportJsonFileName := fmt.Sprintf("procmonFileStat-%s.json", iteration)
-		procmonReportJsonFile, err := os.OpenFile(filepath.Join(*csvPath, procmonReportJsonFileName), os.O_CREATE|os.O_TRUNC, 0666)
-		if err != nil {
-			if procmonReportJsonFile != nil {
-				procmonReportJsonFile.Close()
+// Sums registry and network activity of browser processes from single procmon export
+func procmonGetMeasures(events []procmonEvent, meta Measure) []Measure {
+	accum := map[string]float64{}
+	endpoints := map[string]bool{}
+	for _, event := range events {
+		isBrowserProcess := false
+		for _, browserProcessName := range meta.browserProcesses {
+			if strings.EqualFold(event.ProcessName, browserProcessName) {
+				isBrowserProcess = true
+				break
 			}
-			return err
 		}
-		defer procmonReportJsonFile.Close()
+		if !isBrowserProcess {
+			continue
+		}
 
-		err = json.NewEncoder(procmonReportJsonFile).Encode(iterationStats)
-		if err != nil {
-			fmt.Printf("failed to json encode %s: %s\n", procmonReportJsonFileName, err)
-			return err
+		switch procmonGetEventClass(event) {
+		case procmonEventClassRegistry:
+			accum["Registry Operations"]++
+			accum["Registry Duration (ms)"] += event.Duration * 1000
+			if event.Operation == "RegSetValue" || event.Operation == "RegCreateKey" || event.Operation == "RegDeleteValue" {
+				accum["Registry Writes"]++
+			}
+		case procmonEventClassNetwork:
+			endpoints[procmonGetRemoteEndpoint(event.Path)] = true
+			length := float64(procmonGetLength(event.Detail, procmonNetworkLengthRegExp))
+			if strings.HasSuffix(event.Operation, " Send") {
+				accum["Network Sent Bytes"] += length
+			}
+			if strings.HasSuffix(event.Operation, " Receive") {
+				accum["Network Received Bytes"] += length
+			}
 		}
 	}
+	accum["Network Remote Endpoints"] = float64(len(endpoints))
 
-	err = procmonGenerateReportTopN(procmonStats)
-	if err != nil {
-		fmt.Printf("failed to procmonGenerateHtmlReport: %s\n", err)
-		return err
+	var msrs []Measure
+	for measureName, measureVal := range accum {
+		if measureVal == 0 {
+			continue
+		}
+		m := meta
+		m.measureSet = procmonMeasureSet
+		m.measureName = measureName
+		m.value = measureVal
+		msrs = append(msrs, m)
 	}
 
-	return nil
+	return msrs
 }
 
 const procmonReportTplBaseTopN = `
@@ -450,10 +679,18 @@ function showHide(el) {
 	</body>
 </html>`
 
-func procmonGenerateReportTopN(procmonStats map[string]map[string]map[string]procmonFileStats) error {
-	for iteration, iterationStats := range procmonStats {
+func procmonGenerateReportTopN(procmonStats, procmonRegistryStats, procmonNetworkStats map[string]map[string]map[string]procmonFileStats) error {
+	// Iteration may have registry or network events only
+	iterations := map[string]bool{}
+	for _, stats := range []map[string]map[string]map[string]procmonFileStats{procmonStats, procmonRegistryStats, procmonNetworkStats} {
+		for iteration := range stats {
+			iterations[iteration] = true
+		}
+	}
+
+	for iteration := range iterations {
 		browserFileStats := map[string][]procmonFileStats{}
-		for browserProcessName, stat := range iterationStats {
+		for browserProcessName, stat := range procmonStats[iteration] {
 			l := procmonGetListFromMap(stat)
 			sort.Sort(procmonFileStatsSortByCount(l))
 			browserFileStats[browserProcessName+" Count"] = lastN(l, 15)
@@ -466,8 +703,25 @@ func procmonGenerateReportTopN(procmonStats map[string]map[string]map[string]pro
 			//fmt.Println("Len2: ", len(browserFileStats[browserProcessName]))
 		}
 
+		// Registry hot keys
+		for browserProcessName, stat := range procmonRegistryStats[iteration] {
+			l := procmonGetListFromMap(stat)
+			sort.Sort(procmonFileStatsSortByCount(l))
+			browserFileStats[browserProcessName+" Registry Count"] = lastN(l, 15)
+
+			sort.Sort(procmonFileStatsSortByDuration(l))
+			browserFileStats[browserProcessName+" Registry Duration"] = lastN(l, 15)
+		}
+
+		// Bytes per remote endpoint
+		for browserProcessName, stat := range procmonNetworkStats[iteration] {
+			l := procmonGetListFromMap(stat)
+			sort.Sort(procmonFileStatsSortByLength(l))
+			browserFileStats[browserProcessName+" Network Length"] = lastN(l, 15)
+		}
+
 		procmonReportJsonFileName := fmt.Sprintf("procmonTopN-%s.json", iteration)
-		procmonReportJsonFile, err := os.OpenFile(filepath.Join(*csvPath, procmonReportJsonFileName), os.O_CREATE|os.O_TRUNC, 0666)
+		procmonReportJsonFile, err := os.OpenFile(filepath.Join(*csvPath, procmonReportJsonFileName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 		if err != nil {
 			if procmonReportJsonFile != nil {
 				procmonReportJsonFile.Close()
@@ -505,7 +759,7 @@ func procmonGenerateHtmlReport(name string, tpl string, iteration string, data i
 	}
 
 	procmonReportHtmlFileName := fmt.Sprintf("%s-%s.html", name, iteration)
-	procmonReportHtmlFile, err := os.OpenFile(filepath.Join(*csvPath, procmonReportHtmlFileName), os.O_CREATE|os.O_TRUNC, 0666)
+	procmonReportHtmlFile, err := os.OpenFile(filepath.Join(*csvPath, procmonReportHtmlFileName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		if procmonReportHtmlFile != nil {
 			procmonReportHtmlFile.Close()
@@ -527,7 +781,7 @@ func lastN(pfs []procmonFileStats, n int) []procmonFileStats {
 		reversed = append(reversed, pfs[i])
 	}
 	var lastN []procmonFileStats
-	for i := 0; i <= n; i++ {
+	for i := 0; i <= n && i < len(reversed); i++ {
 		lastN = append(lastN, reversed[i])
 	}
 	return lastN
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcmonGetNetworkLength(t *testing.T) {
+	tests := []struct {
+		detail string
+		length int
+	}{
+		{"Length: 1460, startime: 7208418, endtime: 7208418, seqnum: 0, connid: 0", 1460},
+		{"Length: 0, startime: 7208418, endtime: 7208420, seqnum: 0, connid: 0", 0},
+		{"Length: 48, seqnum: 0, connid: 0", 48},
+		{"Length: 65 536, startime: 7208418, endtime: 7208418, seqnum: 0, connid: 0", 65536},
+		{"Length: 65\u00a0536, seqnum: 0, connid: 0", 65536},
+		{"Length: 65,536, startime: 7208418, endtime: 7208418, seqnum: 0, connid: 0", 65536},
+		{"Length: 1460", 1460},
+		{"startime: 7208418, endtime: 7208418", 0},
+	}
+	for _, test := range tests {
+		length := procmonGetLength(test.detail, procmonNetworkLengthRegExp)
+		if length != test.length {
+			t.Errorf("'%s': got %d, expected %d", test.detail, length, test.length)
+		}
+	}
+}
+
+func TestProcmonGetMeasuresNetwork(t *testing.T) {
+	meta := Measure{browser: chromeProcessName, browserProcesses: []string{chromeProcessName}}
+	events := []procmonEvent{
+		{
+			ProcessName: "chrome.exe",
+			Operation:   "TCP Send",
+			Path:        "DESKTOP-1:52134 -> 13.107.4.50:https",
+			Detail:      "Length: 1460, startime: 7208418, endtime: 7208418, seqnum: 0, connid: 0",
+		},
+		{
+			ProcessName: "chrome.exe",
+			Operation:   "TCP Receive",
+			Path:        "DESKTOP-1:52134 -> 13.107.4.50:https",
+			Detail:      "Length: 8 192, seqnum: 0, connid: 0",
+		},
+		{
+			ProcessName: "chrome.exe",
+			Operation:   "UDP Send",
+			Path:        "DESKTOP-1:61000 -> 8.8.8.8:domain",
+			Detail:      "Length: 40, seqnum: 0, connid: 0",
+		},
+		{
+			ProcessName: "svchost.exe",
+			Operation:   "TCP Receive",
+			Path:        "DESKTOP-1:52135 -> 13.107.4.51:https",
+			Detail:      "Length: 100000, seqnum: 0, connid: 0",
+		},
+	}
+
+	expected := map[string]float64{
+		"Network Sent Bytes":       1500,
+		"Network Received Bytes":   8192,
+		"Network Remote Endpoints": 2,
+	}
+	measures := procmonGetMeasures(events, meta)
+	if len(measures) != len(expected) {
+		t.Errorf("got %d measures, expected %d: %v", len(measures), len(expected), measures)
+	}
+	for _, m := range measures {
+		if m.value != expected[m.measureName] {
+			t.Errorf("%s: got %v, expected %v", m.measureName, m.value, expected[m.measureName])
+		}
+	}
+}
+
+func TestProcmonAddNetworkEvent(t *testing.T) {
+	stats := map[string]map[string]map[string]procmonFileStats{}
+	event := procmonEvent{
+		ProcessName:  "chrome.exe",
+		Operation:    "TCP Send",
+		Path:         "DESKTOP-1:52134 -> 13.107.4.50:https",
+		Detail:       "Length: 1460, startime: 7208418, endtime: 7208418, seqnum: 0, connid: 0",
+		RelativeTime: "00:00:01.5000000",
+	}
+	for i := 0; i < 2; i++ {
+		err := procmonAddNetworkEvent(stats, "1", event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stat := stats["1"]["chrome.exe"]["13.107.4.50:https"]
+	if stat.Count != 2 || stat.Length != 2920 {
+		t.Errorf("got count %d length %d, expected count 2 length 2920", stat.Count, stat.Length)
+	}
+}
+
+func TestLastN(t *testing.T) {
+	var pfs []procmonFileStats
+	for i := 1; i <= 3; i++ {
+		pfs = append(pfs, procmonFileStats{Count: i})
+	}
+
+	// n is the last index, fewer stats than n are all returned
+	tests := []struct {
+		n        int
+		expected []int
+	}{
+		{0, []int{3}},
+		{1, []int{3, 2}},
+		{15, []int{3, 2, 1}},
+	}
+	for _, test := range tests {
+		got := lastN(pfs, test.n)
+		if len(got) != len(test.expected) {
+			t.Errorf("n %d: got %v, expected counts %v", test.n, got, test.expected)
+			continue
+		}
+		for i, count := range test.expected {
+			if got[i].Count != count {
+				t.Errorf("n %d: got %v, expected counts %v", test.n, got, test.expected)
+				break
+			}
+		}
+	}
+	if got := lastN(nil, 15); len(got) != 0 {
+		t.Errorf("got %v for no stats", got)
+	}
+}
+
+func TestProcmonGenerateReportTopN(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldCsvPath := *csvPath
+	*csvPath = dir
+	defer func() { *csvPath = oldCsvPath }()
+
+	// Iteration 2 has registry and network events only
+	fileStats := map[string]map[string]map[string]procmonFileStats{
+		"1": {"chrome.exe": {`C:\Users\user\AppData\Local\Temp\f.tmp`: {Count: 1}}},
+	}
+	registryStats := map[string]map[string]map[string]procmonFileStats{
+		"2": {"chrome.exe": {`HKCU\Software\Google\Chrome`: {Count: 2}}},
+	}
+	networkStats := map[string]map[string]map[string]procmonFileStats{}
+	err = procmonAddNetworkEvent(networkStats, "3", procmonEvent{
+		ProcessName:  "chrome.exe",
+		Operation:    "TCP Send",
+		Path:         "DESKTOP-1:52134 -> 13.107.4.50:https",
+		Detail:       "Length: 1460, startime: 7208418, endtime: 7208418, seqnum: 0, connid: 0",
+		RelativeTime: "00:00:01.5000000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = procmonGenerateReportTopN(fileStats, registryStats, networkStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for iteration, expected := range map[string]string{"1": "chrome.exe Count", "2": "chrome.exe Registry Count", "3": "chrome.exe Network Length"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "procmonTopN-"+iteration+".json"))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("iteration %s: got %s, expected %s", iteration, content, expected)
+		}
+	}
+}
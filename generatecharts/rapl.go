@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Energy counters of /sys/class/powercap/intel-rapl:* recorded by raplrecorder
+const (
+	raplMeasureSet      = "rapl"
+	raplColTimeStamp    = "timestamp"
+	raplColZone         = "zone"
+	raplColName         = "name"
+	raplColEnergy       = "energy_uj"
+	raplColEnergyRange  = "max_energy_range_uj"
+	raplMicroJoulesInJ  = 1000000.0
+	raplZoneIntelPrefix = "intel-rapl:"
+)
+
+type raplZoneSamples struct {
+	name        string
+	energyRange float64
+	first       time.Time
+	last        time.Time
+	previous    float64
+	energy      float64 // micro joules since first sample
+	count       int
+}
+
+func generateChartsForRaplFiles(files []os.FileInfo) error {
+	measures := []Measure{}
+
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".csv" {
+			continue
+		}
+
+		if strings.Contains(f.Name(), "_"+raplMeasureSet+"_") {
+			m, err := raplGetMeasures(filepath.Join(*csvPath, f.Name()))
+			if err != nil {
+				fmt.Printf("rapl %s err %v", f.Name(), err)
+				return err
+			}
+			measures = append(measures, m...)
+		}
+	}
+
+	chartBars := getChartBarsFromRawResults(groupMeasuresBySet(measures), 6)
+
+	for measureSet, barValues := range chartBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	groupedBars := getIterationsBarsFromGroupedMeasures(groupMeasuresByIterations(measures), 6)
+	for measureSet, barValues := range groupedBars {
+		err := drawBars(measureSet, barValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// File like chrome_yandexstaticfavicon_0_rapl_20180120_224843.csv:
+//
+//	timestamp,zone,name,energy_uj,max_energy_range_uj
+//	2018-01-20T22:48:43.123456789Z,intel-rapl:0,package-0,17436427129,262143328850
+//	2018-01-20T22:48:43.123456789Z,intel-rapl:0:0,core,5871298370,262143328850
+func raplGetMeasures(csvFilePath string) ([]Measure, error) {
+	msrs := []Measure{}
+
+	metaMeasure, err := generalGetFileMeta(csvFilePath)
+	if err != nil {
+		return msrs, err
+	}
+
+	csvFile, err := os.Open(csvFilePath)
+	if err != nil {
+		return msrs, err
+	}
+	defer csvFile.Close()
+
+	records, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		return msrs, fmt.Errorf("raplGetMeasures: %s: %v", csvFilePath, err)
+	}
+	if len(records) == 0 {
+		return msrs, nil
+	}
+
+	cols := map[string]int{}
+	for colId, colTitle := range records[0] {
+		cols[strings.Trim(colTitle, " ")] = colId
+	}
+	for _, colTitle := range []string{raplColTimeStamp, raplColZone, raplColName, raplColEnergy, raplColEnergyRange} {
+		if _, found := cols[colTitle]; !found {
+			return msrs, fmt.Errorf("raplGetMeasures: %s: column %s not found in header", csvFilePath, colTitle)
+		}
+	}
+
+	zones := map[string]*raplZoneSamples{}
+	for i, line := range records[1:] {
+		t, err := time.Parse(time.RFC3339Nano, line[cols[raplColTimeStamp]])
+		if err != nil {
+			return msrs, fmt.Errorf("raplGetMeasures: %s: row %d: %v", csvFilePath, i+2, err)
+		}
+		energy, err := strconv.ParseFloat(line[cols[raplColEnergy]], 64)
+		if err != nil {
+			return msrs, fmt.Errorf("raplGetMeasures: %s: row %d column %s: %v", csvFilePath, i+2, raplColEnergy, err)
+		}
+		energyRange, err := strconv.ParseFloat(line[cols[raplColEnergyRange]], 64)
+		if err != nil {
+			return msrs, fmt.Errorf("raplGetMeasures: %s: row %d column %s: %v", csvFilePath, i+2, raplColEnergyRange, err)
+		}
+
+		zoneId := line[cols[raplColZone]]
+		zone, found := zones[zoneId]
+		if !found {
+			zone = &raplZoneSamples{name: line[cols[raplColName]], energyRange: energyRange, first: t, previous: energy}
+			zones[zoneId] = zone
+		}
+		// Counter wraps around at max_energy_range_uj
+		if energy < zone.previous {
+			zone.energy += zone.energyRange - zone.previous + energy
+		} else {
+			zone.energy += energy - zone.previous
+		}
+		zone.previous = energy
+		zone.last = t
+		zone.count++
+	}
+
+	for zoneId, zone := range zones {
+		if zone.count < 2 {
+			continue
+		}
+		name := raplZoneLabel(zoneId, zones)
+
+		m := metaMeasure
+		m.measureSet = raplMeasureSet
+		m.measureName = name + " Energy (Joules)"
+		m.value = zone.energy / raplMicroJoulesInJ
+		msrs = append(msrs, m)
+
+		seconds := zone.last.Sub(zone.first).Seconds()
+		if seconds > 0 {
+			m.measureName = name + " Average Power (Watt)"
+			m.value = zone.energy / raplMicroJoulesInJ / seconds
+			msrs = append(msrs, m)
+		}
+	}
+
+	return msrs, nil
+}
+
+// Subzones like intel-rapl:0:0 "core" are labeled with package name "package-0 core"
+func raplZoneLabel(zoneId string, zones map[string]*raplZoneSamples) string {
+	name := zones[zoneId].name
+	if strings.Count(strings.TrimPrefix(zoneId, raplZoneIntelPrefix), ":") == 0 {
+		return name
+	}
+	parent, found := zones[zoneId[:strings.LastIndex(zoneId, ":")]]
+	if !found {
+		return name
+	}
+	return parent.name + " " + name
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRaplGetMeasures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rapl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	csvFilePath := filepath.Join(dir, "chrome_youtube_0_rapl_20180120_224843.csv")
+	// Counter of package wraps around at max_energy_range_uj between second and third samples
+	err = ioutil.WriteFile(csvFilePath, []byte(
+		"timestamp,zone,name,energy_uj,max_energy_range_uj\n"+
+			"2018-01-20T22:48:43Z,intel-rapl:0,package-0,900,1000\n"+
+			"2018-01-20T22:48:43Z,intel-rapl:0:0,core,100,1000\n"+
+			"2018-01-20T22:48:44Z,intel-rapl:0,package-0,950,1000\n"+
+			"2018-01-20T22:48:44Z,intel-rapl:0:0,core,200,1000\n"+
+			"2018-01-20T22:48:45Z,intel-rapl:0,package-0,50,1000\n"+
+			"2018-01-20T22:48:45Z,intel-rapl:0:0,core,300,1000\n"+
+			"2018-01-20T22:48:47Z,intel-rapl:0,package-0,150,1000\n"+
+			"2018-01-20T22:48:47Z,intel-rapl:0:0,core,400,1000\n"+
+			"2018-01-20T22:48:47Z,intel-rapl:1,package-1,400,1000\n",
+	), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	measures, err := raplGetMeasures(csvFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// package-1 has single sample only
+	expected := map[string]float64{
+		"package-0 Energy (Joules)":           250e-6,
+		"package-0 Average Power (Watt)":      250e-6 / 4,
+		"package-0 core Energy (Joules)":      300e-6,
+		"package-0 core Average Power (Watt)": 300e-6 / 4,
+	}
+	if len(measures) != len(expected) {
+		t.Errorf("got %d measures, expected %d: %v", len(measures), len(expected), measures)
+	}
+	for _, m := range measures {
+		value, found := expected[m.measureName]
+		if !found || math.Abs(m.value-value) > 1e-12 {
+			t.Errorf("%s: got %v, expected %v", m.measureName, m.value, value)
+		}
+		if m.measureSet != raplMeasureSet || m.browser != chromeProcessName || m.scenarioName != "youtube" {
+			t.Errorf("%s: got meta %v", m.measureName, m)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const runManifestFileName = "runManifest.json"
+
+// Optional file in -csv directory written by test harness:
+//
+//	{
+//		"browsers": {"yabro": {"version": "18.7.0.85", "chromiumVersion": "65.0.3325.181", "binariesDir": "C:\\...\\Application\\18.7.0.85"}},
+//		"runs": [{"browser": "yabro", "scenario": "yandexyarunewtab", "iteration": "0", "start": "2018-01-20T22:48:43Z", "end": "2018-01-20T22:58:43Z"}]
+//	}
+type runManifest struct {
+	Browsers map[string]runManifestBrowser `json:"browsers"`
+	Runs     []runManifestRun              `json:"runs"`
+}
+
+type runManifestBrowser struct {
+	Version         string `json:"version"`
+	ChromiumVersion string `json:"chromiumVersion"`
+	BinariesDir     string `json:"binariesDir"`
+	// Full SRUM AppId paths of browser executables
+	SrumAppIds []string `json:"srumAppIds"`
+}
+
+type runManifestRun struct {
+	Browser   string    `json:"browser"`
+	Scenario  string    `json:"scenario"`
+	Iteration string    `json:"iteration"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+}
+
+// Returns empty manifest if there is no manifest file
+func loadRunManifest() (runManifest, error) {
+	if *csvPath == "" {
+		return runManifest{}, nil
+	}
+
+	return loadRunManifestFromDir(*csvPath)
+}
+
+func loadRunManifestFromDir(dir string) (runManifest, error) {
+	manifest := runManifest{}
+	manifestPath := filepath.Join(dir, runManifestFileName)
+	if _, err := os.Stat(manifestPath); err != nil {
+		return manifest, nil
+	}
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to decode %s: %s", manifestPath, err)
+	}
+
+	return manifest, nil
+}
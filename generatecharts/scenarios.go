@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scenario is a dimension of its own: charts can be filtered by scenario and measure set,
+// and scenario report shows scenario × browser heatmap of diffs vs Yandex Browser
+// with a page of charts per scenario.
+const (
+	scenarioReport = "scenarios"
+	// Diff of heatmap cell with full color
+	scenarioReportMaxDiffPercent = 50.0
+)
+
+// Measures of one chart without scenario like "cpuUsage CPU  Utilization %"
+type scenarioMetric struct {
+	name string
+	// scenario > browser process name > values of iterations
+	values map[string]map[string][]float64
+	// scenario > full measure set name, direction of diff is configured by full name
+	fullSetNames map[string]string
+}
+
+type scenarioReportCell struct {
+	Scenario string
+	Found    bool
+	// Positive if Yandex Browser is better
+	DiffPercent float64
+	Baseline    float64
+	Competitor  float64
+	Color       template.CSS
+}
+
+type scenarioReportRow struct {
+	Metric string
+	Cells  []scenarioReportCell
+}
+
+type scenarioReportHeatmap struct {
+	Competitor string
+	Rows       []scenarioReportRow
+}
+
+type scenarioReportMedians struct {
+	Metric  string
+	Medians []string
+}
+
+type scenarioReportPage struct {
+	Scenario string
+	Browsers []string
+	Medians  []scenarioReportMedians
+	Charts   []string
+}
+
+var (
+	scenarioReportMetrics = map[string]*scenarioMetric{}
+	// chart name > scenario
+	scenarioReportCharts = map[string]string{}
+	// scenario > PNG file names
+	scenarioReportPngs = map[string][]string{}
+)
+
+// Returns false if measure is filtered out by -scenarios or -measureSets
+func scenarioMeasureSelected(m Measure, fullSetName string) bool {
+	if *scenarios != "" && !scenarioFlagListContains(*scenarios, func(s string) bool {
+		return strings.EqualFold(s, m.scenarioName)
+	}) {
+		return false
+	}
+	if *measureSets != "" && !scenarioFlagListContains(*measureSets, func(s string) bool {
+		return strings.EqualFold(s, m.measureSet) || strings.HasPrefix(fullSetName, s)
+	}) {
+		return false
+	}
+
+	return true
+}
+
+func scenarioFlagListContains(list string, matches func(string) bool) bool {
+	for _, s := range strings.Split(list, ",") {
+		s = strings.Trim(s, " ")
+		if s != "" && matches(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func scenarioReportAddMeasure(fullSetName string, m Measure) {
+	scenarioReportCharts[fullSetName] = m.scenarioName
+	// Measures are collected for composite score too
+	if !*scenarioReportEnabled && *scoreConfigPath == "" {
+		return
+	}
+
+	name := getMeasureSetFullName(m.measureSet, m.browser, m.measureName, "")
+	metric, found := scenarioReportMetrics[name]
+	if !found {
+		metric = &scenarioMetric{
+			name:         name,
+			values:       map[string]map[string][]float64{},
+			fullSetNames: map[string]string{},
+		}
+		scenarioReportMetrics[name] = metric
+	}
+	if metric.values[m.scenarioName] == nil {
+		metric.values[m.scenarioName] = map[string][]float64{}
+	}
+	metric.values[m.scenarioName][m.browser] = append(metric.values[m.scenarioName][m.browser], m.value)
+	metric.fullSetNames[m.scenarioName] = fullSetName
+}
+
+// Called for charts of iterations which have no measures of scenario report
+func scenarioReportAddIterationsChart(fullSetName, scenario string) {
+	scenarioReportCharts[fullSetName] = scenario
+}
+
+// Called for every PNG file drawn
+func scenarioReportAddChart(measureSet string) {
+	scenario, found := scenarioReportCharts[measureSet]
+	if !found {
+		return
+	}
+	scenarioReportPngs[scenario] = append(scenarioReportPngs[scenario], measureSet+".png")
+}
+
+// Writes scenarios.html with heatmaps and scenario-<name>.html pages to PNG directory
+func generateScenarioReport() error {
+	if len(scenarioReportMetrics) == 0 {
+		return nil
+	}
+
+	scenarioSet := map[string]bool{}
+	browserSet := map[string]bool{}
+	var metricNames []string
+	for name, metric := range scenarioReportMetrics {
+		metricNames = append(metricNames, name)
+		for scenario, browsers := range metric.values {
+			scenarioSet[scenario] = true
+			for browser := range browsers {
+				browserSet[browser] = true
+			}
+		}
+	}
+	sort.Strings(metricNames)
+	scenarioNames := scenarioSortedKeys(scenarioSet)
+	browsers := scenarioSortedKeys(browserSet)
+
+	var heatmaps []scenarioReportHeatmap
+	for _, competitor := range browsers {
+		if competitor == yaBrowserProcessName {
+			continue
+		}
+		heatmap := scenarioReportHeatmap{Competitor: competitor}
+		for _, name := range metricNames {
+			row := scenarioReportRow{Metric: name}
+			hasCells := false
+			for _, scenario := range scenarioNames {
+				cell := scenarioReportGetCell(scenarioReportMetrics[name], scenario, competitor)
+				hasCells = hasCells || cell.Found
+				row.Cells = append(row.Cells, cell)
+			}
+			if hasCells {
+				heatmap.Rows = append(heatmap.Rows, row)
+			}
+		}
+		heatmaps = append(heatmaps, heatmap)
+	}
+
+	err := scenarioReportWriteHtml(scenarioReport+".html", scenarioReportTpl, map[string]interface{}{
+		"Scenarios": scenarioNames,
+		"Baseline":  yaBrowserProcessName,
+		"Heatmaps":  heatmaps,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, scenario := range scenarioNames {
+		page := scenarioReportPage{Scenario: scenario, Browsers: browsers}
+		for _, name := range metricNames {
+			values := scenarioReportMetrics[name].values[scenario]
+			if values == nil {
+				continue
+			}
+			medians := scenarioReportMedians{Metric: name}
+			for _, browser := range browsers {
+				if len(values[browser]) == 0 {
+					medians.Medians = append(medians.Medians, "")
+					continue
+				}
+				medians.Medians = append(medians.Medians, fmt.Sprintf("%.2f", median(values[browser])))
+			}
+			page.Medians = append(page.Medians, medians)
+		}
+		page.Charts = scenarioReportPngs[scenario]
+		sort.Strings(page.Charts)
+
+		err = scenarioReportWriteHtml(scenarioReportPageFileName(scenario), scenarioReportPageTpl, page)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scenarioReportGetCell(metric *scenarioMetric, scenario, competitor string) scenarioReportCell {
+	cell := scenarioReportCell{Scenario: scenario}
+	values := metric.values[scenario]
+	if len(values[yaBrowserProcessName]) == 0 || len(values[competitor]) == 0 {
+		return cell
+	}
+
+	cell.Baseline = median(values[yaBrowserProcessName])
+	cell.Competitor = median(values[competitor])
+	if cell.Competitor == 0 {
+		return cell
+	}
+	cell.Found = true
+
+	// Same as diff bars: competitor - Yandex Browser in percent of competitor
+	cell.DiffPercent = (cell.Competitor - cell.Baseline) * 100 / math.Abs(cell.Competitor)
+	if excludedFromBad[metric.fullSetNames[scenario]] {
+		cell.DiffPercent = -cell.DiffPercent
+	}
+
+	// Green if Yandex Browser is better, red if worse
+	intensity := math.Min(math.Abs(cell.DiffPercent)/scenarioReportMaxDiffPercent, 1)
+	fade := uint8(255 - 155*intensity)
+	if cell.DiffPercent >= 0 {
+		cell.Color = template.CSS(fmt.Sprintf("#%02x%02x%02x", fade, 255, fade))
+	} else {
+		cell.Color = template.CSS(fmt.Sprintf("#%02x%02x%02x", 255, fade, fade))
+	}
+
+	return cell
+}
+
+func scenarioReportPageFileName(scenario string) string {
+	return fmt.Sprintf("%s-%s.html", scenarioReport, scenario)
+}
+
+func scenarioSortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func scenarioReportWriteHtml(fileName, tpl string, data interface{}) error {
+	var fn = template.FuncMap{
+		// PNG file names have spaces and '%'
+		"fileUrl": func(fileName string) template.URL {
+			return template.URL(url.PathEscape(fileName))
+		},
+		"pageUrl": func(scenario string) template.URL {
+			return template.URL(url.PathEscape(scenarioReportPageFileName(scenario)))
+		},
+	}
+
+	t, err := template.New(scenarioReport).Funcs(fn).Parse(tpl)
+	if err != nil {
+		return err
+	}
+
+	htmlFile, err := os.Create(filepath.Join(*pngPath, fileName))
+	if err != nil {
+		return err
+	}
+
+	err = t.Execute(htmlFile, data)
+	if err != nil {
+		htmlFile.Close()
+		return fmt.Errorf("failed to generate %s: %s", fileName, err)
+	}
+
+	return ioClose(fileName, htmlFile)
+}
+
+const scenarioReportTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8">
+		<title>Scenarios</title>
+		<style>
+			table { border-collapse: collapse; margin-bottom: 20px; }
+			td, th { border: 1px solid #ccc; padding: 2px 6px; }
+			td.diff { text-align: right; }
+		</style>
+	</head>
+	<body>
+		<p>Diff of {{ .Baseline }} vs competitor in percent of competitor median, positive if {{ .Baseline }} is better</p>
+		{{ $scenarios := .Scenarios }}
+		{{ range $heatmap := .Heatmaps }}
+		<h2>{{ $.Baseline }} vs {{ $heatmap.Competitor }}</h2>
+		<table>
+			<tr>
+				<th>Measure</th>
+				{{ range $scenario := $scenarios }}<th><a href="{{ pageUrl $scenario }}">{{ $scenario }}</a></th>{{ end }}
+			</tr>
+			{{ range $row := $heatmap.Rows }}
+			<tr>
+				<td>{{ $row.Metric }}</td>
+				{{ range $cell := $row.Cells }}
+				{{ if $cell.Found }}
+				<td class="diff" style="background: {{ $cell.Color }}" title="{{ $cell.Scenario }}: {{ printf "%.2f" $cell.Baseline }} vs {{ printf "%.2f" $cell.Competitor }}">{{ printf "%+.0f" $cell.DiffPercent }}%</td>
+				{{ else }}
+				<td></td>
+				{{ end }}
+				{{ end }}
+			</tr>
+			{{ end }}
+		</table>
+		{{ else }}
+		<strong>no competitors of {{ .Baseline }}</strong>
+		{{ end }}
+	</body>
+</html>`
+
+const scenarioReportPageTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8">
+		<title>{{ .Scenario }}</title>
+		<style>
+			table { border-collapse: collapse; margin-bottom: 20px; }
+			td, th { border: 1px solid #ccc; padding: 2px 6px; }
+			td.value { text-align: right; }
+		</style>
+	</head>
+	<body>
+		<p><a href="scenarios.html">All scenarios</a></p>
+		<h2>{{ .Scenario }}</h2>
+		<table>
+			<tr>
+				<th>Measure</th>
+				{{ range $browser := .Browsers }}<th>{{ $browser }}</th>{{ end }}
+			</tr>
+			{{ range $row := .Medians }}
+			<tr>
+				<td>{{ $row.Metric }}</td>
+				{{ range $median := $row.Medians }}<td class="value">{{ $median }}</td>{{ end }}
+			</tr>
+			{{ end }}
+		</table>
+		{{ range $chart := .Charts }}
+		<p><img src="{{ fileUrl $chart }}" alt="{{ $chart }}"></p>
+		{{ end }}
+	</body>
+</html>`
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Composite efficiency score: weighted geometric mean of metrics normalized to baseline browser,
+// baseline has score 100 and bigger score is better
+const scoreReport = "score"
+
+// File of -scoreConfig, "measure" is a chart name without scenario or its prefix,
+// all charts matched by prefix are one metric, metric without charts is reported as data quality issue:
+//
+//	{
+//		"baseline": "browser.exe",
+//		"scenarios": ["yandexyarunewtab", "youtube"],
+//		"metrics": [
+//			{"name": "Energy", "measure": "Intel Power Cumulative Processor Energy", "weight": 3},
+//			{"name": "CPU", "measure": "procfs CPU Time (ms)", "weight": 2},
+//			{"name": "Speedometer", "measure": "benchmarkSpeedometer Score", "weight": 1, "biggerIsBetter": true}
+//		]
+//	}
+type scoreConfig struct {
+	// Default: Yandex Browser
+	Baseline string `json:"baseline"`
+	// Default: all scenarios
+	Scenarios []string            `json:"scenarios"`
+	Metrics   []scoreConfigMetric `json:"metrics"`
+}
+
+type scoreConfigMetric struct {
+	Name    string  `json:"name"`
+	Measure string  `json:"measure"`
+	Weight  float64 `json:"weight"`
+	// Default: direction of diff bars
+	BiggerIsBetter *bool `json:"biggerIsBetter"`
+}
+
+type scoreMetric struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	// Geometric mean of baseline/browser ratios in percent, 100 is baseline
+	Normalized float64 `json:"normalized"`
+	// Count of charts and scenarios the metric is averaged over
+	Values  int  `json:"values"`
+	Missing bool `json:"missing"`
+	// Share of metric in log of score
+	ContributionPercent float64 `json:"contributionPercent"`
+}
+
+type scoreBrowser struct {
+	Browser string        `json:"browser"`
+	Score   float64       `json:"score"`
+	Metrics []scoreMetric `json:"metrics"`
+}
+
+// Scores of browsers in order of report browsers when weight of metric is changed
+type scoreSensitivity struct {
+	Metric             string    `json:"metric"`
+	Without            []float64 `json:"without"`
+	Doubled            []float64 `json:"doubled"`
+	RankChangesWithout bool      `json:"rankChangesWithout"`
+	RankChangesDoubled bool      `json:"rankChangesDoubled"`
+	MaxScoreChange     float64   `json:"maxScoreChange"`
+}
+
+type scoreResult struct {
+	Baseline    string             `json:"baseline"`
+	Scenarios   []string           `json:"scenarios"`
+	Browsers    []scoreBrowser     `json:"browsers"`
+	Sensitivity []scoreSensitivity `json:"sensitivity"`
+}
+
+func loadScoreConfig(configPath string) (scoreConfig, error) {
+	config := scoreConfig{}
+	content, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(content, &config)
+	if err != nil {
+		return config, fmt.Errorf("failed to decode %s: %s", configPath, err)
+	}
+
+	if config.Baseline == "" {
+		config.Baseline = yaBrowserProcessName
+	}
+	if len(config.Metrics) == 0 {
+		return config, fmt.Errorf("%s: no metrics", configPath)
+	}
+	for _, metric := range config.Metrics {
+		if metric.Name == "" || metric.Measure == "" {
+			return config, fmt.Errorf("%s: metric must have name and measure: %+v", configPath, metric)
+		}
+		if metric.Weight <= 0 {
+			return config, fmt.Errorf("%s: weight of %s must be positive", configPath, metric.Name)
+		}
+	}
+
+	return config, nil
+}
+
+// Writes score.json and score.html to PNG directory, uses measures collected for scenario report
+func generateScoreReport() error {
+	config, err := loadScoreConfig(*scoreConfigPath)
+	if err != nil {
+		return err
+	}
+
+	result := scoreResult{Baseline: config.Baseline, Scenarios: config.Scenarios}
+	if len(result.Scenarios) == 0 {
+		scenarioSet := map[string]bool{}
+		for _, metric := range scenarioReportMetrics {
+			for scenario := range metric.values {
+				scenarioSet[scenario] = true
+			}
+		}
+		result.Scenarios = scenarioSortedKeys(scenarioSet)
+	}
+
+	browserSet := map[string]bool{}
+	for _, metric := range scenarioReportMetrics {
+		for _, scenario := range result.Scenarios {
+			for browser := range metric.values[scenario] {
+				browserSet[browser] = true
+			}
+		}
+	}
+	if !browserSet[config.Baseline] {
+		return fmt.Errorf("no measures of baseline %s", config.Baseline)
+	}
+
+	weights := []float64{}
+	for _, configMetric := range config.Metrics {
+		weights = append(weights, configMetric.Weight)
+		if !scoreHasCharts(configMetric) {
+			dataQualityAdd(dataQualityUnmatchedMetric, *scoreConfigPath, Measure{},
+				"score metric %s: measure '%s' matches no chart", configMetric.Name, configMetric.Measure)
+		}
+	}
+
+	for _, browser := range scenarioSortedKeys(browserSet) {
+		b := scoreBrowser{Browser: browser}
+		for _, configMetric := range config.Metrics {
+			b.Metrics = append(b.Metrics, scoreGetMetric(config, configMetric, result.Scenarios, browser))
+		}
+		b.Score = scoreGetScore(b.Metrics, weights)
+		totalLog := math.Log(b.Score / 100)
+		weightSum := scoreGetWeightSum(b.Metrics, weights)
+		for i := range b.Metrics {
+			if b.Metrics[i].Missing || totalLog == 0 {
+				continue
+			}
+			b.Metrics[i].ContributionPercent = b.Metrics[i].Weight * math.Log(b.Metrics[i].Normalized/100) / weightSum / totalLog * 100
+		}
+		result.Browsers = append(result.Browsers, b)
+	}
+	sort.SliceStable(result.Browsers, func(i, j int) bool {
+		return result.Browsers[i].Score > result.Browsers[j].Score
+	})
+
+	for i, configMetric := range config.Metrics {
+		s := scoreSensitivity{Metric: configMetric.Name}
+		without := append([]float64{}, weights...)
+		without[i] = 0
+		doubled := append([]float64{}, weights...)
+		doubled[i] *= 2
+		for _, b := range result.Browsers {
+			s.Without = append(s.Without, scoreGetScore(b.Metrics, without))
+			s.Doubled = append(s.Doubled, scoreGetScore(b.Metrics, doubled))
+			s.MaxScoreChange = math.Max(s.MaxScoreChange, math.Abs(s.Without[len(s.Without)-1]-b.Score))
+			s.MaxScoreChange = math.Max(s.MaxScoreChange, math.Abs(s.Doubled[len(s.Doubled)-1]-b.Score))
+		}
+		s.RankChangesWithout = !sort.SliceIsSorted(s.Without, func(i, j int) bool { return s.Without[i] > s.Without[j] })
+		s.RankChangesDoubled = !sort.SliceIsSorted(s.Doubled, func(i, j int) bool { return s.Doubled[i] > s.Doubled[j] })
+		result.Sensitivity = append(result.Sensitivity, s)
+	}
+
+	for _, b := range result.Browsers {
+		fmt.Printf("Composite score %s %.1f\n", b.Browser, b.Score)
+	}
+
+	reportJsonFileName := scoreReport + ".json"
+	reportJsonFile, err := os.Create(filepath.Join(*pngPath, reportJsonFileName))
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(reportJsonFile).Encode(result)
+	if err != nil {
+		reportJsonFile.Close()
+		return fmt.Errorf("failed to json encode %s: %s", reportJsonFileName, err)
+	}
+	err = ioClose(reportJsonFileName, reportJsonFile)
+	if err != nil {
+		return err
+	}
+
+	return scenarioReportWriteHtml(scoreReport+".html", scoreReportTpl, result)
+}
+
+// Geometric mean over all charts matched by metric and scenarios with both baseline and browser measures
+func scoreGetMetric(config scoreConfig, configMetric scoreConfigMetric, scenarios []string, browser string) scoreMetric {
+	metric := scoreMetric{Name: configMetric.Name, Weight: configMetric.Weight}
+
+	sumLog := 0.0
+	for name, m := range scenarioReportMetrics {
+		if !scoreMatchesChart(configMetric, name) {
+			continue
+		}
+		for _, scenario := range scenarios {
+			values := m.values[scenario]
+			if len(values[config.Baseline]) == 0 || len(values[browser]) == 0 {
+				continue
+			}
+			baseline := median(values[config.Baseline])
+			val := median(values[browser])
+			if baseline <= 0 || val <= 0 {
+				continue
+			}
+
+			biggerIsBetter := excludedFromBad[m.fullSetNames[scenario]]
+			if configMetric.BiggerIsBetter != nil {
+				biggerIsBetter = *configMetric.BiggerIsBetter
+			}
+			if biggerIsBetter {
+				sumLog += math.Log(val / baseline)
+			} else {
+				sumLog += math.Log(baseline / val)
+			}
+			metric.Values++
+		}
+	}
+
+	if metric.Values == 0 {
+		metric.Missing = true
+		return metric
+	}
+	metric.Normalized = math.Exp(sumLog/float64(metric.Values)) * 100
+
+	return metric
+}
+
+func scoreHasCharts(configMetric scoreConfigMetric) bool {
+	for name := range scenarioReportMetrics {
+		if scoreMatchesChart(configMetric, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Measure is prefix of chart name, whitespace is not significant
+func scoreMatchesChart(configMetric scoreConfigMetric, name string) bool {
+	measure := strings.Join(strings.Fields(configMetric.Measure), " ")
+	return strings.HasPrefix(strings.Join(strings.Fields(name), " "), measure)
+}
+
+// Missing metrics are excluded, weights of other metrics are not changed
+func scoreGetScore(metrics []scoreMetric, weights []float64) float64 {
+	sumLog := 0.0
+	for i, metric := range metrics {
+		if metric.Missing {
+			continue
+		}
+		sumLog += weights[i] * math.Log(metric.Normalized/100)
+	}
+	weightSum := scoreGetWeightSum(metrics, weights)
+	if weightSum == 0 {
+		return 0
+	}
+
+	return math.Exp(sumLog/weightSum) * 100
+}
+
+func scoreGetWeightSum(metrics []scoreMetric, weights []float64) float64 {
+	sum := 0.0
+	for i, metric := range metrics {
+		if !metric.Missing {
+			sum += weights[i]
+		}
+	}
+	return sum
+}
+
+const scoreReportTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8">
+		<title>Composite Score</title>
+		<style>
+			table { border-collapse: collapse; margin-bottom: 20px; }
+			td, th { border: 1px solid #ccc; padding: 2px 6px; }
+			td.value { text-align: right; }
+			.missing { color: #999999; }
+			.rank { background: #ffe0e0; }
+		</style>
+	</head>
+	<body>
+		<p>Weighted geometric mean of metrics normalized to {{ .Baseline }}, {{ .Baseline }} is 100, bigger is better.
+		Scenarios: {{ range $i, $scenario := .Scenarios }}{{ if $i }}, {{ end }}{{ $scenario }}{{ end }}</p>
+		<h2>Score</h2>
+		<table>
+			<tr><th>Browser</th><th>Score</th></tr>
+			{{ range $browser := .Browsers }}
+			<tr><td>{{ $browser.Browser }}</td><td class="value"><b>{{ printf "%.1f" $browser.Score }}</b></td></tr>
+			{{ end }}
+		</table>
+		<h2>Breakdown</h2>
+		<table>
+			<tr><th>Browser</th><th>Metric</th><th>Weight</th><th>Normalized</th><th>Values</th><th>Contribution</th></tr>
+			{{ range $browser := .Browsers }}
+			{{ range $metric := $browser.Metrics }}
+			<tr {{ if $metric.Missing }}class="missing"{{ end }}>
+				<td>{{ $browser.Browser }}</td>
+				<td>{{ $metric.Name }}</td>
+				<td class="value">{{ $metric.Weight }}</td>
+				{{ if $metric.Missing }}
+				<td colspan="3">missing, excluded from score</td>
+				{{ else }}
+				<td class="value">{{ printf "%.1f" $metric.Normalized }}</td>
+				<td class="value">{{ $metric.Values }}</td>
+				<td class="value">{{ printf "%.0f" $metric.ContributionPercent }}%</td>
+				{{ end }}
+			</tr>
+			{{ end }}
+			{{ end }}
+		</table>
+		<h2>Sensitivity to weights</h2>
+		<table>
+			<tr>
+				<th>Metric</th><th>Weight</th>
+				{{ range $browser := .Browsers }}<th>{{ $browser.Browser }}</th>{{ end }}
+				<th>Max score change</th>
+			</tr>
+			{{ range $s := .Sensitivity }}
+			<tr {{ if $s.RankChangesWithout }}class="rank"{{ end }}>
+				<td>{{ $s.Metric }}</td><td>0</td>
+				{{ range $score := $s.Without }}<td class="value">{{ printf "%.1f" $score }}</td>{{ end }}
+				<td rowspan="2" class="value">{{ printf "%.1f" $s.MaxScoreChange }}</td>
+			</tr>
+			<tr {{ if $s.RankChangesDoubled }}class="rank"{{ end }}>
+				<td>{{ $s.Metric }}</td><td>x2</td>
+				{{ range $score := $s.Doubled }}<td class="value">{{ printf "%.1f" $score }}</td>{{ end }}
+			</tr>
+			{{ end }}
+		</table>
+		<p>Highlighted rows change ranking of browsers.</p>
+	</body>
+</html>`
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateScoreReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "score.json")
+	err = ioutil.WriteFile(configPath, []byte(`{
+		"baseline": "browser.exe",
+		"metrics": [
+			{"name": "Energy", "measure": "Intel Power Cumulative Processor Energy", "weight": 3},
+			{"name": "Old energy", "measure": "intelPowerLog Cumulative Processor Energy", "weight": 1}
+		]
+	}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldConfigPath, oldPngPath, oldMetrics, oldIssues := *scoreConfigPath, *pngPath, scenarioReportMetrics, dataQualityIssues
+	defer func() {
+		*scoreConfigPath, *pngPath, scenarioReportMetrics, dataQualityIssues = oldConfigPath, oldPngPath, oldMetrics, oldIssues
+	}()
+	*scoreConfigPath, *pngPath = configPath, dir
+	scenarioReportMetrics = map[string]*scenarioMetric{}
+	scenarioReportAddMeasure("youtube Intel Power", Measure{measureSet: intelPowerMeasureSet, measureName: "Cumulative Processor Energy_0 (Joules)", browser: "browser.exe", scenarioName: "youtube", value: 100})
+	scenarioReportAddMeasure("youtube Intel Power", Measure{measureSet: intelPowerMeasureSet, measureName: "Cumulative Processor Energy_0 (Joules)", browser: "chrome.exe", scenarioName: "youtube", value: 50})
+
+	err = generateScoreReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, scoreReport+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := scoreResult{}
+	err = json.Unmarshal(content, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := map[string]float64{}
+	for _, b := range result.Browsers {
+		scores[b.Browser] = b.Score
+		if len(b.Metrics) != 2 || b.Metrics[0].Missing || !b.Metrics[1].Missing {
+			t.Errorf("%s: got metrics %+v", b.Browser, b.Metrics)
+		}
+	}
+	if scores["browser.exe"] != 100 || scores["chrome.exe"] != 200 {
+		t.Errorf("got scores %v, expected browser.exe 100 and chrome.exe 200", scores)
+	}
+
+	issues := dataQualityIssues[len(oldIssues):]
+	if len(issues) != 1 || issues[0].Kind != dataQualityUnmatchedMetric {
+		t.Errorf("got data quality issues %v, expected one %s", issues, dataQualityUnmatchedMetric)
+	}
+}
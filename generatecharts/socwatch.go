@@ -2,10 +2,12 @@ package main
 
 import (
 	"bufio"
+	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -44,8 +46,108 @@ const (
 		1.0ms               , 8                           , 114                           , 6
 		Total               , 8                           , 114                           , 6
 	*/
+	socWatchPackageCStateResidency = "Package C-State Summary: Residency (Percentage and Time)"
+	/*
+		State     , Residency (%), Residency (msec)
+		----------, -------------, ----------------
+		PC0       , 23.61        , 2361.13
+		PC2       , 10.02        , 1001.87
+		PC6       , 0.00         , 0.00
+		PC10      , 66.37        , 6637.19
+	*/
+	socWatchCorePStateResidency = "Core P-State/Frequency Summary: Residency (Percentage)"
+	/*
+		P-State (MHz), Core_0 (%), Core_1 (%), Core_2 (%), Core_3 (%)
+		-------------, ----------, ----------, ----------, ----------
+		3400         , 2.11      , 1.07      , 0.98      , 1.75
+		800          , 10.86     , 6.47      , 3.82      , 5.09
+		Idle         , 87.03     , 92.46     , 95.20     , 93.16
+	*/
+	socWatchGpuRenderCStateResidency = "Integrated Graphics C-State Summary: Residency (Percentage and Time)"
+	/*
+		C-State, Residency (%), Residency (msec)
+		-------, -------------, ----------------
+		RC0    , 4.77         , 477.12
+		RC6    , 95.23        , 9523.20
+	*/
+	socWatchWakeupSources = "Wakeup Sources Summary: Counts"
+	/*
+		Wakeup Source  , Count , Rate (per sec)
+		---------------, ------, --------------
+		Timer          , 8521  , 852.10
+		Interrupt: i8042, 14   , 1.40
+		IPI            , 2301  , 230.10
+	*/
 )
 
+type socWatchSection struct {
+	// Section header variants of different SocWatch versions
+	titles []string
+	// Least columns of rows read by parse, shorter rows are dropped before parse
+	columns int
+	parse   func([][]string, Measure) []Measure
+}
+
+var socWatchSections = []socWatchSection{
+	{
+		titles:  []string{socWatchWakeupAnalysisContextSwitchStatistics},
+		columns: 5,
+		parse:   socWatchWakeupAnalysisContextSwitchStatisticsFunc,
+	},
+	{
+		titles:  []string{socWatchWakeupAnalysisProcessesBusyDuration},
+		columns: 7,
+		parse:   socWatchWakeupAnalysisProcessesBusyDurationFunc,
+	},
+	{
+		titles:  []string{socWatchWakeupAnalysisTimerResolutionRequestsTime},
+		columns: 2,
+		parse:   socWatchWakeupAnalysisTimerResolutionRequestsTimeFunc,
+	},
+	{
+		titles:  []string{socWatchWakeupAnalysisTimerResolutionRequestsCount},
+		columns: 2,
+		parse:   socWatchWakeupAnalysisTimerResolutionRequestsCountFunc,
+	},
+	{
+		titles: []string{
+			socWatchPackageCStateResidency,
+			"Package C-State Summary: Residency (Percentage)",
+			"Platform Package C-State Summary: Residency (Percentage and Time)",
+		},
+		columns: 1,
+		parse:   socWatchSummaryTableFunc("Package C-State"),
+	},
+	{
+		titles: []string{
+			socWatchCorePStateResidency,
+			"CPU P-State/Frequency Summary: Residency (Percentage)",
+			"Core P-State/Frequency Summary: Residency (Percentage and Time)",
+		},
+		columns: 1,
+		parse:   socWatchCorePStateResidencyFunc,
+	},
+	{
+		titles: []string{
+			socWatchGpuRenderCStateResidency,
+			"GPU C-State Summary: Residency (Percentage and Time)",
+			"Graphics C-State Summary: Residency (Percentage and Time)",
+			"Integrated Graphics C-State Summary: Residency (Percentage)",
+		},
+		columns: 1,
+		parse:   socWatchSummaryTableFunc("GPU Render C-State"),
+	},
+	{
+		titles: []string{
+			socWatchWakeupSources,
+			"Wakeup Sources Summary",
+			"CPU Wakeup Sources Summary: Counts",
+		},
+		columns: 1,
+		parse:   socWatchSummaryTableFunc("Wakeups"),
+	},
+}
+
 func generateChartsForSocWatchFiles(files []os.FileInfo) error {
 	var measures []Measure
 
@@ -83,24 +185,57 @@ func generateChartsForSocWatchFiles(files []os.FileInfo) error {
 }
 
 func socWatchGetMeasures(csvFilePath string) ([]Measure, error) {
-	csvFile, err := os.Open(csvFilePath)
+	metaMeasure, err := generalGetFileMeta(csvFilePath)
 	if err != nil {
 		return nil, err
 	}
-	defer csvFile.Close()
 
-	metaMeasure, err := generalGetFileMeta(csvFilePath)
+	data, err := socWatchReadFile(csvFilePath)
 	if err != nil {
 		return nil, err
 	}
 
-	dataParts := map[string]string{
-		socWatchWakeupAnalysisContextSwitchStatistics:      "",
-		socWatchWakeupAnalysisTimerResolutionRequestsCount: "",
-		socWatchWakeupAnalysisTimerResolutionRequestsTime:  "",
-		socWatchWakeupAnalysisProcessesBusyDuration:        "",
+	//fmt.Printf("%#v\n", metaMeasure)
+	var msrs []Measure
+
+	for _, shortRow := range data.shortRows {
+		dataQualityAdd(dataQualityUnparseable, csvFilePath, metaMeasure, "%s", shortRow)
 	}
 
+	for sectionId, records := range data.sections {
+		if len(records) > 0 {
+			//fmt.Printf("%s \n %s \n %s:\n", csvFilePath, part)
+			tmpMsrs := socWatchSections[sectionId].parse(records, metaMeasure)
+			msrs = append(msrs, tmpMsrs...)
+		}
+	}
+
+	//fmt.Printf("%#v\n", msrs)
+	return msrs, nil
+}
+
+type socWatchFileData struct {
+	sections           map[int][][]string // socWatchSections index > section records
+	collectionDuration float64            // seconds, 0 if not found in header
+	shortRows          []string           // dropped rows with less columns than section has
+}
+
+// Total Collection Duration (sec): 60.02
+var socWatchCollectionDurationRegExp = regexp.MustCompile(`(?i)collection\s+(duration|time)[^0-9]*([0-9]+(\.[0-9]+)?)`)
+
+func socWatchReadFile(csvFilePath string) (socWatchFileData, error) {
+	data := socWatchFileData{
+		sections: map[int][][]string{},
+	}
+
+	csvFile, err := os.Open(csvFilePath)
+	if err != nil {
+		return data, err
+	}
+	defer csvFile.Close()
+
+	dataParts := map[int]string{} // socWatchSections index > section data
+
 	scanner := bufio.NewReader(csvFile)
 	for {
 		line, err := scanner.ReadString('\n')
@@ -112,52 +247,181 @@ func socWatchGetMeasures(csvFilePath string) ([]Measure, error) {
 			break
 		}
 
-		for part, _ := range dataParts {
-			if line == fmt.Sprintf("%s\n", part) || line == fmt.Sprintf("%s,\r\n", part) {
-				for {
-					dataline, err := scanner.ReadString('\n')
-					if err == io.EOF {
-						break
-					}
-					if err != nil {
-						fmt.Printf("in file: %s\nin part: %s:\nerror: %v\n", csvFilePath, part, err)
-						break
-					}
-					if dataline == "\r\n" || dataline == "\n" || dataline == "" {
-						break
-					}
-					//fmt.Printf("in file: %s\nin part: %s:\ndataline: %s\nerr: %v\n", csvFilePath, part, dataline, err)
-					dataParts[part] += strings.Trim(dataline, " ")
-				}
+		sectionId := socWatchGetSectionId(line)
+		if sectionId < 0 {
+			if match := socWatchCollectionDurationRegExp.FindStringSubmatch(line); data.collectionDuration == 0 && len(match) > 2 {
+				data.collectionDuration, _ = strconv.ParseFloat(match[2], 64)
+			}
+			continue
+		}
+
+		for {
+			dataline, err := scanner.ReadString('\n')
+			if err == io.EOF {
+				break
 			}
+			if err != nil {
+				fmt.Printf("in file: %s\nin part: %s:\nerror: %v\n", csvFilePath, socWatchSections[sectionId].titles[0], err)
+				break
+			}
+			if dataline == "\r\n" || dataline == "\n" || dataline == "" {
+				break
+			}
+			//fmt.Printf("in file: %s\nin part: %s:\ndataline: %s\nerr: %v\n", csvFilePath, part, dataline, err)
+			dataParts[sectionId] += strings.Trim(dataline, " ")
 		}
 	}
 
-	processParts := map[string]func([][]string, Measure) []Measure{
-		socWatchWakeupAnalysisContextSwitchStatistics:      socWatchWakeupAnalysisContextSwitchStatisticsFunc,
-		socWatchWakeupAnalysisTimerResolutionRequestsCount: socWatchWakeupAnalysisTimerResolutionRequestsCountFunc,
-		socWatchWakeupAnalysisTimerResolutionRequestsTime:  socWatchWakeupAnalysisTimerResolutionRequestsTimeFunc,
-		socWatchWakeupAnalysisProcessesBusyDuration:        socWatchWakeupAnalysisProcessesBusyDurationFunc,
+	for sectionId, part := range dataParts {
+		r := csv.NewReader(strings.NewReader(part))
+		r.FieldsPerRecord = -1 // Trailing comma is optional across SocWatch versions
+		records, err := r.ReadAll()
+		if err != nil {
+			fmt.Printf("%s\n%s\n%s\n", csvFilePath, socWatchSections[sectionId].titles[0], err)
+			continue
+		}
+		data.sections[sectionId] = socWatchDropShortRows(&data, sectionId, records)
 	}
 
-	//fmt.Printf("%#v\n", metaMeasure)
-	var msrs []Measure
+	return data, nil
+}
 
-	for part, f := range processParts {
-		records, err := getRecordsFromString(dataParts[part], ',')
-		if err != nil {
-			fmt.Printf("%s\n%s\n%s\n", csvFilePath, part, err)
+// Rows without columns read by parse of section are dropped
+func socWatchDropShortRows(data *socWatchFileData, sectionId int, records [][]string) [][]string {
+	section := socWatchSections[sectionId]
+	var kept [][]string
+	for i, row := range records {
+		if len(row) < section.columns {
+			data.shortRows = append(data.shortRows, fmt.Sprintf(
+				"%s row %d has %d columns, expected %d", strings.TrimRight(section.titles[0], ", "), i+1, len(row), section.columns,
+			))
 			continue
 		}
-		if len(records) > 0 {
-			//fmt.Printf("%s \n %s \n %s:\n", csvFilePath, part)
-			tmpMsrs := f(records, metaMeasure)
-			msrs = append(msrs, tmpMsrs...)
+		kept = append(kept, row)
+	}
+
+	return kept
+}
+
+// Returns index in socWatchSections of section with given title or -1
+func socWatchGetSectionIdByTitle(title string) int {
+	for sectionId, section := range socWatchSections {
+		if section.titles[0] == title {
+			return sectionId
 		}
 	}
 
-	//fmt.Printf("%#v\n", msrs)
-	return msrs, nil
+	return -1
+}
+
+// Returns index in socWatchSections of section started by line or -1
+func socWatchGetSectionId(line string) int {
+	normalized := socWatchNormalizeTitle(line)
+	if normalized == "" {
+		return -1
+	}
+	for sectionId, section := range socWatchSections {
+		for _, title := range section.titles {
+			if normalized == socWatchNormalizeTitle(title) {
+				return sectionId
+			}
+		}
+	}
+
+	return -1
+}
+
+// "Processes by Platform Busy Duration,\r\n" > "processes by platform busy duration"
+func socWatchNormalizeTitle(line string) string {
+	line = strings.TrimRight(line, "\r\n")
+	line = strings.TrimRight(line, ", ")
+	return strings.ToLower(strings.Join(strings.Fields(line), " "))
+}
+
+// Parses system wide "State, Value, Value" tables like C-State residency or wakeup sources.
+// Each numeric column becomes measure "<prefix> <state> <column header>"
+func socWatchSummaryTableFunc(prefix string) func([][]string, Measure) []Measure {
+	return func(records [][]string, meta Measure) []Measure {
+		var msrs []Measure
+		colState := 0
+		headers := records[0]
+		for index, row := range records {
+			if index == 0 || len(row) == 0 {
+				continue
+			}
+			state := strings.Trim(row[colState], " ")
+			if state == "" || strings.HasPrefix(state, "-") || state == "Total" {
+				continue
+			}
+			// Measure name becomes part of PNG file name, "Interrupt: i8042" is not valid one
+			state = strings.NewReplacer(":", "", "/", "-", `\`, "-").Replace(state)
+
+			for colId := colState + 1; colId < len(row) && colId < len(headers); colId++ {
+				header := strings.Trim(headers[colId], " ")
+				if header == "" {
+					continue
+				}
+				val, err := strconv.ParseFloat(strings.Trim(strings.Split(row[colId], "(")[0], " "), 64)
+				if err != nil {
+					fmt.Printf("failed parse '%s': %v\n", row[colId], err)
+					continue
+				}
+				m := meta
+				m.measureSet = socWatch
+				m.measureName = fmt.Sprintf("%s %s %s", prefix, state, header)
+				m.value = val
+				msrs = append(msrs, m)
+			}
+		}
+
+		return msrs
+	}
+}
+
+func socWatchCorePStateResidencyFunc(records [][]string, meta Measure) []Measure {
+	/*
+		P-State (MHz), Core_0 (%), Core_1 (%), Core_2 (%), Core_3 (%)
+		-------------, ----------, ----------, ----------, ----------
+		3400         , 2.11      , 1.07      , 0.98      , 1.75
+	*/
+	// Residency is averaged over all cores to keep one chart per frequency
+	var msrs []Measure
+	colFrequency := 0
+	for index, row := range records {
+		if index == 0 || len(row) == 0 {
+			continue
+		}
+		frequency := strings.Trim(row[colFrequency], " ")
+		if frequency == "" || strings.HasPrefix(frequency, "-") || frequency == "Total" {
+			continue
+		}
+
+		sum := 0.0
+		count := 0
+		for colId := colFrequency + 1; colId < len(row); colId++ {
+			if strings.Trim(row[colId], " \r\n") == "" {
+				continue
+			}
+			val, err := strconv.ParseFloat(strings.Trim(strings.Split(row[colId], "(")[0], " "), 64)
+			if err != nil {
+				fmt.Printf("failed parse '%s': %v\n", row[colId], err)
+				continue
+			}
+			sum += val
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+
+		m := meta
+		m.measureSet = socWatch
+		m.measureName = fmt.Sprintf("Core P-State %s Residency Average (%%)", frequency)
+		m.value = sum / float64(count)
+		msrs = append(msrs, m)
+	}
+
+	return msrs
 }
 
 func socWatchWakeupAnalysisProcessesBusyDurationFunc(records [][]string, meta Measure) []Measure {
@@ -255,6 +519,9 @@ func socWatchWakeupAnalysisTimerResolutionRequestsCountFunc(records [][]string,
 		}
 
 		for _, colId := range cols {
+			if colId >= len(row) {
+				continue
+			}
 			val, err := strconv.ParseFloat(strings.Trim(row[colId], " "), 64)
 			if err != nil {
 				fmt.Printf("failed parse '%s': %v\n", row[colId], err)
@@ -361,6 +628,9 @@ func socWatchWakeupAnalysisTimerResolutionRequestsTimeFunc(records [][]string, m
 		for _, browserProcessName := range meta.browserProcesses {
 			if strings.HasPrefix(row[colProcess], browserProcessName) {
 				for msrName, colId := range cols {
+					if colId >= len(row) {
+						continue
+					}
 					val, err := strconv.ParseFloat(strings.Trim(row[colId], " "), 64)
 					if err != nil {
 						fmt.Printf("failed parse '%s': %v\n", row[colId], err)
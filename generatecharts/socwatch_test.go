@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Rows are cut short like in files of interrupted collections
+const socWatchTestRaggedCsv = "Total Collection Duration (sec): 10.00\r\n" +
+	"\r\n" +
+	"Context Switch (in) Statistics\r\n" +
+	"Process,Total Context Switches,Caused Thread Wakeups,Caused Core Wakeups,Caused Package Wakeups,\r\n" +
+	"brodefault.exe(1232),7371,1434( 19.45%),274(  3.72%),31(  0.42%),\r\n" +
+	"brodefault.exe(8660),6822,286(  4.19%)\r\n" +
+	"\r\n" +
+	"Processes by Platform Busy Duration,\r\n" +
+	"Rank,Process Name (PID),CPU % (Platform),Duration in ms (Platform),CPU % (Logical),Duration in ms (Logical),CSwitches From Idle (per sec),\r\n" +
+	"6,brodefault.exe (8660),6.66,1004.54,1.74,1051.67,30.05,\r\n" +
+	"7,brodefault.exe (1232),5.87,884.20\r\n" +
+	"\r\n" +
+	"Timer Resolution Requests (OS) Summary: Entry Counts\r\n" +
+	"Requested Resolution, websrv.exe(3772) Entry Count, brodefault.exe(11248) Entry Count, brodefault.exe(6072) Entry Count\r\n" +
+	"--------------------, ----------------------------, ------------------------------, -----------------------------\r\n" +
+	"1.0ms               , 8                           , 114\r\n" +
+	"Total\r\n" +
+	"\r\n" +
+	"Timer Resolution Requests (OS) Summary: Residency (Time)\r\n" +
+	"Kernel/Application  , 1.0ms (msec), 2.0ms (msec)\r\n" +
+	"------------------  , ------------, ------------\r\n" +
+	"brodefault.exe(9608), 634.90\r\n" +
+	"brodefault.exe(8660)\r\n" +
+	"\r\n" +
+	"Package C-State Summary: Residency (Percentage and Time)\r\n" +
+	"State     , Residency (%), Residency (msec)\r\n" +
+	"----------, -------------, ----------------\r\n" +
+	"PC0       , 23.61\r\n" +
+	"PC10\r\n" +
+	"\r\n"
+
+func TestSocWatchGetMeasuresRaggedRows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	csvFilePath := filepath.Join(dir, "brodefault_youtube_1_socwatch_20180120_224843-1.csv")
+	err = ioutil.WriteFile(csvFilePath, []byte(socWatchTestRaggedCsv), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldIssues := dataQualityIssues
+	defer func() { dataQualityIssues = oldIssues }()
+
+	measures, err := socWatchGetMeasures(csvFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]float64{
+		"Total Context Switches":                  7371,
+		"Caused Thread Wakeups":                   1434,
+		"Caused Core Wakeups":                     274,
+		"Caused Package Wakeups":                  31,
+		"Duration in ms (Platform)":               1004.54,
+		"Duration in ms (Logical)":                1051.67,
+		"CSwitches From Idle (per sec)":           30.05,
+		"Timer Resolution Count 1.0ms":            114,
+		"Timer Resolution Requests  1.0ms (msec)": 634.90,
+		"Package C-State PC0 Residency (%)":       23.61,
+	}
+	got := map[string]float64{}
+	for _, m := range measures {
+		got[m.measureName] = m.value
+	}
+	for name, value := range expected {
+		if got[name] != value {
+			t.Errorf("%s: got %v, expected %v", name, got[name], value)
+		}
+	}
+	if len(got) != len(expected) {
+		t.Errorf("got measures %v, expected %v", got, expected)
+	}
+
+	// Short rows of context switches, busy duration, count and residency sections
+	shortRows := 0
+	for _, issue := range dataQualityIssues[len(oldIssues):] {
+		if issue.Kind == dataQualityUnparseable {
+			shortRows++
+		}
+	}
+	if shortRows != 4 {
+		t.Errorf("got %d short rows, expected 4", shortRows)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/csv"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,20 +12,40 @@ import (
 
 func generateChartsForSrumFiles(files []os.FileInfo) error {
 	measures := []Measure{}
+	var intervals []srumInterval
 
 	for _, f := range files {
 		//fmt.Println(f.Name(), filepath.Ext(f.Name()))
-		if filepath.Ext(f.Name()) != ".csv" {
+		if !strings.Contains(f.Name(), "_srum_") {
 			continue
 		}
 
-		if strings.Contains(f.Name(), "_srum_") {
-			m, err := srumGetMeasures(filepath.Join(*csvPath, f.Name()))
-			if err != nil {
-				fmt.Printf("srum %s err %v", f.Name(), err)
-				return err
-			}
-			measures = append(measures, m...)
+		var i []srumInterval
+		var err error
+		switch filepath.Ext(f.Name()) {
+		case ".csv":
+			i, err = srumGetIntervals(filepath.Join(*csvPath, f.Name()))
+		case ".dat":
+			i, err = srumDbGetIntervals(filepath.Join(*csvPath, f.Name()))
+		default:
+			continue
+		}
+		if err != nil {
+			fmt.Printf("srum %s err %v", f.Name(), err)
+			return err
+		}
+		if len(i) == 0 {
+			dataQualityAdd(dataQualityTimestamp, f.Name(), Measure{}, "no SRUM intervals in run window")
+		}
+		measures = append(measures, srumSumIntervals(i)...)
+		intervals = append(intervals, i...)
+	}
+
+	if len(intervals) > 0 {
+		err := srumWriteIntervals(intervals)
+		if err != nil {
+			fmt.Printf("srum intervals err %v", err)
+			return err
 		}
 	}
 
@@ -49,105 +70,249 @@ func generateChartsForSrumFiles(files []os.FileInfo) error {
 }
 
 const (
-	srumMeasureSet                            = "srum"
-	srumColIdAppId                            = 0
-	srumColIdTimeStamp                        = 2
-	srumColIdEnergyLoss                       = 12
-	srumColIdCPUEnergyConsumption             = 13
-	srumColIdSocEnergyConsumption             = 14
-	srumColIdDisplayEnergyConsumption         = 15
-	srumColIdDiskEnergyConsumption            = 16
-	srumColIdNetworkEnergyConsumption         = 17
-	srumColIdMBBEnergyConsumption             = 18
-	srumColIdOtherEnergyConsumption           = 19
-	srumColIdEmiEnergyConsumption             = 20
-	srumColIdCPUEnergyConsumptionWorkOnBehalf = 21
-	srumColIdCPUEnergyConsumptionAttributed   = 22
+	srumMeasureSet           = "srum"
+	srumColAppId             = "AppId"
+	srumColTimeStamp         = "TimeStamp"
+	srumIntervalsCsvFileName = "srumIntervals.csv"
 )
 
-var srumMeasures = map[string]int{
-	"EnergyLoss":                       srumColIdEnergyLoss,
-	"CPUEnergyConsumption":             srumColIdCPUEnergyConsumption,
-	"SocEnergyConsumption":             srumColIdSocEnergyConsumption,
-	"DisplayEnergyConsumption":         srumColIdDisplayEnergyConsumption,
-	"DiskEnergyConsumption":            srumColIdDiskEnergyConsumption,
-	"NetworkEnergyConsumption":         srumColIdNetworkEnergyConsumption,
-	"MBBEnergyConsumption":             srumColIdMBBEnergyConsumption,
-	"OtherEnergyConsumption":           srumColIdOtherEnergyConsumption,
-	"EmiEnergyConsumption":             srumColIdEmiEnergyConsumption,
-	"CPUEnergyConsumptionWorkOnBehalf": srumColIdCPUEnergyConsumptionWorkOnBehalf,
-	"CPUEnergyConsumptionAttributed":   srumColIdCPUEnergyConsumptionAttributed,
+// Energy columns of SRUM "Energy Usage" export
+var srumMeasures = []string{
+	"EnergyLoss",
+	"CPUEnergyConsumption",
+	"SocEnergyConsumption",
+	"DisplayEnergyConsumption",
+	"DiskEnergyConsumption",
+	"NetworkEnergyConsumption",
+	"MBBEnergyConsumption",
+	"OtherEnergyConsumption",
+	"EmiEnergyConsumption",
+	"CPUEnergyConsumptionWorkOnBehalf",
+	"CPUEnergyConsumptionAttributed",
+}
+
+// Energy of browser in one SRUM interval
+type srumInterval struct {
+	meta      Measure
+	timeStamp time.Time
+	values    map[string]float64
 }
 
-//
 func srumGetMeasures(csvFilePath string) ([]Measure, error) {
+	intervals, err := srumGetIntervals(csvFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return srumSumIntervals(intervals), nil
+}
+
+func srumSumIntervals(intervals []srumInterval) []Measure {
 	msrs := []Measure{}
+	accum := map[string]float64{}
+	var metaMeasure Measure
+	for _, interval := range intervals {
+		metaMeasure = interval.meta
+		for measureName, val := range interval.values {
+			accum[measureName] += val
+		}
+	}
+
+	for measureName, measureVal := range accum {
+		if measureVal == 0 {
+			dataQualityAdd(dataQualityZeroValue, metaMeasure.measureSet, metaMeasure, "%s is dropped", measureName)
+			continue
+		}
+		m := metaMeasure
+		m.measureName = measureName
+		m.value = measureVal
+		msrs = append(msrs, m)
+	}
+
+	//fmt.Printf("%#v\n", msrs)
+	return msrs
+}
 
+func srumGetIntervals(csvFilePath string) ([]srumInterval, error) {
 	csvFile, err := os.Open(csvFilePath)
 	if err != nil {
-		return msrs, err
+		return nil, err
 	}
+	defer csvFile.Close()
 
 	metaMeasure, err := srumGetFileMeta(csvFilePath)
 	if err != nil {
 		return nil, err
 	}
-	accum := map[string]float64{}
+	start, end, appIds, err := srumGetRunWindow(metaMeasure)
+	if err != nil {
+		return nil, err
+	}
 
-	records, err := getRecordsFromCsvFile(csvFile, ',')
+	r := csv.NewReader(csvFile)
+	r.FieldsPerRecord = -1 // Export may start with lines before header
+	records, err := r.ReadAll()
 	if err != nil {
-		return nil, fmt.Errorf("srumGetMeasures.getRecordsFromCsvFile %s err %v\n", csvFilePath, err)
+		return nil, fmt.Errorf("srumGetIntervals: %s: %v", csvFilePath, err)
 	}
 
-	//fmt.Printf("%#v\n", metaMeasure)
-	for i := len(records) - 1; i >= 0; i-- {
-		line := records[i]
-		//fmt.Printf("%s\n", line[srumColIdTimeStamp])
-		if line[srumColIdTimeStamp] == " TimeStamp" {
-			break
+	// Export has a table per SRUM provider, rows of energy table follow header with all its columns
+	var cols map[string]int
+	headerFound := false
+	var intervals []srumInterval
+	for i, line := range records {
+		if header, isHeader := srumGetHeaderColumns(line); isHeader {
+			cols = header
+			headerFound = headerFound || cols != nil
+			continue
+		}
+		if cols == nil {
+			continue
+		}
+		if len(line) < len(cols) {
+			return nil, fmt.Errorf("srumGetIntervals: %s: row %d has %d columns, header has %d", csvFilePath, i+1, len(line), len(cols))
 		}
 
-		// 2017-12-11:01:30:30.0000
-		t, err := time.Parse("2006-01-02:15:04:05.0000", strings.Trim(line[srumColIdTimeStamp], " "))
-		if err != nil {
-			return nil, err
+		if !srumAppIdMatches(line[cols[srumColAppId]], metaMeasure.browserProcesses, appIds) {
+			continue
 		}
 
-		//fmt.Printf("Meta: %s Measure: %s\n", metaMeasure.date.String(), t.String())
-		if t.Before(metaMeasure.date) {
-			break
+		// 2017-12-11:01:30:30.0000 in local time like file name date
+		t, err := time.ParseInLocation("2006-01-02:15:04:05.0000", strings.Trim(line[cols[srumColTimeStamp]], " "), time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("srumGetIntervals: %s: row %d: %v", csvFilePath, i+1, err)
 		}
 
-		if !strings.Contains(line[srumColIdAppId], metaMeasure.browser) {
+		//fmt.Printf("Meta: %s Measure: %s\n", metaMeasure.date.String(), t.String())
+		if t.Before(start) || (!end.IsZero() && t.After(end)) {
 			continue
 		}
 
-		for measureName, colId := range srumMeasures {
-			val, err := strconv.ParseFloat(strings.Trim(line[colId], " "), 64)
+		interval := srumInterval{
+			meta:      metaMeasure,
+			timeStamp: t,
+			values:    map[string]float64{},
+		}
+		for _, measureName := range srumMeasures {
+			val, err := strconv.ParseFloat(strings.Trim(line[cols[measureName]], " "), 64)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("srumGetIntervals: %s: row %d column %s: %v", csvFilePath, i+1, measureName, err)
 			}
+			interval.values[measureName] += val
+		}
+		intervals = append(intervals, interval)
+	}
+	if !headerFound {
+		return nil, fmt.Errorf("srumGetIntervals: %s: header with %s and %s columns not found", csvFilePath, srumColTimeStamp, strings.Join(srumMeasures, ", "))
+	}
 
-			accum[measureName] += val
+	return intervals, nil
+}
+
+// Row with TimeStamp column is header of table, columns are nil if table is not energy one
+func srumGetHeaderColumns(line []string) (map[string]int, bool) {
+	cols := map[string]int{}
+	for colId, colTitle := range line {
+		cols[strings.Trim(colTitle, " ")] = colId
+	}
+	if _, found := cols[srumColTimeStamp]; !found {
+		return nil, false
+	}
+	for _, colTitle := range append([]string{srumColAppId, srumColTimeStamp}, srumMeasures...) {
+		if _, found := cols[colTitle]; !found {
+			return nil, true
 		}
 	}
+	return cols, true
+}
 
-	for measureName, measureVal := range accum {
-		if measureVal == 0 {
-			continue
+// Window is taken from run manifest, otherwise starts at file name date and is open ended
+func srumGetRunWindow(meta Measure) (time.Time, time.Time, []string, error) {
+	start := meta.date
+	end := time.Time{}
+
+	manifest, err := loadRunManifest()
+	if err != nil {
+		return start, end, nil, err
+	}
+	appIds := manifest.Browsers[meta.browserShortName].SrumAppIds
+	for _, run := range manifest.Runs {
+		if run.Browser == meta.browserShortName && run.Scenario == meta.scenarioName && run.Iteration == meta.iteration {
+			if !run.Start.IsZero() {
+				start = run.Start
+			}
+			end = run.End
+			break
 		}
-		m := metaMeasure
-		m.measureName = measureName
-		m.value = measureVal
-		msrs = append(msrs, m)
 	}
 
-	//fmt.Printf("%#v\n", msrs)
-	return msrs, nil
+	return start, end, appIds, nil
+}
+
+// AppId is full path like "\Device\HarddiskVolume4\Program Files (x86)\Google\Chrome\Application\chrome.exe".
+// Matches exactly one of configured AppIds or by executable file name of browser processes.
+func srumAppIdMatches(appId string, browserProcesses []string, appIds []string) bool {
+	appId = strings.Trim(appId, " ")
+	if len(appIds) > 0 {
+		for _, expected := range appIds {
+			if strings.EqualFold(appId, expected) {
+				return true
+			}
+		}
+		return false
+	}
+
+	executable := appId[strings.LastIndexAny(appId, `\/`)+1:]
+	for _, browserProcessName := range browserProcesses {
+		if strings.EqualFold(executable, browserProcessName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func srumWriteIntervals(intervals []srumInterval) error {
+	csvFilePath := filepath.Join(*csvPath, srumIntervalsCsvFileName)
+	csvFile, err := os.Create(csvFilePath)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(csvFile)
+	columns := append(append([]string{}, srumMeasures...), srumAppResourceMeasures...)
+	err = w.Write(append([]string{"browser", "scenario", "iteration", srumColTimeStamp}, columns...))
+	if err != nil {
+		csvFile.Close()
+		return err
+	}
+	for _, interval := range intervals {
+		row := []string{
+			interval.meta.browserShortName,
+			interval.meta.scenarioName,
+			interval.meta.iteration,
+			interval.timeStamp.Format(time.RFC3339),
+		}
+		for _, measureName := range columns {
+			row = append(row, strconv.FormatFloat(interval.values[measureName], 'f', -1, 64))
+		}
+		err = w.Write(row)
+		if err != nil {
+			csvFile.Close()
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		csvFile.Close()
+		return err
+	}
+
+	return ioClose(csvFilePath, csvFile)
 }
 
-func srumGetFileMeta(csvFilePath string) (Measure, error) {
-	base := filepath.Base(csvFilePath)
+func srumGetFileMeta(filePath string) (Measure, error) {
+	base := filepath.Base(filePath)
 	fileMetaTokens := strings.Split(base, "_")
 	m := Measure{}
 	if len(fileMetaTokens) != 6 {
@@ -155,13 +320,16 @@ func srumGetFileMeta(csvFilePath string) (Measure, error) {
 	}
 	// chrome_yandexstaticfavicon_0_srum_20171217_010658.csv
 	m.browser = browserNameToProcessName[fileMetaTokens[0]]
+	m.browserShortName = fileMetaTokens[0]
+	m.browserProcesses = browserShortNameToProcesses[m.browserShortName]
 	m.scenarioName = fileMetaTokens[1]
 	m.iteration = fileMetaTokens[2]
 	m.measureSet = fileMetaTokens[3]
-	// 20171217_010658
-	t, err := time.ParseInLocation("20060102150405.csv", fileMetaTokens[4]+fileMetaTokens[5], time.Local)
+	// 20171217_010658, .csv export or .dat copy of SRUDB.dat
+	fileDate := strings.TrimSuffix(fileMetaTokens[4]+fileMetaTokens[5], filepath.Ext(base))
+	t, err := time.ParseInLocation("20060102150405", fileDate, time.Local)
 	if err != nil {
-		return m, fmt.Errorf("srumGetFileMeta time.Parse(\"20060102150405\", %s) failed: '%s'", fileMetaTokens[4]+fileMetaTokens[5], err)
+		return m, fmt.Errorf("srumGetFileMeta time.Parse(\"20060102150405\", %s) failed: '%s'", fileDate, err)
 	}
 	m.date = t
 	return m, nil
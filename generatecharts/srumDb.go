@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	srumDbIdMapTable = "SruDbIdMapTable"
+	// App Resource Usage provider
+	srumDbAppResourceTable = "{D10CA2FE-6FCF-4F6D-848E-B2E99266FA89}"
+)
+
+// Columns of SRUM "App Resource Usage" table
+var srumAppResourceMeasures = []string{
+	"ForegroundCycleTime",
+	"BackgroundCycleTime",
+	"ForegroundBytesRead",
+	"ForegroundBytesWritten",
+	"BackgroundBytesRead",
+	"BackgroundBytesWritten",
+}
+
+// Reads intervals from copied SRUDB.dat like chrome_yandexstaticfavicon_0_srum_20171217_010658.dat
+func srumDbGetIntervals(dbFilePath string) ([]srumInterval, error) {
+	metaMeasure, err := srumGetFileMeta(dbFilePath)
+	if err != nil {
+		return nil, err
+	}
+	start, end, appIds, err := srumGetRunWindow(metaMeasure)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := eseOpen(dbFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	idMap, err := srumDbGetIdMap(db)
+	if err != nil {
+		return nil, fmt.Errorf("srumDbGetIntervals: %s: %v", dbFilePath, err)
+	}
+
+	var intervals []srumInterval
+	// Energy Usage table GUID differs between Windows builds, find it by columns.
+	// Databases which keep energy estimates in binary data have no such table, powercfg /srumutil export is needed then
+	energyTable := srumDbFindTable(db, srumMeasures)
+	if energyTable == "" {
+		dataQualityAdd(dataQualityUnparseable, dbFilePath, metaMeasure, "no table with %s columns", strings.Join(srumMeasures, ", "))
+	} else {
+		energy, err := srumDbGetTableIntervals(db, energyTable, srumMeasures, idMap, metaMeasure, start, end, appIds)
+		if err != nil {
+			return nil, fmt.Errorf("srumDbGetIntervals: %s: %v", dbFilePath, err)
+		}
+		intervals = append(intervals, energy...)
+	}
+
+	if _, found := db.tables[srumDbAppResourceTable]; found {
+		resources, err := srumDbGetTableIntervals(db, srumDbAppResourceTable, srumAppResourceMeasures, idMap, metaMeasure, start, end, appIds)
+		if err != nil {
+			return nil, fmt.Errorf("srumDbGetIntervals: %s: %v", dbFilePath, err)
+		}
+		intervals = append(intervals, resources...)
+	} else if energyTable == "" {
+		return nil, fmt.Errorf("srumDbGetIntervals: %s: neither Energy Usage nor App Resource Usage table found", dbFilePath)
+	}
+
+	// AppId of application with skipped IdBlob does not match, so its intervals are missing
+	for _, skipped := range db.skippedValues() {
+		dataQualityAdd(dataQualityUnparseable, dbFilePath, metaMeasure, "%s are skipped", skipped)
+	}
+
+	return intervals, nil
+}
+
+// Returns name of table with AppId, TimeStamp and all of columns
+func srumDbFindTable(db *eseDatabase, columns []string) string {
+	for name, t := range db.tables {
+		found := true
+		for _, column := range append([]string{srumColAppId, srumColTimeStamp}, columns...) {
+			if _, ok := t.columnId(column); !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			return name
+		}
+	}
+	return ""
+}
+
+// SruDbIdMapTable maps IdIndex to IdBlob, for applications IdBlob is UTF-16 path
+func srumDbGetIdMap(db *eseDatabase) (map[uint32]string, error) {
+	t, found := db.tables[srumDbIdMapTable]
+	if !found {
+		return nil, fmt.Errorf("table %s not found", srumDbIdMapTable)
+	}
+	colIndex, foundIndex := t.columnId("IdIndex")
+	colBlob, foundBlob := t.columnId("IdBlob")
+	if !foundIndex || !foundBlob {
+		return nil, fmt.Errorf("table %s has no IdIndex or IdBlob column", srumDbIdMapTable)
+	}
+
+	idMap := map[uint32]string{}
+	err := db.walkTable(srumDbIdMapTable, func(record eseRecord) error {
+		blob, found := record[colBlob]
+		if !found {
+			return nil
+		}
+		idMap[eseUint32(record[colIndex])] = eseString(blob)
+		return nil
+	})
+
+	return idMap, err
+}
+
+func srumDbGetTableIntervals(db *eseDatabase, tableName string, measures []string, idMap map[uint32]string, metaMeasure Measure, start, end time.Time, appIds []string) ([]srumInterval, error) {
+	t := db.tables[tableName]
+	colAppId, _ := t.columnId(srumColAppId)
+	colTimeStamp, _ := t.columnId(srumColTimeStamp)
+	measureCols := map[string]uint32{}
+	for _, measureName := range measures {
+		colId, found := t.columnId(measureName)
+		if !found {
+			return nil, fmt.Errorf("table %s: column %s not found", tableName, measureName)
+		}
+		measureCols[measureName] = colId
+	}
+
+	var intervals []srumInterval
+	row := 0
+	err := db.walkTable(tableName, func(record eseRecord) error {
+		row++
+		appId := strings.Trim(idMap[eseUint32(record[colAppId])], "\x00")
+		if !srumAppIdMatches(appId, metaMeasure.browserProcesses, appIds) {
+			return nil
+		}
+
+		ts, err := eseTime(record[colTimeStamp])
+		if err != nil {
+			return fmt.Errorf("table %s: row %d: %v", tableName, row, err)
+		}
+		if ts.Before(start) || (!end.IsZero() && ts.After(end)) {
+			return nil
+		}
+
+		interval := srumInterval{
+			meta:      metaMeasure,
+			timeStamp: ts,
+			values:    map[string]float64{},
+		}
+		for measureName, colId := range measureCols {
+			b, found := record[colId]
+			if !found {
+				continue // null
+			}
+			val, err := eseFloat64(t.columns[colId], b)
+			if err != nil {
+				return fmt.Errorf("table %s: row %d: %v", tableName, row, err)
+			}
+			interval.values[measureName] += val
+		}
+		intervals = append(intervals, interval)
+		return nil
+	})
+
+	return intervals, err
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const srumDbTestChromeAppId = `\Device\HarddiskVolume4\Program Files (x86)\Google\Chrome\Application\chrome.exe`
+
+// SRUM tables of test database, energy table is looked up by columns
+func srumDbTestTables(runStart time.Time) []eseTestTable {
+	idMap := eseTestTable{
+		name: srumDbIdMapTable,
+		columns: []eseTestColumn{
+			{1, "IdType", eseColumnTypeUnsignedByte},
+			{2, "IdIndex", eseColumnTypeLong},
+			{256, "IdBlob", eseColumnTypeLongBinary},
+		},
+		records: []map[uint32][]byte{
+			{1: {0}, 2: eseTestUint32(1), 256: append([]byte{0}, eseTestUtf16(srumDbTestChromeAppId)...)},
+			{1: {0}, 2: eseTestUint32(2), 256: append([]byte{0}, eseTestUtf16(`\Device\HarddiskVolume4\Windows\System32\svchost.exe`)...)},
+			{1: {0}, 2: eseTestUint32(3), 256: append([]byte{eseTaggedFlagCompressed}, eseTestCompress7bit(`\Device\HarddiskVolume2\chrome.exe`, 2)...)},
+			// Blob of long value tree is not read, AppId 4 does not match
+			{1: {0}, 2: eseTestUint32(4), 256: append([]byte{eseTaggedFlagLongValue}, eseTestUint32(0x80000001)...)},
+		},
+	}
+
+	energy := eseTestTable{
+		name: "{00000000-0000-0000-0000-000000000001}",
+		columns: []eseTestColumn{
+			{1, "AutoIncId", eseColumnTypeLong},
+			{2, srumColTimeStamp, eseColumnTypeDateTime},
+			{3, srumColAppId, eseColumnTypeLong},
+		},
+	}
+	for i, measureName := range srumMeasures {
+		energy.columns = append(energy.columns, eseTestColumn{uint32(4 + i), measureName, eseColumnTypeLongLong})
+	}
+	energyRecord := func(appId uint32, ts time.Time, value uint64) map[uint32][]byte {
+		record := map[uint32][]byte{1: eseTestUint32(1), 2: eseTestTime(ts), 3: eseTestUint32(appId)}
+		for i := range srumMeasures {
+			record[uint32(4+i)] = eseTestUint64(value)
+		}
+		return record
+	}
+	energy.records = []map[uint32][]byte{
+		energyRecord(1, runStart.Add(-time.Hour), 1000), // before run
+		energyRecord(1, runStart.Add(time.Minute), 10),
+		energyRecord(2, runStart.Add(time.Minute), 1000), // svchost.exe
+		energyRecord(3, runStart.Add(2*time.Minute), 20),
+		energyRecord(4, runStart.Add(2*time.Minute), 1000),
+	}
+
+	resources := eseTestTable{
+		name: srumDbAppResourceTable,
+		columns: []eseTestColumn{
+			{1, "AutoIncId", eseColumnTypeLong},
+			{2, srumColTimeStamp, eseColumnTypeDateTime},
+			{3, srumColAppId, eseColumnTypeLong},
+		},
+	}
+	for i, measureName := range srumAppResourceMeasures {
+		resources.columns = append(resources.columns, eseTestColumn{uint32(4 + i), measureName, eseColumnTypeLongLong})
+	}
+	resourcesRecord := map[uint32][]byte{1: eseTestUint32(1), 2: eseTestTime(runStart.Add(time.Minute)), 3: eseTestUint32(1)}
+	for i := range srumAppResourceMeasures {
+		resourcesRecord[uint32(4+i)] = eseTestUint64(5)
+	}
+	resources.records = []map[uint32][]byte{resourcesRecord}
+
+	return []eseTestTable{idMap, energy, resources}
+}
+
+func TestSrumDbGetIntervals(t *testing.T) {
+	runStart := time.Date(2017, 12, 17, 1, 6, 58, 0, time.Local)
+	tables := srumDbTestTables(runStart)
+	tests := []struct {
+		name     string
+		tables   []eseTestTable
+		expected map[string]float64
+		err      bool
+	}{
+		{
+			name:   "energy and app resource usage",
+			tables: tables,
+			expected: map[string]float64{
+				"CPUEnergyConsumption": 30,
+				"EnergyLoss":           30,
+				"ForegroundCycleTime":  5,
+			},
+		},
+		{
+			name:   "no energy table",
+			tables: []eseTestTable{tables[0], tables[2]},
+			expected: map[string]float64{
+				"CPUEnergyConsumption": 0,
+				"ForegroundCycleTime":  5,
+			},
+		},
+		{
+			name:   "no SRUM tables",
+			tables: []eseTestTable{tables[0]},
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := eseTestTempDir(t)
+			dbFilePath := filepath.Join(dir, "chrome_youtube_1_srum_20171217_010658.dat")
+			eseTestWriteDatabase(t, dbFilePath, test.tables)
+			oldIssues := dataQualityIssues
+			defer func() { dataQualityIssues = oldIssues }()
+
+			intervals, err := srumDbGetIntervals(dbFilePath)
+			if test.err {
+				if err == nil {
+					t.Errorf("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]float64{}
+			for _, m := range srumSumIntervals(intervals) {
+				got[m.measureName] = m.value
+			}
+			for measureName, value := range test.expected {
+				if got[measureName] != value {
+					t.Errorf("%s: got %v, expected %v", measureName, got[measureName], value)
+				}
+			}
+
+			skipped := false
+			for _, issue := range dataQualityIssues[len(oldIssues):] {
+				if strings.Contains(issue.Details, "column IdBlob: long value, 1 values") {
+					skipped = true
+				}
+			}
+			if !skipped {
+				t.Errorf("skipped IdBlob is not in data quality issues: %v", dataQualityIssues[len(oldIssues):])
+			}
+		})
+	}
+}
+
+// Checks tables used by srumDbGetIntervals in SRUDB.dat copied from Windows:
+// testdata/SRUDB.dat or path in SRUDB_DAT
+func TestSrumDbRealDatabase(t *testing.T) {
+	dbFilePath := os.Getenv("SRUDB_DAT")
+	if dbFilePath == "" {
+		dbFilePath = filepath.Join("testdata", "SRUDB.dat")
+	}
+	if _, err := os.Stat(dbFilePath); err != nil {
+		t.Skipf("no real database: %v", err)
+	}
+	db, err := eseOpen(dbFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	idMap, err := srumDbGetIdMap(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idMap) == 0 {
+		t.Errorf("%s is empty", srumDbIdMapTable)
+	}
+	t.Logf("skipped values: %v", db.skippedValues())
+
+	if _, found := db.tables[srumDbAppResourceTable]; !found {
+		t.Fatalf("App Resource Usage table %s not found", srumDbAppResourceTable)
+	}
+	for _, measureName := range srumAppResourceMeasures {
+		if _, found := db.tables[srumDbAppResourceTable].columnId(measureName); !found {
+			t.Errorf("App Resource Usage table has no %s column", measureName)
+		}
+	}
+
+	energyTable := srumDbFindTable(db, srumMeasures)
+	t.Logf("table with energy columns: '%s'", energyTable)
+}
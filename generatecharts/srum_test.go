@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// powercfg /srumutil export with App Resource Usage table before Energy Usage table
+func srumTestCsv(energyRows ...string) string {
+	energyHeader := append([]string{"AppId", "UserId", " TimeStamp"}, srumMeasures...)
+	return "SRUM data\n" +
+		"AppId, UserId, TimeStamp, ForegroundCycleTime, BackgroundCycleTime\n" +
+		`\Device\HarddiskVolume4\Program Files (x86)\Google\Chrome\Application\chrome.exe, S-1-5-21, 2017-12-17:01:10:00.0000, 500, 700` + "\n" +
+		"\n" +
+		strings.Join(energyHeader, ", ") + "\n" +
+		strings.Join(energyRows, "\n") + "\n"
+}
+
+func srumTestEnergyRow(appId, timeStamp, value string) string {
+	row := []string{appId, "S-1-5-21", timeStamp}
+	for range srumMeasures {
+		row = append(row, value)
+	}
+	return strings.Join(row, ", ")
+}
+
+func TestSrumGetIntervals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	chrome := `\Device\HarddiskVolume4\Program Files (x86)\Google\Chrome\Application\chrome.exe`
+
+	tests := []struct {
+		name      string
+		content   string
+		intervals int
+		energy    float64
+		err       bool
+	}{
+		{
+			name: "energy table after other table",
+			content: srumTestCsv(
+				srumTestEnergyRow(chrome, "2017-12-17:00:10:00.0000", "1000"), // before run
+				srumTestEnergyRow(chrome, "2017-12-17:01:10:00.0000", "10"),
+				srumTestEnergyRow(`\Device\HarddiskVolume4\Windows\System32\svchost.exe`, "2017-12-17:01:10:00.0000", "1000"),
+				srumTestEnergyRow(chrome, "2017-12-17:01:20:00.0000", "20"),
+			),
+			intervals: 2,
+			energy:    30,
+		},
+		{
+			name: "energy table before other table",
+			content: strings.Join(append([]string{"AppId", "UserId", "TimeStamp"}, srumMeasures...), ",") + "\n" +
+				srumTestEnergyRow(chrome, "2017-12-17:01:10:00.0000", "10") + "\n" +
+				"AppId, UserId, TimeStamp, ForegroundCycleTime\n" +
+				chrome + ", S-1-5-21, 2017-12-17:01:10:00.0000, 500\n",
+			intervals: 1,
+			energy:    10,
+		},
+		{
+			name:    "no energy table",
+			content: "AppId, UserId, TimeStamp, ForegroundCycleTime\n" + chrome + ", S-1-5-21, 2017-12-17:01:10:00.0000, 500\n",
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			csvFilePath := filepath.Join(dir, "chrome_youtube_1_srum_20171217_010658.csv")
+			err := ioutil.WriteFile(csvFilePath, []byte(test.content), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			intervals, err := srumGetIntervals(csvFilePath)
+			if test.err {
+				if err == nil {
+					t.Errorf("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(intervals) != test.intervals {
+				t.Errorf("got %d intervals, expected %d", len(intervals), test.intervals)
+			}
+			for _, m := range srumSumIntervals(intervals) {
+				if m.value != test.energy {
+					t.Errorf("%s: got %v, expected %v", m.measureName, m.value, test.energy)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	symbolsIndexFileName  = "symbols.json"
+	symbolsSystem         = "system" // store folder for symbols of Windows binaries
+	pdbMsfMagic           = "Microsoft C/C++ MSF 7.00\r\n\x1aDS\x00\x00\x00"
+	peDirectoryEntryDebug = 6
+	symbolsFilePtr        = "file.ptr"
+	// Symbol servers of Microsoft serve symbols to symsrv only
+	symbolsUserAgent       = "Microsoft-Symbol-Server/10.0.0.0"
+	symbolsDownloadTimeout = 30 * time.Minute
+)
+
+// Large PDB like chrome.dll.pdb takes minutes to download, stalled connection fails by timeout
+var symbolsHttpClient = &http.Client{Timeout: symbolsDownloadTimeout}
+
+// Identifies PDB on symbol servers: <Name>/<Guid><Age>/<Name>
+type pdbSignature struct {
+	Name   string `json:"Name"`
+	Guid   string `json:"Guid"`
+	Age    uint32 `json:"Age"`
+	Binary string `json:"Binary,omitempty"`
+}
+
+func (s pdbSignature) Key() string {
+	return fmt.Sprintf("%s%X", s.Guid, s.Age)
+}
+
+// PDB file name > signature
+type symbolsIndex map[string]pdbSignature
+
+// Handles -symbolsImport, -symbolsFetch and -symbolsValidate commands
+func symbolsRunCommands() error {
+	if *symbolsBrowser == "" {
+		return fmt.Errorf("-symbolsBrowser is required")
+	}
+	storeVersion, binariesDir, err := symbolsGetBrowserVersion(*symbolsBrowser)
+	if err != nil {
+		return err
+	}
+	if storeVersion == "" {
+		return fmt.Errorf("version of %s not found, use -symbolsVersion", *symbolsBrowser)
+	}
+	if *symbolsBinaries != "" {
+		binariesDir = *symbolsBinaries
+	}
+
+	if *symbolsImport != "" {
+		err = symbolsImportDir(*symbolsImport, *symbolsBrowser, storeVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *symbolsFetch {
+		if binariesDir == "" {
+			return fmt.Errorf("binaries directory of %s not found, use -symbolsBinaries", *symbolsBrowser)
+		}
+		err = symbolsFetchForBinaries(binariesDir, *symbolsBrowser, storeVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *symbolsValidate {
+		if binariesDir == "" {
+			return fmt.Errorf("binaries directory of %s not found, use -symbolsBinaries", *symbolsBrowser)
+		}
+		problems, err := symbolsValidateForBinaries(binariesDir, *symbolsBrowser, storeVersion)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("symbols of %s %s are not valid:\n%s", *symbolsBrowser, storeVersion, strings.Join(problems, "\n"))
+		}
+		fmt.Printf("symbols of %s %s are valid\n", *symbolsBrowser, storeVersion)
+	}
+
+	return nil
+}
+
+// Returns version used as symbol store key and binaries directory.
+// Priority: -symbolsVersion, run manifest, "Local State" of browser user data
+func symbolsGetBrowserVersion(browserShortName string) (string, string, error) {
+	storeVersion := ""
+	binariesDir := ""
+
+	manifest, err := loadRunManifest()
+	if err != nil {
+		return "", "", err
+	}
+	if b, found := manifest.Browsers[browserShortName]; found {
+		storeVersion = symbolsGetStoreVersion(browserShortName, version{version: b.Version, chromiumVersion: b.ChromiumVersion})
+		binariesDir = b.BinariesDir
+	}
+
+	if storeVersion == "" {
+		v, err := getBrowserVersion(browserShortName)
+		if err != nil {
+			return "", "", err
+		}
+		storeVersion = symbolsGetStoreVersion(browserShortName, v)
+	}
+
+	if *symbolsVersion != "" {
+		storeVersion = *symbolsVersion
+	}
+
+	return storeVersion, binariesDir, nil
+}
+
+// Yandex Browser symbols are per own version, other Chromium based browsers per Chromium version
+func symbolsGetStoreVersion(browserShortName string, v version) string {
+	if browserShortName == yaBrowserShortName || browserShortName == yaBrowserDefaultShortName {
+		return v.version
+	}
+	if v.chromiumVersion != "" {
+		return v.chromiumVersion
+	}
+	return v.version
+}
+
+func symbolsGetStoreDir(browserShortName, storeVersion string) string {
+	return filepath.Join(*symbolStore, browserShortName, storeVersion)
+}
+
+func symbolsLoadIndex(storeDir string) (symbolsIndex, error) {
+	index := symbolsIndex{}
+	content, err := ioutil.ReadFile(filepath.Join(storeDir, symbolsIndexFileName))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %s", filepath.Join(storeDir, symbolsIndexFileName), err)
+	}
+
+	return index, nil
+}
+
+func symbolsSaveIndex(storeDir string, index symbolsIndex) error {
+	indexPath := filepath.Join(storeDir, symbolsIndexFileName)
+	indexFile, err := os.Create(indexPath)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(indexFile).Encode(index)
+	if err != nil {
+		indexFile.Close()
+		return fmt.Errorf("failed to json encode %s: %s", indexPath, err)
+	}
+
+	return ioClose(indexPath, indexFile)
+}
+
+// Copies all PDB files found in srcDir to symbol store of browser version
+func symbolsImportDir(srcDir, browserShortName, storeVersion string) error {
+	storeDir := symbolsGetStoreDir(browserShortName, storeVersion)
+	err := os.MkdirAll(storeDir, 0755)
+	if err != nil {
+		return err
+	}
+	index, err := symbolsLoadIndex(storeDir)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.EqualFold(filepath.Ext(path), ".pdb") {
+			return nil
+		}
+
+		signature, err := pdbGetSignature(path)
+		if err != nil {
+			fmt.Printf("skip %s: %s\n", path, err)
+			return nil
+		}
+		err = copyFile(path, filepath.Join(storeDir, signature.Name))
+		if err != nil {
+			return err
+		}
+		index[strings.ToLower(signature.Name)] = signature
+		fmt.Printf("imported %s %s\n", signature.Name, signature.Key())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return symbolsSaveIndex(storeDir, index)
+}
+
+// Downloads missing PDB files of binaries from symbol servers to symbol store
+func symbolsFetchForBinaries(binariesDir, browserShortName, storeVersion string) error {
+	storeDir := symbolsGetStoreDir(browserShortName, storeVersion)
+	err := os.MkdirAll(storeDir, 0755)
+	if err != nil {
+		return err
+	}
+	index, err := symbolsLoadIndex(storeDir)
+	if err != nil {
+		return err
+	}
+
+	servers := []string{symbolsServerMicrosoft}
+	if browserShortName == chromeShortName || browserShortName == chromiumShortName {
+		servers = append(servers, symbolsServerChrome)
+	}
+
+	signatures, err := symbolsGetBinariesSignatures(binariesDir)
+	if err != nil {
+		return err
+	}
+	for _, expected := range signatures {
+		if stored, found := index[strings.ToLower(expected.Name)]; found && stored.Key() == expected.Key() {
+			continue
+		}
+
+		pdbPath := filepath.Join(storeDir, expected.Name)
+		err = symbolsDownload(servers, expected, pdbPath)
+		if err != nil {
+			fmt.Printf("failed to fetch %s for %s: %s\n", expected.Name, expected.Binary, err)
+			continue
+		}
+		index[strings.ToLower(expected.Name)] = expected
+		fmt.Printf("fetched %s %s\n", expected.Name, expected.Key())
+	}
+
+	return symbolsSaveIndex(storeDir, index)
+}
+
+// Tries forms of PDB served by symbol servers: uncompressed <Name>, compressed <Nam_> cabinet and
+// file.ptr with path of PDB. PDB is moved to pdbPath only when its signature matches, failed download
+// does not leave broken PDB in store.
+func symbolsDownload(servers []string, signature pdbSignature, pdbPath string) error {
+	var errs []string
+	for _, server := range servers {
+		dirUrl := fmt.Sprintf("%s/%s/%s/", server, signature.Name, signature.Key())
+		for _, fileName := range []string{signature.Name, symbolsCompressedName(signature.Name), symbolsFilePtr} {
+			err := symbolsDownloadFile(dirUrl, fileName, signature, pdbPath)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("not found on symbol servers: %s", strings.Join(errs, "; "))
+}
+
+// "chrome.dll.pdb" > "chrome.dll.pd_"
+func symbolsCompressedName(name string) string {
+	return name[:len(name)-1] + "_"
+}
+
+func symbolsDownloadFile(dirUrl, fileName string, signature pdbSignature, pdbPath string) error {
+	url := dirUrl + fileName
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", symbolsUserAgent)
+	resp, err := symbolsHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(pdbPath), filepath.Base(pdbPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+	_, err = io.Copy(tmpFile, resp.Body)
+	if err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("%s: %s", url, err)
+	}
+	err = ioClose(tmpPath, tmpFile)
+	if err != nil {
+		return err
+	}
+
+	switch fileName {
+	case symbolsFilePtr:
+		// "PATH:\\server\share\chrome.dll.pdb" or "MSG: <reason>"
+		content, err := ioutil.ReadFile(tmpPath)
+		if err != nil {
+			return err
+		}
+		ptr := strings.TrimSpace(string(content))
+		if !strings.HasPrefix(ptr, "PATH:") {
+			return fmt.Errorf("%s: %s", url, ptr)
+		}
+		err = copyFile(strings.TrimPrefix(ptr, "PATH:"), tmpPath)
+		if err != nil {
+			return fmt.Errorf("%s: %s", url, err)
+		}
+	case symbolsCompressedName(signature.Name):
+		expandedPath := tmpPath + ".pdb"
+		defer os.Remove(expandedPath)
+		out, err := exec.Command("expand", tmpPath, expandedPath).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: failed to expand: %s %s", url, err, out)
+		}
+		err = os.Rename(expandedPath, tmpPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	actual, err := pdbGetSignature(tmpPath)
+	if err != nil {
+		return fmt.Errorf("%s: %s", url, err)
+	}
+	if actual.Key() != signature.Key() {
+		return fmt.Errorf("%s: got PDB %s, expected %s", url, actual.Key(), signature.Key())
+	}
+	return os.Rename(tmpPath, pdbPath)
+}
+
+// Checks every binary has PDB with the same GUID and age in symbol store
+func symbolsValidateForBinaries(binariesDir, browserShortName, storeVersion string) ([]string, error) {
+	storeDir := symbolsGetStoreDir(browserShortName, storeVersion)
+	signatures, err := symbolsGetBinariesSignatures(binariesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, expected := range signatures {
+		pdbPath := filepath.Join(storeDir, expected.Name)
+		actual, err := pdbGetSignature(pdbPath)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", expected.Binary, err))
+			continue
+		}
+		// Stale PDB of rebuilt binary has the same GUID and other age
+		if actual.Key() != expected.Key() {
+			problems = append(problems, fmt.Sprintf("%s: %s has GUID and age %s, expected %s", expected.Binary, pdbPath, actual.Key(), expected.Key()))
+		}
+	}
+
+	return problems, nil
+}
+
+func symbolsGetBinariesSignatures(binariesDir string) ([]pdbSignature, error) {
+	var signatures []pdbSignature
+	err := filepath.Walk(binariesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if info.IsDir() || (ext != ".exe" && ext != ".dll") {
+			return nil
+		}
+
+		signature, err := peGetPdbSignature(path)
+		if err != nil {
+			// Not every binary has debug info
+			return nil
+		}
+		signatures = append(signatures, signature)
+		return nil
+	})
+
+	return signatures, err
+}
+
+// Reads CodeView RSDS record from debug directory of PE file
+func peGetPdbSignature(binaryPath string) (pdbSignature, error) {
+	signature := pdbSignature{Binary: binaryPath}
+	f, err := pe.Open(binaryPath)
+	if err != nil {
+		return signature, err
+	}
+	defer f.Close()
+
+	var debugDir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if oh.NumberOfRvaAndSizes > peDirectoryEntryDebug {
+			debugDir = oh.DataDirectory[peDirectoryEntryDebug]
+		}
+	case *pe.OptionalHeader64:
+		if oh.NumberOfRvaAndSizes > peDirectoryEntryDebug {
+			debugDir = oh.DataDirectory[peDirectoryEntryDebug]
+		}
+	}
+	if debugDir.Size == 0 {
+		return signature, fmt.Errorf("%s has no debug directory", binaryPath)
+	}
+
+	debugData, err := peReadRva(f, debugDir.VirtualAddress, debugDir.Size)
+	if err != nil {
+		return signature, err
+	}
+
+	const debugDirectorySize = 28
+	const debugTypeCodeView = 2
+	for offset := 0; offset+debugDirectorySize <= len(debugData); offset += debugDirectorySize {
+		entry := debugData[offset : offset+debugDirectorySize]
+		if binary.LittleEndian.Uint32(entry[12:16]) != debugTypeCodeView {
+			continue
+		}
+		size := binary.LittleEndian.Uint32(entry[16:20])
+		rva := binary.LittleEndian.Uint32(entry[20:24])
+		cv, err := peReadRva(f, rva, size)
+		if err != nil {
+			return signature, err
+		}
+		if len(cv) < 24 || string(cv[0:4]) != "RSDS" {
+			continue
+		}
+
+		signature.Guid = formatGuid(cv[4:20])
+		signature.Age = binary.LittleEndian.Uint32(cv[20:24])
+		pdbPath := string(cv[24:])
+		if i := bytes.IndexByte(cv[24:], 0); i >= 0 {
+			pdbPath = string(cv[24 : 24+i])
+		}
+		signature.Name = pdbPath[strings.LastIndexAny(pdbPath, `\/`)+1:]
+		return signature, nil
+	}
+
+	return signature, fmt.Errorf("%s has no CodeView RSDS record", binaryPath)
+}
+
+func peReadRva(f *pe.File, rva, size uint32) ([]byte, error) {
+	for _, section := range f.Sections {
+		if rva >= section.VirtualAddress && rva+size <= section.VirtualAddress+section.VirtualSize {
+			data := make([]byte, size)
+			_, err := section.ReadAt(data, int64(rva-section.VirtualAddress))
+			if err != nil {
+				return nil, err
+			}
+			return data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("rva 0x%x not found in sections", rva)
+}
+
+// Reads GUID and age from PDB info stream of MSF 7.00 file
+func pdbGetSignature(pdbPath string) (pdbSignature, error) {
+	signature := pdbSignature{Name: filepath.Base(pdbPath)}
+	f, err := os.Open(pdbPath)
+	if err != nil {
+		return signature, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 56)
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		return signature, err
+	}
+	if string(header[0:32]) != pdbMsfMagic {
+		return signature, fmt.Errorf("%s is not MSF 7.00 PDB file", pdbPath)
+	}
+	blockSize := binary.LittleEndian.Uint32(header[32:36])
+	numDirectoryBytes := binary.LittleEndian.Uint32(header[44:48])
+	blockMapAddr := binary.LittleEndian.Uint32(header[52:56])
+	if blockSize == 0 {
+		return signature, fmt.Errorf("%s has zero block size", pdbPath)
+	}
+
+	readBlocks := func(blocks []uint32, size uint32) ([]byte, error) {
+		data := make([]byte, 0, size)
+		block := make([]byte, blockSize)
+		for _, b := range blocks {
+			n, err := f.ReadAt(block, int64(b)*int64(blockSize))
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			// Last block may be cut short at end of file
+			data = append(data, block[:n]...)
+			if n < len(block) {
+				break
+			}
+		}
+		if uint32(len(data)) < size {
+			return nil, fmt.Errorf("%s is truncated", pdbPath)
+		}
+		return data[:size], nil
+	}
+	blocksCount := func(size uint32) uint32 {
+		return (size + blockSize - 1) / blockSize
+	}
+
+	// Block map is list of directory blocks
+	directoryBlocksCount := blocksCount(numDirectoryBytes)
+	blockMap, err := readBlocks([]uint32{blockMapAddr}, directoryBlocksCount*4)
+	if err != nil {
+		return signature, err
+	}
+	directoryBlocks := make([]uint32, directoryBlocksCount)
+	for i := range directoryBlocks {
+		directoryBlocks[i] = binary.LittleEndian.Uint32(blockMap[i*4:])
+	}
+	directory, err := readBlocks(directoryBlocks, numDirectoryBytes)
+	if err != nil {
+		return signature, err
+	}
+
+	// Directory: NumStreams, StreamSizes[NumStreams], StreamBlocks[NumStreams][]
+	const pdbInfoStream = 1
+	numStreams := binary.LittleEndian.Uint32(directory[0:4])
+	if numStreams <= pdbInfoStream || uint32(len(directory)) < 4+numStreams*4 {
+		return signature, fmt.Errorf("%s has no PDB info stream", pdbPath)
+	}
+	offset := 4 + numStreams*4
+	var infoBlocks []uint32
+	var infoSize uint32
+	for stream := uint32(0); stream <= pdbInfoStream; stream++ {
+		size := binary.LittleEndian.Uint32(directory[4+stream*4:])
+		if size == 0xFFFFFFFF {
+			size = 0
+		}
+		count := blocksCount(size)
+		if uint32(len(directory)) < offset+count*4 {
+			return signature, fmt.Errorf("%s has broken stream directory", pdbPath)
+		}
+		if stream == pdbInfoStream {
+			infoSize = size
+			for i := uint32(0); i < count; i++ {
+				infoBlocks = append(infoBlocks, binary.LittleEndian.Uint32(directory[offset+i*4:]))
+			}
+		}
+		offset += count * 4
+	}
+
+	// PDB info stream: Version, Signature, Age, Guid
+	if infoSize < 28 {
+		return signature, fmt.Errorf("%s has too short PDB info stream", pdbPath)
+	}
+	info, err := readBlocks(infoBlocks, 28)
+	if err != nil {
+		return signature, err
+	}
+	signature.Age = binary.LittleEndian.Uint32(info[8:12])
+	signature.Guid = formatGuid(info[12:28])
+
+	return signature, nil
+}
+
+// Formats GUID like symbol servers do: 3844DBB920174967BE7AA4A2C20430FA
+func formatGuid(b []byte) string {
+	return fmt.Sprintf("%08X%04X%04X%X",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:16],
+	)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return ioClose(dst, out)
+}
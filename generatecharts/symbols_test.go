@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// GUID 3844DBB9-2017-4967-BE7A-A4A2C20430FA as stored in PDB and RSDS record
+var symbolsTestGuid = []byte{0xb9, 0xdb, 0x44, 0x38, 0x17, 0x20, 0x67, 0x49, 0xbe, 0x7a, 0xa4, 0xa2, 0xc2, 0x04, 0x30, 0xfa}
+
+const symbolsTestGuidString = "3844DBB920174967BE7AA4A2C20430FA"
+
+func symbolsTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "symbols")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// Writes MSF 7.00 file: superblock, free block map, block map, stream directory and PDB info stream
+func symbolsTestWritePdb(t *testing.T, path string, age uint32, infoSize uint32) {
+	const blockSize = 512
+	blocks := make([][]byte, 5)
+	for i := range blocks {
+		blocks[i] = make([]byte, blockSize)
+	}
+
+	superblock := blocks[0]
+	copy(superblock, pdbMsfMagic)
+	binary.LittleEndian.PutUint32(superblock[32:], blockSize)
+	binary.LittleEndian.PutUint32(superblock[36:], 1) // free block map
+	binary.LittleEndian.PutUint32(superblock[40:], uint32(len(blocks)))
+	binary.LittleEndian.PutUint32(superblock[44:], 20) // directory bytes
+	binary.LittleEndian.PutUint32(superblock[52:], 2)  // block map
+
+	binary.LittleEndian.PutUint32(blocks[2], 3)
+
+	// Old directory stream 0 is empty, PDB info stream 1 is in block 4
+	directory := blocks[3]
+	binary.LittleEndian.PutUint32(directory[0:], 2)
+	binary.LittleEndian.PutUint32(directory[4:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(directory[8:], infoSize)
+	binary.LittleEndian.PutUint32(directory[12:], 4)
+
+	info := blocks[4]
+	binary.LittleEndian.PutUint32(info[0:], 20000404)
+	binary.LittleEndian.PutUint32(info[4:], 0x5a1b2c3d)
+	binary.LittleEndian.PutUint32(info[8:], age)
+	copy(info[12:], symbolsTestGuid)
+
+	err := ioutil.WriteFile(path, bytes.Join(blocks, nil), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPdbGetSignature(t *testing.T) {
+	dir := symbolsTempDir(t)
+	pdbPath := filepath.Join(dir, "chrome.dll.pdb")
+	symbolsTestWritePdb(t, pdbPath, 3, 28)
+
+	signature, err := pdbGetSignature(pdbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := pdbSignature{Name: "chrome.dll.pdb", Guid: symbolsTestGuidString, Age: 3}
+	if signature != expected {
+		t.Errorf("got %v, expected %v", signature, expected)
+	}
+	if signature.Key() != symbolsTestGuidString+"3" {
+		t.Errorf("got key %s, expected %s3", signature.Key(), symbolsTestGuidString)
+	}
+}
+
+func TestPdbGetSignatureErrors(t *testing.T) {
+	dir := symbolsTempDir(t)
+	tests := []struct {
+		name  string
+		patch func(content []byte) []byte
+	}{
+		{"not MSF", func(content []byte) []byte { return append([]byte("MZ"), content[2:]...) }},
+		{"short header", func(content []byte) []byte { return content[:40] }},
+		{"zero block size", func(content []byte) []byte {
+			binary.LittleEndian.PutUint32(content[32:], 0)
+			return content
+		}},
+		{"truncated", func(content []byte) []byte { return content[:4*512] }},
+		{"no info stream", func(content []byte) []byte {
+			binary.LittleEndian.PutUint32(content[3*512:], 1)
+			return content
+		}},
+		{"short info stream", func(content []byte) []byte {
+			binary.LittleEndian.PutUint32(content[3*512+8:], 12)
+			return content
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pdbPath := filepath.Join(dir, "chrome.dll.pdb")
+			symbolsTestWritePdb(t, pdbPath, 1, 28)
+			content, err := ioutil.ReadFile(pdbPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(pdbPath, test.patch(content), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = pdbGetSignature(pdbPath)
+			if err == nil {
+				t.Errorf("no error")
+			}
+		})
+	}
+}
+
+// Writes 64-bit PE file with one section holding debug directory at its start
+func symbolsTestWritePe(t *testing.T, path string, debugData []byte, debugSize uint32) {
+	const (
+		sectionRva    = 0x1000
+		sectionOffset = 0x200
+		sectionSize   = 0x200
+	)
+	var buf bytes.Buffer
+	dosHeader := make([]byte, 0x40)
+	copy(dosHeader, "MZ")
+	binary.LittleEndian.PutUint32(dosHeader[0x3c:], 0x40)
+	buf.Write(dosHeader)
+	buf.WriteString("PE\x00\x00")
+
+	write := func(data interface{}) {
+		err := binary.Write(&buf, binary.LittleEndian, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections:     1,
+		SizeOfOptionalHeader: uint16(binary.Size(pe.OptionalHeader64{})),
+		Characteristics:      pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_DLL,
+	})
+	optionalHeader := pe.OptionalHeader64{
+		Magic:               0x20b,
+		ImageBase:           0x180000000,
+		SectionAlignment:    0x1000,
+		FileAlignment:       0x200,
+		SizeOfImage:         sectionRva + 0x1000,
+		SizeOfHeaders:       sectionOffset,
+		NumberOfRvaAndSizes: 16,
+	}
+	if debugSize != 0 {
+		optionalHeader.DataDirectory[peDirectoryEntryDebug] = pe.DataDirectory{VirtualAddress: sectionRva, Size: debugSize}
+	}
+	write(optionalHeader)
+	write(pe.SectionHeader32{
+		Name:             [8]uint8{'.', 'r', 'd', 'a', 't', 'a'},
+		VirtualSize:      sectionSize,
+		VirtualAddress:   sectionRva,
+		SizeOfRawData:    sectionSize,
+		PointerToRawData: sectionOffset,
+	})
+
+	content := make([]byte, sectionOffset+sectionSize)
+	copy(content, buf.Bytes())
+	copy(content[sectionOffset:], debugData)
+	err := ioutil.WriteFile(path, content, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Debug directory entries at section start and their data after them
+func symbolsTestDebugData(entries ...[]byte) ([]byte, uint32) {
+	const sectionRva = 0x1000
+	const debugDirectorySize = 28
+	debugSize := uint32(len(entries) * debugDirectorySize)
+	data := make([]byte, debugSize)
+	for i, entryData := range entries {
+		entry := data[i*debugDirectorySize:]
+		debugType := uint32(2) // CodeView
+		if !bytes.HasPrefix(entryData, []byte("RSDS")) {
+			debugType = 16 // Repro
+		}
+		binary.LittleEndian.PutUint32(entry[12:], debugType)
+		binary.LittleEndian.PutUint32(entry[16:], uint32(len(entryData)))
+		binary.LittleEndian.PutUint32(entry[20:], sectionRva+uint32(len(data)))
+		data = append(data, entryData...)
+	}
+	return data, debugSize
+}
+
+func symbolsTestRsds(age uint32, pdbPath string) []byte {
+	rsds := []byte("RSDS")
+	rsds = append(rsds, symbolsTestGuid...)
+	rsds = append(rsds, eseTestUint32(age)...)
+	return append(rsds, pdbPath+"\x00"...)
+}
+
+func TestPeGetPdbSignature(t *testing.T) {
+	dir := symbolsTempDir(t)
+	tests := []struct {
+		name      string
+		debugData [][]byte
+		expected  pdbSignature
+		err       bool
+	}{
+		{
+			name:      "CodeView",
+			debugData: [][]byte{symbolsTestRsds(1, `C:\b\s\w\ir\cache\builder\src\out\Release_x64\chrome.dll.pdb`)},
+			expected:  pdbSignature{Name: "chrome.dll.pdb", Guid: symbolsTestGuidString, Age: 1},
+		},
+		{
+			name:      "CodeView after other entry",
+			debugData: [][]byte{{1, 2, 3, 4}, symbolsTestRsds(2, "out/browser.pdb")},
+			expected:  pdbSignature{Name: "browser.pdb", Guid: symbolsTestGuidString, Age: 2},
+		},
+		{
+			name: "no debug directory",
+			err:  true,
+		},
+		{
+			name:      "no CodeView entry",
+			debugData: [][]byte{{1, 2, 3, 4}},
+			err:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			binaryPath := filepath.Join(dir, "chrome.dll")
+			debugData, debugSize := symbolsTestDebugData(test.debugData...)
+			symbolsTestWritePe(t, binaryPath, debugData, debugSize)
+
+			signature, err := peGetPdbSignature(binaryPath)
+			if test.err {
+				if err == nil {
+					t.Errorf("no error, got %v", signature)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.expected.Binary = binaryPath
+			if signature != test.expected {
+				t.Errorf("got %v, expected %v", signature, test.expected)
+			}
+		})
+	}
+}
+
+func TestSymbolsValidateForBinaries(t *testing.T) {
+	oldSymbolStore := *symbolStore
+	defer func() { *symbolStore = oldSymbolStore }()
+	*symbolStore = symbolsTempDir(t)
+
+	binariesDir := symbolsTempDir(t)
+	debugData, debugSize := symbolsTestDebugData(symbolsTestRsds(1, "chrome.dll.pdb"))
+	symbolsTestWritePe(t, filepath.Join(binariesDir, "chrome.dll"), debugData, debugSize)
+	debugData, debugSize = symbolsTestDebugData(symbolsTestRsds(1, "chrome_elf.dll.pdb"))
+	symbolsTestWritePe(t, filepath.Join(binariesDir, "chrome_elf.dll"), debugData, debugSize)
+	srcDir := symbolsTempDir(t)
+	symbolsTestWritePdb(t, filepath.Join(srcDir, "chrome.dll.pdb"), 1, 28)
+
+	err := symbolsImportDir(srcDir, chromeShortName, "64.0.3282.140")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := symbolsLoadIndex(symbolsGetStoreDir(chromeShortName, "64.0.3282.140"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index["chrome.dll.pdb"].Guid != symbolsTestGuidString {
+		t.Errorf("got index %v", index)
+	}
+
+	// chrome_elf.dll.pdb is not imported
+	problems, err := symbolsValidateForBinaries(binariesDir, chromeShortName, "64.0.3282.140")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 {
+		t.Errorf("got problems %v, expected one for chrome_elf.dll", problems)
+	}
+
+	// Stale PDB has the same GUID and other age
+	symbolsTestWritePdb(t, filepath.Join(srcDir, "chrome_elf.dll.pdb"), 2, 28)
+	err = symbolsImportDir(srcDir, chromeShortName, "64.0.3282.140")
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err = symbolsValidateForBinaries(binariesDir, chromeShortName, "64.0.3282.140")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], symbolsTestGuidString+"2") {
+		t.Errorf("got problems %v, expected one for age of chrome_elf.dll.pdb", problems)
+	}
+}
+
+func TestSymbolsDownload(t *testing.T) {
+	srcDir := symbolsTempDir(t)
+	symbolsTestWritePdb(t, filepath.Join(srcDir, "chrome.dll.pdb"), 1, 28)
+	pdb, err := ioutil.ReadFile(filepath.Join(srcDir, "chrome.dll.pdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbolsTestWritePdb(t, filepath.Join(srcDir, "stale.pdb"), 2, 28)
+	stalePdb, err := ioutil.ReadFile(filepath.Join(srcDir, "stale.pdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := symbolsTestGuidString + "1"
+
+	tests := []struct {
+		name  string
+		files map[string]string // URL path > content
+		err   bool
+	}{
+		{
+			name:  "uncompressed",
+			files: map[string]string{"/chrome.dll.pdb/" + key + "/chrome.dll.pdb": string(pdb)},
+		},
+		{
+			name:  "file.ptr",
+			files: map[string]string{"/chrome.dll.pdb/" + key + "/file.ptr": "PATH:" + filepath.Join(srcDir, "chrome.dll.pdb")},
+		},
+		{
+			name:  "file.ptr message",
+			files: map[string]string{"/chrome.dll.pdb/" + key + "/file.ptr": "MSG: not found"},
+			err:   true,
+		},
+		{
+			name:  "truncated",
+			files: map[string]string{"/chrome.dll.pdb/" + key + "/chrome.dll.pdb": string(pdb[:1000])},
+			err:   true,
+		},
+		{
+			name:  "other age",
+			files: map[string]string{"/chrome.dll.pdb/" + key + "/chrome.dll.pdb": string(stalePdb)},
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				content, found := test.files[req.URL.Path]
+				if !found {
+					http.NotFound(rw, req)
+					return
+				}
+				rw.Write([]byte(content))
+			}))
+			defer server.Close()
+			storeDir := symbolsTempDir(t)
+			pdbPath := filepath.Join(storeDir, "chrome.dll.pdb")
+
+			err := symbolsDownload([]string{server.URL}, pdbSignature{Name: "chrome.dll.pdb", Guid: symbolsTestGuidString, Age: 1}, pdbPath)
+			if test.err {
+				if err == nil {
+					t.Errorf("no error")
+				}
+				// Neither broken PDB nor temporary file is left in store
+				files, _ := ioutil.ReadDir(storeDir)
+				if len(files) > 0 {
+					t.Errorf("got files %s in store", files[0].Name())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature, err := pdbGetSignature(pdbPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signature.Key() != key {
+				t.Errorf("got %s, expected %s", signature.Key(), key)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/freetype/truetype"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+	"io/ioutil"
+	"math"
+	"strings"
+	"text/template"
+)
+
+// Y-axis policies of chart theme
+const (
+	axisZero    = "zero"    // from 0 to max bar
+	axisPercent = "percent" // from 0 to 100
+	axisAuto    = "auto"    // from min to max bar
+	axisLog     = "log"     // log10 scale from min positive bar to max bar
+)
+
+// Palettes of browser and diff bar colors
+var chartPalettes = map[string]map[string]string{
+	"default": {},
+	// Okabe-Ito palette is distinguishable with any color vision deficiency
+	"colorblind": {
+		yaBrowserProcessName:            "d55e00",
+		yaBrowserDefaultProcessName:     "cc79a7",
+		chromeProcessName:               "0072b2",
+		chromiumProcessName:             "56b4e9",
+		operaProcessName:                "000000",
+		firefoxProcessName:              "e69f00",
+		microsoftEdgeProcessName:        "009e73",
+		microsoftEdgeContentProcessName: "009e73",
+		"Good":                          "009e73",
+		"Bad":                           "999999",
+	},
+}
+
+// File of -theme, omitted values are defaults:
+//
+//	{
+//		"width": 1024, "height": 400, "barWidth": 60, "fontSize": 10,
+//		"denseBars": 9, "denseBarWidth": 40, "denseFontSize": 8, "denseExtraWidth": 100,
+//		"font": "C:\\Windows\\Fonts\\segoeui.ttf",
+//		"palette": "colorblind",
+//		"colors": {"browser.exe": "ff0000", "Good": "4ce600"},
+//		"axis": {"": "zero", "gpuUsage GPU Percentage": "auto", "procmon": "log"},
+//		"labels": {"bar": "{{.Browser}}: {{.Value}}", "title": "{{.MeasureSet}}"}
+//	}
+type chartTheme struct {
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	BarWidth int     `json:"barWidth"`
+	FontSize float64 `json:"fontSize"`
+	// Chart with more bars is wider and has thinner bars and smaller font
+	DenseBars       int     `json:"denseBars"`
+	DenseBarWidth   int     `json:"denseBarWidth"`
+	DenseFontSize   float64 `json:"denseFontSize"`
+	DenseExtraWidth int     `json:"denseExtraWidth"`
+	// Path to TTF file
+	Font    string            `json:"font"`
+	Palette string            `json:"palette"`
+	Colors  map[string]string `json:"colors"`
+	// Measure set prefix > axis policy, the longest prefix is used, "" is for all charts
+	Axis   map[string]string `json:"axis"`
+	Labels chartThemeLabels  `json:"labels"`
+
+	font *truetype.Font
+	// label > template
+	templates map[string]*template.Template
+}
+
+// Templates of text/template
+type chartThemeLabels struct {
+	// .MeasureSet .Date
+	Title string `json:"title"`
+	// .Browser .Value
+	Bar string `json:"bar"`
+	// .Iteration .Browser .Value
+	Iteration string `json:"iteration"`
+	// .Kind .Competitor .Explain .Percent .Value
+	Diff string `json:"diff"`
+}
+
+var theme = defaultChartTheme()
+
+func defaultChartTheme() *chartTheme {
+	t := &chartTheme{
+		Width:           1024,
+		BarWidth:        60,
+		FontSize:        10,
+		DenseBars:       9,
+		DenseBarWidth:   40,
+		DenseFontSize:   8,
+		DenseExtraWidth: 100,
+		Palette:         "default",
+		Axis:            map[string]string{},
+		Labels: chartThemeLabels{
+			Title:     "{{.MeasureSet}} {{.Date}}",
+			Bar:       "{{.Browser}} ({{.Value}})",
+			Iteration: "{{.Iteration}}: {{.Browser}} ({{.Value}}) ",
+			Diff:      "{{.Kind}} vs {{.Competitor}} ({{.Explain}}) diff {{.Percent}}% ({{.Value}})",
+		},
+	}
+	err := t.parseTemplates()
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Theme values are applied over defaults, palette colors are applied to browser and diff bar colors
+func loadChartTheme(themePath string) error {
+	content, err := ioutil.ReadFile(themePath)
+	if err != nil {
+		return err
+	}
+	t := defaultChartTheme()
+	err = json.Unmarshal(content, t)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %s", themePath, err)
+	}
+
+	for prefix, policy := range t.Axis {
+		switch policy {
+		case axisZero, axisPercent, axisAuto, axisLog:
+		default:
+			return fmt.Errorf("%s: unknown axis policy '%s' of '%s'", themePath, policy, prefix)
+		}
+	}
+	err = t.parseTemplates()
+	if err != nil {
+		return fmt.Errorf("%s: %s", themePath, err)
+	}
+	if t.Font != "" {
+		fontContent, err := ioutil.ReadFile(t.Font)
+		if err != nil {
+			return err
+		}
+		t.font, err = truetype.Parse(fontContent)
+		if err != nil {
+			return fmt.Errorf("%s: %s", t.Font, err)
+		}
+	}
+
+	palette, found := chartPalettes[t.Palette]
+	if !found {
+		return fmt.Errorf("%s: unknown palette '%s'", themePath, t.Palette)
+	}
+	for _, colors := range []map[string]string{palette, t.Colors} {
+		for name, hex := range colors {
+			color := drawing.ColorFromHex(strings.TrimPrefix(hex, "#"))
+			if _, isDiff := diffBarColor[name]; isDiff {
+				diffBarColor[name] = color
+				diffBarStrokeColor[name] = color
+				continue
+			}
+			processNameChartColor[name] = color
+		}
+	}
+
+	theme = t
+	return nil
+}
+
+func (t *chartTheme) parseTemplates() error {
+	t.templates = map[string]*template.Template{}
+	for name, text := range map[string]string{
+		"title":     t.Labels.Title,
+		"bar":       t.Labels.Bar,
+		"iteration": t.Labels.Iteration,
+		"diff":      t.Labels.Diff,
+	} {
+		tpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return fmt.Errorf("label %s: %s", name, err)
+		}
+		t.templates[name] = tpl
+	}
+	return nil
+}
+
+func (t *chartTheme) label(name string, data interface{}) string {
+	buf := &bytes.Buffer{}
+	err := t.templates[name].Execute(buf, data)
+	if err != nil {
+		fmt.Printf("Failed to format %s label: %s\n", name, err)
+	}
+	return buf.String()
+}
+
+// Returns policy of the longest prefix of measure set or default policy of drawer
+func (t *chartTheme) axisPolicy(measureSet, defaultPolicy string) string {
+	policy, matched := defaultPolicy, -1
+	for prefix, p := range t.Axis {
+		if strings.HasPrefix(measureSet, prefix) && len(prefix) > matched {
+			policy, matched = p, len(prefix)
+		}
+	}
+	return policy
+}
+
+// Returns y-axis of policy, max is the upper bound of zero and log axes
+func (t *chartTheme) yAxis(policy string, chartBars []chart.Value, max float64) chart.YAxis {
+	yAxis := chart.YAxis{
+		Style: chart.Style{
+			Show: true,
+		},
+	}
+
+	switch policy {
+	case axisPercent:
+		yAxis.Range = &chart.ContinuousRange{Min: 0, Max: 100}
+	case axisAuto:
+		// Range of bars is calculated by chart
+	case axisLog:
+		min := 0.0
+		for _, bar := range chartBars {
+			if bar.Value > 0 && (min == 0 || bar.Value < min) {
+				min = bar.Value
+			}
+		}
+		if min == 0 || max <= min {
+			yAxis.Range = &chart.ContinuousRange{Min: 0, Max: max}
+			break
+		}
+		r := &logRange{Min: math.Pow(10, math.Floor(math.Log10(min))), Max: max}
+		yAxis.Range = r
+		lastTick := r.Min
+		for tick := r.Min; tick <= max; tick *= 10 {
+			yAxis.Ticks = append(yAxis.Ticks, chart.Tick{Value: tick, Label: chart.FloatValueFormatter(tick)})
+			lastTick = tick
+		}
+		// Labels of close ticks overlap
+		if max > lastTick*2 {
+			yAxis.Ticks = append(yAxis.Ticks, chart.Tick{Value: max, Label: chart.FloatValueFormatter(max)})
+		}
+	default:
+		yAxis.Range = &chart.ContinuousRange{Min: 0, Max: max}
+	}
+
+	return yAxis
+}
+
+// Log10 scale, bars below min are drawn as empty
+type logRange struct {
+	Min    float64
+	Max    float64
+	Domain int
+}
+
+func (r logRange) String() string {
+	return fmt.Sprintf("logRange [%.2f,%.2f] => %d", r.Min, r.Max, r.Domain)
+}
+
+func (r logRange) IsZero() bool {
+	return r.Min == 0 && r.Max == 0 && r.Domain == 0
+}
+
+func (r logRange) GetMin() float64 {
+	return r.Min
+}
+
+func (r *logRange) SetMin(min float64) {
+	r.Min = min
+}
+
+func (r logRange) GetMax() float64 {
+	return r.Max
+}
+
+func (r *logRange) SetMax(max float64) {
+	r.Max = max
+}
+
+func (r logRange) GetDelta() float64 {
+	return r.Max - r.Min
+}
+
+func (r logRange) GetDomain() int {
+	return r.Domain
+}
+
+func (r *logRange) SetDomain(domain int) {
+	r.Domain = domain
+}
+
+func (r logRange) IsDescending() bool {
+	return false
+}
+
+func (r logRange) Translate(value float64) int {
+	if value <= r.Min {
+		return 0
+	}
+	ratio := (math.Log10(value) - math.Log10(r.Min)) / (math.Log10(r.Max) - math.Log10(r.Min))
+	return int(math.Ceil(ratio * float64(r.Domain)))
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	timerResolutionReport = "timerResolution"
+	// Default Windows timer resolution, anything below keeps CPU out of deep C-States
+	timerResolutionDefaultMs = 15.6
+)
+
+type timerResolutionRequest struct {
+	Process           string  `json:"Process"`
+	Resolution        string  `json:"Resolution"`
+	ResolutionMs      float64 `json:"ResolutionMs"`
+	ResidencyMs       float64 `json:"ResidencyMs"`
+	PercentOfScenario float64 `json:"PercentOfScenario"`
+	BelowDefault      bool    `json:"BelowDefault"`
+}
+
+type timerResolutionSummary struct {
+	Browser            string                   `json:"Browser"`
+	Scenario           string                   `json:"Scenario"`
+	Iteration          string                   `json:"Iteration"`
+	ScenarioDurationMs float64                  `json:"ScenarioDurationMs"`
+	Requests           []timerResolutionRequest `json:"Requests"`
+	// Max share among browser processes, requests of processes overlap in time
+	BelowDefaultPercent float64  `json:"BelowDefaultPercent"`
+	Idle                bool     `json:"Idle"`
+	Holds1msInIdle      bool     `json:"Holds1msInIdle"`
+	Violations          []string `json:"Violations"`
+}
+
+type timerResolutionSummarySort []timerResolutionSummary
+
+func (s timerResolutionSummarySort) Len() int {
+	return len(s)
+}
+func (s timerResolutionSummarySort) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s timerResolutionSummarySort) Less(i, j int) bool {
+	if s[i].Scenario != s[j].Scenario {
+		return s[i].Scenario < s[j].Scenario
+	}
+	if s[i].Browser != s[j].Browser {
+		return s[i].Browser < s[j].Browser
+	}
+	return s[i].Iteration < s[j].Iteration
+}
+
+// "1.0ms (msec)" > 1.0
+var timerResolutionHeaderRegExp = regexp.MustCompile(`([0-9]+(\.[0-9]+)?)\s*ms`)
+
+// Returns violations of thresholds, they are results of run and do not prevent other reports
+func generateTimerResolutionReport(files []os.FileInfo) ([]string, error) {
+	var summaries []timerResolutionSummary
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".csv" {
+			continue
+		}
+
+		filePath := filepath.Join(*csvPath, socWatch, f.Name())
+		summary, err := timerResolutionGetSummary(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filePath, err)
+		}
+		if len(summary.Requests) == 0 {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+	if len(summaries) == 0 {
+		return nil, nil
+	}
+	sort.Sort(timerResolutionSummarySort(summaries))
+
+	var violations []string
+	for _, summary := range summaries {
+		for _, violation := range summary.Violations {
+			violations = append(violations, fmt.Sprintf("%s %s %s: %s", summary.Browser, summary.Scenario, summary.Iteration, violation))
+		}
+	}
+
+	reportJsonFileName := timerResolutionReport + ".json"
+	reportJsonFile, err := os.Create(filepath.Join(*csvPath, reportJsonFileName))
+	if err != nil {
+		return nil, err
+	}
+	err = json.NewEncoder(reportJsonFile).Encode(summaries)
+	if err != nil {
+		reportJsonFile.Close()
+		return nil, fmt.Errorf("failed to json encode %s: %s", reportJsonFileName, err)
+	}
+	err = ioClose(reportJsonFileName, reportJsonFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = timerResolutionWriteHtml(timerResolutionReport+".html", summaries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s report: %s", timerResolutionReport, err)
+	}
+
+	return violations, nil
+}
+
+func timerResolutionWriteHtml(fileName string, summaries []timerResolutionSummary) error {
+	t, err := template.New(timerResolutionReport).Parse(timerResolutionReportTpl)
+	if err != nil {
+		return err
+	}
+
+	htmlFile, err := os.Create(filepath.Join(*csvPath, fileName))
+	if err != nil {
+		return err
+	}
+
+	err = t.Execute(htmlFile, summaries)
+	if err != nil {
+		htmlFile.Close()
+		return fmt.Errorf("failed to generate %s: %s", fileName, err)
+	}
+
+	return ioClose(fileName, htmlFile)
+}
+
+func timerResolutionGetSummary(csvFilePath string) (timerResolutionSummary, error) {
+	summary := timerResolutionSummary{}
+	meta, err := generalGetFileMeta(csvFilePath)
+	if err != nil {
+		return summary, err
+	}
+	summary.Browser = meta.browser
+	summary.Scenario = meta.scenarioName
+	summary.Iteration = meta.iteration
+	summary.Idle = timerResolutionIsIdleScenario(meta.scenarioName)
+
+	data, err := socWatchReadFile(csvFilePath)
+	if err != nil {
+		return summary, err
+	}
+	summary.ScenarioDurationMs = data.collectionDuration * 1000
+	if summary.ScenarioDurationMs == 0 {
+		summary.ScenarioDurationMs = *timerScenarioDuration * 1000
+	}
+
+	records := data.sections[socWatchGetSectionIdByTitle(socWatchWakeupAnalysisTimerResolutionRequestsTime)]
+	summary.Requests = timerResolutionGetRequests(records, meta, summary.ScenarioDurationMs)
+
+	belowDefaultMs := map[string]float64{} // process > residency below default resolution
+	for _, request := range summary.Requests {
+		if !request.BelowDefault {
+			continue
+		}
+		belowDefaultMs[request.Process] += request.ResidencyMs
+		if summary.Idle && request.ResolutionMs <= 1.0 && request.ResidencyMs > 0 {
+			summary.Holds1msInIdle = true
+		}
+	}
+	for _, residencyMs := range belowDefaultMs {
+		if summary.ScenarioDurationMs > 0 && residencyMs*100/summary.ScenarioDurationMs > summary.BelowDefaultPercent {
+			summary.BelowDefaultPercent = residencyMs * 100 / summary.ScenarioDurationMs
+		}
+	}
+
+	// Percent of unknown duration stays zero and would pass any limit
+	if *timerMaxBelowDefaultPercent > 0 && summary.ScenarioDurationMs == 0 && len(belowDefaultMs) > 0 {
+		summary.Violations = append(summary.Violations, fmt.Sprintf(
+			"scenario duration is unknown, set -timerScenarioDuration to check limit %.2f%% below %.1fms",
+			*timerMaxBelowDefaultPercent, timerResolutionDefaultMs,
+		))
+	}
+	if *timerMaxBelowDefaultPercent > 0 && summary.BelowDefaultPercent > *timerMaxBelowDefaultPercent {
+		summary.Violations = append(summary.Violations, fmt.Sprintf(
+			"%.2f%% of scenario below %.1fms, limit %.2f%%",
+			summary.BelowDefaultPercent, timerResolutionDefaultMs, *timerMaxBelowDefaultPercent,
+		))
+	}
+	if *timerFailOnIdle1ms && summary.Holds1msInIdle {
+		summary.Violations = append(summary.Violations, "1ms timer requested during idle scenario")
+	}
+
+	return summary, nil
+}
+
+func timerResolutionGetRequests(records [][]string, meta Measure, scenarioDurationMs float64) []timerResolutionRequest {
+	/*
+		Kernel/Application  , 1.0ms (msec)
+		------------------  , ------------
+		websrv.exe(9556)    , 14.53
+		brodefault.exe(9608), 634.90
+	*/
+	var requests []timerResolutionRequest
+	if len(records) == 0 {
+		return requests
+	}
+	colProcess := 0
+	headers := records[0]
+	for _, row := range records {
+		process := strings.Trim(row[colProcess], " ")
+		isBrowserProcess := false
+		for _, browserProcessName := range meta.browserProcesses {
+			if strings.HasPrefix(process, browserProcessName) {
+				isBrowserProcess = true
+				break
+			}
+		}
+		if !isBrowserProcess {
+			continue
+		}
+
+		for colId := colProcess + 1; colId < len(row) && colId < len(headers); colId++ {
+			header := strings.Trim(headers[colId], " ")
+			match := timerResolutionHeaderRegExp.FindStringSubmatch(header)
+			if len(match) < 2 {
+				continue
+			}
+			resolutionMs, err := strconv.ParseFloat(match[1], 64)
+			if err != nil {
+				fmt.Printf("failed parse '%s': %v\n", header, err)
+				continue
+			}
+			residencyMs, err := strconv.ParseFloat(strings.Trim(row[colId], " "), 64)
+			if err != nil {
+				fmt.Printf("failed parse '%s': %v\n", row[colId], err)
+				continue
+			}
+
+			request := timerResolutionRequest{
+				Process:      process,
+				Resolution:   match[0],
+				ResolutionMs: resolutionMs,
+				ResidencyMs:  residencyMs,
+				BelowDefault: resolutionMs < timerResolutionDefaultMs,
+			}
+			if scenarioDurationMs > 0 {
+				request.PercentOfScenario = residencyMs * 100 / scenarioDurationMs
+			}
+			requests = append(requests, request)
+		}
+	}
+
+	return requests
+}
+
+func timerResolutionIsIdleScenario(scenarioName string) bool {
+	if strings.Contains(strings.ToLower(scenarioName), "idle") {
+		return true
+	}
+	for _, idleScenario := range strings.Split(*idleScenarios, ",") {
+		if strings.Trim(idleScenario, " ") == scenarioName {
+			return true
+		}
+	}
+
+	return false
+}
+
+const timerResolutionReportTpl = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8">
+		<title>Timer Resolution Requests</title>
+		<style>
+			table { border-collapse: collapse; }
+			td, th { border: 1px solid #ccc; padding: 2px 6px; }
+			.idle1ms { background: #ffe0e0; }
+			.violation { color: #c00000; }
+		</style>
+	</head>
+	<body>
+		<table>
+			<tr>
+				<th>Scenario</th><th>Browser</th><th>Iteration</th><th>Duration (ms)</th>
+				<th>Process</th><th>Resolution</th><th>Residency (ms)</th><th>Percent of scenario</th>
+			</tr>
+		{{range $summary := . }}
+			<tr {{if $summary.Holds1msInIdle}}class="idle1ms"{{end}}>
+				<td>{{ $summary.Scenario }}{{if $summary.Idle}} (idle){{end}}</td>
+				<td>{{ $summary.Browser }}{{if $summary.Holds1msInIdle}} <b>holds 1ms timer in idle</b>{{end}}</td>
+				<td>{{ $summary.Iteration }}</td>
+				<td>{{ printf "%.0f" $summary.ScenarioDurationMs }}</td>
+				<td colspan="3"><b>Below 15.6ms</b></td>
+				<td><b>{{ printf "%.2f" $summary.BelowDefaultPercent }}%</b></td>
+			</tr>
+			{{ range $request := $summary.Requests }}
+			<tr>
+				<td></td><td></td><td></td><td></td>
+				<td>{{ $request.Process }}</td>
+				<td>{{ $request.Resolution }}</td>
+				<td>{{ printf "%.2f" $request.ResidencyMs }}</td>
+				<td>{{ printf "%.2f" $request.PercentOfScenario }}%</td>
+			</tr>
+			{{ end }}
+			{{ range $violation := $summary.Violations }}
+			<tr><td colspan="8" class="violation">{{ $violation }}</td></tr>
+			{{ end }}
+		{{else}}
+			<tr><td colspan="8"><strong>no rows</strong></td></tr>
+		{{end}}
+		</table>
+	</body>
+</html>`
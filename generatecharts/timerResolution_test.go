@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const timerResolutionTestSocWatchCsv = "Total Collection Duration (sec): 10.00\r\n" +
+	"\r\n" +
+	"Timer Resolution Requests (OS) Summary: Residency (Time)\r\n" +
+	"Kernel/Application  , 1.0ms (msec)\r\n" +
+	"------------------  , ------------\r\n" +
+	"websrv.exe(9556)    , 14.53\r\n" +
+	"brodefault.exe(9608), 634.90\r\n" +
+	"brodefault.exe(8660), 2500.00\r\n" +
+	"\r\n"
+
+func timerResolutionTestSetup(t *testing.T, csv string) []os.FileInfo {
+	dir, err := ioutil.TempDir("", "timerResolution")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	oldCsvPath := *csvPath
+	*csvPath = dir
+	t.Cleanup(func() { *csvPath = oldCsvPath })
+
+	err = os.Mkdir(filepath.Join(dir, socWatch), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := "brodefault_idle_1_socwatch_20180120_224843-1.csv"
+	err = ioutil.WriteFile(filepath.Join(dir, socWatch, fileName), []byte(csv), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, socWatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestGenerateTimerResolutionReport(t *testing.T) {
+	files := timerResolutionTestSetup(t, timerResolutionTestSocWatchCsv)
+
+	violations, err := generateTimerResolutionReport(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) > 0 {
+		t.Errorf("got violations %v without thresholds", violations)
+	}
+
+	html, err := ioutil.ReadFile(filepath.Join(*csvPath, timerResolutionReport+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"brodefault.exe(8660)", "1.0ms", "2500.00", "25.00%", "holds 1ms timer in idle"} {
+		if !strings.Contains(string(html), expected) {
+			t.Errorf("report has no '%s':\n%s", expected, html)
+		}
+	}
+	if strings.Contains(string(html), "websrv.exe") {
+		t.Errorf("report has not browser process websrv.exe")
+	}
+
+	_, err = os.Stat(filepath.Join(*csvPath, timerResolutionReport+".json"))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateTimerResolutionReportUnknownDuration(t *testing.T) {
+	csv := strings.Replace(timerResolutionTestSocWatchCsv, "Total Collection Duration (sec): 10.00\r\n", "", 1)
+	files := timerResolutionTestSetup(t, csv)
+	oldMaxPercent, oldDuration := *timerMaxBelowDefaultPercent, *timerScenarioDuration
+	t.Cleanup(func() { *timerMaxBelowDefaultPercent, *timerScenarioDuration = oldMaxPercent, oldDuration })
+	*timerMaxBelowDefaultPercent = 50
+
+	violations, err := generateTimerResolutionReport(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 || !strings.Contains(violations[0], "scenario duration is unknown") {
+		t.Errorf("got %v, expected unknown duration violation", violations)
+	}
+
+	// 2500ms of 10s scenario is below 50% limit
+	*timerScenarioDuration = 10
+	violations, err = generateTimerResolutionReport(files)
+	if err != nil || len(violations) > 0 {
+		t.Errorf("got %v %v with -timerScenarioDuration", violations, err)
+	}
+}
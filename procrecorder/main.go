@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Samples /proc/<pid>/{stat,status,io} of browser processes into
+// <browser>_<scenario>_<iteration>_procfs_<YYYYMMDD>_<HHMMSS>.csv for generatecharts
+
+const (
+	measureSet           = "procfs"
+	defaultProcPath      = "/proc"
+	fileNameDateTimeTmpl = "20060102_150405"
+	statUtimeField       = 11 // fields after "(comm) "
+	statStimeField       = 12
+)
+
+var header = []string{
+	"timestamp", "pid", "comm", "utime_ms", "stime_ms",
+	"voluntary_ctxt_switches", "nonvoluntary_ctxt_switches", "rss_kb", "read_bytes", "write_bytes",
+}
+
+type sampler struct {
+	procPath  string
+	processes map[string]bool
+	msPerTick float64
+	ioDenied  bool
+	writer    *csv.Writer
+}
+
+func main() {
+	procPath := flag.String("proc", defaultProcPath, "Path to procfs")
+	outPath := flag.String("out", ".", "Path to output directory for CSV file")
+	browser := flag.String("browser", "", "Browser short name like yabro or chrome")
+	scenario := flag.String("scenario", "", "Scenario name")
+	iteration := flag.String("iteration", "0", "Iteration number")
+	processes := flag.String("processes", "", "Comma separated process names (comm) of browser process family like chrome")
+	duration := flag.Duration("duration", 0, "Recording duration like 10m. Default: until SIGINT or SIGTERM")
+	interval := flag.Duration("interval", time.Second, "Sampling interval")
+	clockTicks := flag.Float64("clockTicks", 100, "Clock ticks per second of utime and stime, getconf CLK_TCK")
+	flag.Parse()
+
+	for name, value := range map[string]string{"browser": *browser, "scenario": *scenario, "iteration": *iteration} {
+		if value == "" || strings.Contains(value, "_") {
+			log.Fatalf("-%s must be set and must not contain '_': '%s'", name, value)
+		}
+	}
+	if *processes == "" {
+		log.Fatalf("-processes must be set")
+	}
+
+	s := &sampler{
+		procPath:  *procPath,
+		processes: map[string]bool{},
+		msPerTick: 1000 / *clockTicks,
+	}
+	for _, name := range strings.Split(*processes, ",") {
+		s.processes[strings.TrimSpace(name)] = true
+	}
+
+	start := time.Now()
+	csvFilePath := filepath.Join(*outPath, fmt.Sprintf("%s_%s_%s_%s_%s.csv", *browser, *scenario, *iteration, measureSet, start.Format(fileNameDateTimeTmpl)))
+	err := s.record(csvFilePath, *duration, *interval)
+	if err != nil {
+		log.Fatalf("Failed to record %s: %s", csvFilePath, err)
+	}
+	log.Printf("Recorded %s in %s", csvFilePath, time.Since(start))
+}
+
+func (s *sampler) record(csvFilePath string, duration, interval time.Duration) error {
+	csvFile, err := os.Create(csvFilePath)
+	if err != nil {
+		return err
+	}
+
+	s.writer = csv.NewWriter(csvFile)
+	err = s.writer.Write(header)
+	if err != nil {
+		csvFile.Close()
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	var timeout <-chan time.Time
+	if duration > 0 {
+		timeout = time.After(duration)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for done := false; ; {
+		err = s.writeSample()
+		if err != nil {
+			csvFile.Close()
+			return err
+		}
+		if done {
+			break
+		}
+
+		// Last sample is taken on stop to cover whole scenario
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			done = true
+		case <-stop:
+			done = true
+		}
+	}
+
+	return csvFile.Close()
+}
+
+// All rows of sample share timestamp of sample start
+func (s *sampler) writeSample() error {
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+
+	entries, err := ioutil.ReadDir(s.procPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		pid := entry.Name()
+		if _, err := strconv.Atoi(pid); err != nil {
+			continue
+		}
+
+		row, err := s.readProcess(pid)
+		if err != nil {
+			continue // process exited or is not browser
+		}
+		err = s.writer.Write(append([]string{timestamp, pid}, row...))
+		if err != nil {
+			return err
+		}
+	}
+	s.writer.Flush()
+
+	return s.writer.Error()
+}
+
+// Returns comm, utime_ms, stime_ms, voluntary_ctxt_switches, nonvoluntary_ctxt_switches, rss_kb, read_bytes, write_bytes
+func (s *sampler) readProcess(pid string) ([]string, error) {
+	stat, err := ioutil.ReadFile(filepath.Join(s.procPath, pid, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	// 4242 (chrome) S 1 ... comm may contain spaces and parentheses
+	commStart := strings.Index(string(stat), "(")
+	commEnd := strings.LastIndex(string(stat), ")")
+	if commStart < 0 || commEnd < commStart {
+		return nil, fmt.Errorf("unexpected %s/stat", pid)
+	}
+	comm := string(stat[commStart+1 : commEnd])
+	if !s.processes[comm] {
+		return nil, fmt.Errorf("%s is not browser process", comm)
+	}
+	fields := strings.Fields(string(stat[commEnd+1:]))
+	if len(fields) <= statStimeField {
+		return nil, fmt.Errorf("unexpected %s/stat", pid)
+	}
+	utime, err := strconv.ParseFloat(fields[statUtimeField], 64)
+	if err != nil {
+		return nil, err
+	}
+	stime, err := strconv.ParseFloat(fields[statStimeField], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := readKeyValues(filepath.Join(s.procPath, pid, "status"))
+	if err != nil {
+		return nil, err
+	}
+	// Kernel threads have no VmRSS
+	rss := strings.TrimSuffix(status["VmRSS"], " kB")
+	if rss == "" {
+		rss = "0"
+	}
+
+	// io is readable only by owner of process or root
+	io, err := readKeyValues(filepath.Join(s.procPath, pid, "io"))
+	if err != nil {
+		if !s.ioDenied {
+			log.Printf("Failed to read %s/io, I/O bytes are recorded as 0: %s", pid, err)
+			s.ioDenied = true
+		}
+		io = map[string]string{"read_bytes": "0", "write_bytes": "0"}
+	}
+
+	return []string{
+		comm,
+		strconv.FormatFloat(utime*s.msPerTick, 'f', -1, 64),
+		strconv.FormatFloat(stime*s.msPerTick, 'f', -1, 64),
+		status["voluntary_ctxt_switches"],
+		status["nonvoluntary_ctxt_switches"],
+		rss,
+		io["read_bytes"],
+		io["write_bytes"],
+	}, nil
+}
+
+// Reads "Key:	value" lines of /proc/<pid>/status or /proc/<pid>/io
+func readKeyValues(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return values, scanner.Err()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes fake /proc with browser process 4242 which has spaces and parentheses in comm,
+// browser process 4243 without readable io, kernel thread 2 and non-process entries
+func writeFakeProc(t *testing.T) string {
+	procPath, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(procPath) })
+
+	files := map[string]string{
+		"4242/stat":   "4242 (Chrome (IO) x) S 1 4242 4242 0 -1 4194560 52731 0 0 0 152 31 0 0 20 0 24 0 18226 1281536000 45855 18446744073709551615\n",
+		"4242/status": "Name:\tChrome (IO) x\nState:\tS (sleeping)\nVmRSS:\t  183420 kB\nvoluntary_ctxt_switches:\t2048\nnonvoluntary_ctxt_switches:\t51\n",
+		"4242/io":     "rchar: 2012\nwchar: 1024\nread_bytes: 1048576\nwrite_bytes: 4096\n",
+		"4243/stat":   "4243 (chrome) S 4242 4242 4242 0 -1 4194560 1000 0 0 0 10 5 0 0 20 0 4 0 18300 281536000 5855 18446744073709551615\n",
+		"4243/status": "Name:\tchrome\nVmRSS:\t  20480 kB\nvoluntary_ctxt_switches:\t20\nnonvoluntary_ctxt_switches:\t1\n",
+		"2/stat":      "2 (kthreadd) S 0 0 0 0 -1 2129984 0 0 0 0 0 0 0 0 20 0 1 0 2 0 0 18446744073709551615\n",
+		"2/status":    "Name:\tkthreadd\nvoluntary_ctxt_switches:\t300\nnonvoluntary_ctxt_switches:\t0\n",
+		"self/stat":   "4300 (procrecorder) R 1 4300 4300 0 -1 4194304 100 0 0 0 1 0 0 0 20 0 1 0 18400 0 0 18446744073709551615\n",
+		"uptime":      "18484.31 71021.92\n",
+	}
+	for path, content := range files {
+		path = filepath.Join(procPath, path)
+		err = os.MkdirAll(filepath.Dir(path), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return procPath
+}
+
+func TestReadProcess(t *testing.T) {
+	procPath := writeFakeProc(t)
+	s := &sampler{
+		procPath:  procPath,
+		processes: map[string]bool{"Chrome (IO) x": true, "chrome": true, "kthreadd": true},
+		msPerTick: 10,
+	}
+
+	tests := []struct {
+		pid      string
+		expected []string
+	}{
+		{"4242", []string{"Chrome (IO) x", "1520", "310", "2048", "51", "183420", "1048576", "4096"}},
+		// io of other user's process is not readable
+		{"4243", []string{"chrome", "100", "50", "20", "1", "20480", "0", "0"}},
+		// Kernel thread has no VmRSS
+		{"2", []string{"kthreadd", "0", "0", "300", "0", "0", "0", "0"}},
+	}
+	for _, test := range tests {
+		got, err := s.readProcess(test.pid)
+		if err != nil {
+			t.Errorf("%s: %v", test.pid, err)
+			continue
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.pid, got, test.expected)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%s: got %v, expected %v", test.pid, got, test.expected)
+				break
+			}
+		}
+	}
+
+	s.processes = map[string]bool{"chrome": true}
+	_, err := s.readProcess("4242")
+	if err == nil {
+		t.Errorf("no error for not browser process")
+	}
+	_, err = s.readProcess("4244")
+	if err == nil {
+		t.Errorf("no error for exited process")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	procPath := writeFakeProc(t)
+	s := &sampler{
+		procPath:  procPath,
+		processes: map[string]bool{"Chrome (IO) x": true, "chrome": true},
+		msPerTick: 10,
+	}
+	csvFilePath := filepath.Join(procPath, "chrome_youtube_0_procfs_20180120_224843.csv")
+
+	err := s.record(csvFilePath, 100*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csvFile, err := os.Open(csvFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer csvFile.Close()
+	records, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, title := range header {
+		if records[0][i] != title {
+			t.Errorf("header: got %v, expected %v", records[0], header)
+			break
+		}
+	}
+	// First sample at start, then every interval and last one at stop, browser processes in every sample
+	samples := records[1:]
+	if len(samples) < 4 || len(samples)%2 != 0 {
+		t.Fatalf("got %d rows of 2 processes", len(samples))
+	}
+	for i, row := range samples {
+		if row[1] != "4242" && row[1] != "4243" {
+			t.Errorf("row %d: got process %v", i+2, row)
+		}
+		_, err := time.Parse(time.RFC3339Nano, row[0])
+		if err != nil {
+			t.Errorf("row %d: %v", i+2, err)
+		}
+		if i%2 == 1 && row[0] != samples[i-1][0] {
+			t.Errorf("row %d: got timestamp %s, expected timestamp of sample %s", i+2, row[0], samples[i-1][0])
+		}
+	}
+	if !s.ioDenied {
+		t.Errorf("unreadable io is not reported")
+	}
+}
@@ -0,0 +1,15 @@
+IF [%GOPATH%] == [] (
+    echo "Skip build: GOPATH variable is not set. Exit."
+    exit 0
+)
+
+set PKGNAME=raplrecorder
+set LOCALPATH=%~dp0
+
+mklink /J "%GOPATH%\src\%PKGNAME%" "%LOCALPATH%"
+
+set GOOS=linux
+set GOARCH=amd64
+go build -o "..\bin\%PKGNAME%.linux" %PKGNAME%
+
+rmdir "%GOPATH%\src\%PKGNAME%"
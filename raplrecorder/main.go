@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Samples energy counters of /sys/class/powercap/intel-rapl:* into
+// <browser>_<scenario>_<iteration>_rapl_<YYYYMMDD>_<HHMMSS>.csv for generatecharts
+
+const (
+	measureSet           = "rapl"
+	defaultPowercapPath  = "/sys/class/powercap"
+	zoneGlob             = "intel-rapl:*"
+	fileName             = "name"
+	fileEnergy           = "energy_uj"
+	fileMaxEnergyRange   = "max_energy_range_uj"
+	fileNameDateTimeTmpl = "20060102_150405"
+)
+
+type zone struct {
+	id          string
+	path        string
+	name        string
+	energyRange string
+}
+
+func main() {
+	powercapPath := flag.String("powercap", defaultPowercapPath, "Path to powercap sysfs class directory")
+	outPath := flag.String("out", ".", "Path to output directory for CSV file")
+	browser := flag.String("browser", "", "Browser short name like yabro or chrome")
+	scenario := flag.String("scenario", "", "Scenario name")
+	iteration := flag.String("iteration", "0", "Iteration number")
+	duration := flag.Duration("duration", 0, "Recording duration like 10m. Default: until SIGINT or SIGTERM")
+	interval := flag.Duration("interval", time.Second, "Sampling interval")
+	flag.Parse()
+
+	for name, value := range map[string]string{"browser": *browser, "scenario": *scenario, "iteration": *iteration} {
+		if value == "" || strings.Contains(value, "_") {
+			log.Fatalf("-%s must be set and must not contain '_': '%s'", name, value)
+		}
+	}
+
+	zones, err := getZones(*powercapPath)
+	if err != nil {
+		log.Fatalf("Failed to get RAPL zones: %s", err)
+	}
+
+	start := time.Now()
+	csvFilePath := filepath.Join(*outPath, fmt.Sprintf("%s_%s_%s_%s_%s.csv", *browser, *scenario, *iteration, measureSet, start.Format(fileNameDateTimeTmpl)))
+	err = record(csvFilePath, zones, *duration, *interval)
+	if err != nil {
+		log.Fatalf("Failed to record %s: %s", csvFilePath, err)
+	}
+	log.Printf("Recorded %s in %s", csvFilePath, time.Since(start))
+}
+
+// Returns package zones like intel-rapl:0 and subzones like intel-rapl:0:0
+func getZones(powercapPath string) ([]zone, error) {
+	paths, err := filepath.Glob(filepath.Join(powercapPath, zoneGlob))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no %s zones in %s", zoneGlob, powercapPath)
+	}
+	sort.Strings(paths)
+
+	var zones []zone
+	for _, path := range paths {
+		z := zone{id: filepath.Base(path), path: path}
+		z.name, err = readValue(filepath.Join(path, fileName))
+		if err != nil {
+			return nil, err
+		}
+		z.energyRange, err = readValue(filepath.Join(path, fileMaxEnergyRange))
+		if err != nil {
+			return nil, err
+		}
+		// energy_uj is readable only by root since Linux 5.10
+		_, err = readValue(filepath.Join(path, fileEnergy))
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, z)
+	}
+
+	return zones, nil
+}
+
+func record(csvFilePath string, zones []zone, duration, interval time.Duration) error {
+	csvFile, err := os.Create(csvFilePath)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(csvFile)
+	err = w.Write([]string{"timestamp", "zone", "name", fileEnergy, fileMaxEnergyRange})
+	if err != nil {
+		csvFile.Close()
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	var timeout <-chan time.Time
+	if duration > 0 {
+		timeout = time.After(duration)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for done := false; ; {
+		err = writeSample(w, zones)
+		if err != nil {
+			csvFile.Close()
+			return err
+		}
+		if done {
+			break
+		}
+
+		// Last sample is taken on stop to cover whole scenario
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			done = true
+		case <-stop:
+			done = true
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		csvFile.Close()
+		return err
+	}
+
+	return csvFile.Close()
+}
+
+func writeSample(w *csv.Writer, zones []zone) error {
+	for _, z := range zones {
+		energy, err := readValue(filepath.Join(z.path, fileEnergy))
+		if err != nil {
+			return err
+		}
+		err = w.Write([]string{time.Now().UTC().Format(time.RFC3339Nano), z.id, z.name, energy, z.energyRange})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+func readValue(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes fake /sys/class/powercap with package zone intel-rapl:0, its subzone intel-rapl:0:0
+// and intel-rapl control type directory which is not a zone
+func writeFakePowercap(t *testing.T) string {
+	powercapPath, err := ioutil.TempDir("", "powercap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(powercapPath) })
+
+	files := map[string]string{
+		"intel-rapl/enabled":                    "1\n",
+		"intel-rapl:0/name":                     "package-0\n",
+		"intel-rapl:0/energy_uj":                "17436427129\n",
+		"intel-rapl:0/max_energy_range_uj":      "262143328850\n",
+		"intel-rapl:0:0/name":                   "core\n",
+		"intel-rapl:0:0/energy_uj":              "5871298370\n",
+		"intel-rapl:0:0/max_energy_range_uj":    "262143328850\n",
+		"intel-rapl:0/intel-rapl:0:0/energy_uj": "5871298370\n",
+	}
+	for path, content := range files {
+		path = filepath.Join(powercapPath, path)
+		err = os.MkdirAll(filepath.Dir(path), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return powercapPath
+}
+
+func TestGetZones(t *testing.T) {
+	powercapPath := writeFakePowercap(t)
+
+	zones, err := getZones(powercapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []zone{
+		{id: "intel-rapl:0", path: filepath.Join(powercapPath, "intel-rapl:0"), name: "package-0", energyRange: "262143328850"},
+		{id: "intel-rapl:0:0", path: filepath.Join(powercapPath, "intel-rapl:0:0"), name: "core", energyRange: "262143328850"},
+	}
+	if len(zones) != len(expected) {
+		t.Fatalf("got %v, expected %v", zones, expected)
+	}
+	for i := range expected {
+		if zones[i] != expected[i] {
+			t.Errorf("got %v, expected %v", zones[i], expected[i])
+		}
+	}
+}
+
+func TestGetZonesErrors(t *testing.T) {
+	empty, err := ioutil.TempDir("", "powercap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(empty)
+	_, err = getZones(empty)
+	if err == nil {
+		t.Errorf("no error for powercap without zones")
+	}
+
+	// energy_uj is readable only by root
+	powercapPath := writeFakePowercap(t)
+	err = os.Remove(filepath.Join(powercapPath, "intel-rapl:0:0", fileEnergy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = getZones(powercapPath)
+	if err == nil {
+		t.Errorf("no error for zone without %s", fileEnergy)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	powercapPath := writeFakePowercap(t)
+	zones, err := getZones(powercapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvFilePath := filepath.Join(powercapPath, "chrome_youtube_0_rapl_20180120_224843.csv")
+
+	err = record(csvFilePath, zones, 100*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csvFile, err := os.Open(csvFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer csvFile.Close()
+	records, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := []string{"timestamp", "zone", "name", fileEnergy, fileMaxEnergyRange}
+	for i, title := range header {
+		if records[0][i] != title {
+			t.Errorf("header: got %v, expected %v", records[0], header)
+			break
+		}
+	}
+	// First sample at start, then every interval and last one at stop
+	samples := records[1:]
+	if len(samples) < 2*len(zones) || len(samples)%len(zones) != 0 {
+		t.Fatalf("got %d rows of %d zones", len(samples), len(zones))
+	}
+	for i, row := range samples {
+		z := zones[i%len(zones)]
+		if row[1] != z.id || row[2] != z.name || row[4] != z.energyRange {
+			t.Errorf("row %d: got %v, expected zone %v", i+2, row, z)
+		}
+		_, err := time.Parse(time.RFC3339Nano, row[0])
+		if err != nil {
+			t.Errorf("row %d: %v", i+2, err)
+		}
+	}
+	if samples[0][3] != "17436427129" || samples[1][3] != "5871298370" {
+		t.Errorf("got energy %s and %s", samples[0][3], samples[1][3])
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Requests are authenticated by token or HMAC signature configured in remoteagent.json,
+// commands are executed only if executable, arguments, working directory and environment are in allowlist:
+//
+//	{
+//		"token": "secret",
+//		"hmacKey": "secret",
+//		"allow": [
+//			{"cmd": "websrv.exe", "args": ["-stopAfter \\d+ -proxyTo \"[^\"]+\""], "cwd": ["C:\\websrv"], "maxTimeout": "1h"},
+//			{"cmd": "C:\\wpr\\wpr.exe", "args": [".*"], "env": ["WPR_LOG"]}
+//		]
+//	}
+//
+// Token is sent as "Authorization: Bearer <token>".
+// Signature is sent as hex of HMAC-SHA256 of "<timestamp>\n<method>\n<path>\n<query>\n<body>" in X-RemoteAgent-Signature
+// with unix timestamp in X-RemoteAgent-Timestamp, signature is accepted once, query is without "?".
+// Cmd with path separators must be absolute path. Cmd without them matches only the same bare name
+// which is found in PATH, executables in web root are never run as they may be uploaded.
+// Args are regexps of whole arguments string, rule without args allows command without arguments only.
+// Cwd of command must be in one of directories of rule, env variables of command must be in env of rule,
+// timeout of command must not exceed maxTimeout of rule, maxTimeout is timeout of command without one.
+const (
+	authHeaderTimestamp = "X-RemoteAgent-Timestamp"
+	authHeaderSignature = "X-RemoteAgent-Signature"
+	authMaxClockSkew    = 5 * time.Minute
+	authMaxBodySize     = 1 << 20
+)
+
+type RemoteAgentAllowRule struct {
+	Cmd        string   `json:"cmd"`
+	Args       []string `json:"args"`
+	Cwd        []string `json:"cwd"`
+	Env        []string `json:"env"`
+	MaxTimeout string   `json:"maxTimeout"`
+
+	argsRegexps []*regexp.Regexp
+	maxTimeout  time.Duration
+}
+
+var (
+	// Signatures accepted during clock skew window > expiration time
+	authUsedSignatures   = map[string]time.Time{}
+	authUsedSignaturesMu sync.Mutex
+)
+
+func (rac *RemoteAgentConfig) compileAllowlist() error {
+	for i := range rac.Allow {
+		rule := &rac.Allow[i]
+		if rule.Cmd == "" {
+			return fmt.Errorf("allow rule %d has empty cmd", i)
+		}
+		if cmd := allowRuleCmdPath(rule.Cmd); strings.ContainsAny(cmd, `/\`) && !filepath.IsAbs(cmd) {
+			return fmt.Errorf("allow rule %d cmd '%s' is neither absolute path nor executable name", i, rule.Cmd)
+		}
+		for _, pattern := range rule.Args {
+			re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+			if err != nil {
+				return fmt.Errorf("allow rule %d '%s' args pattern '%s': %s", i, rule.Cmd, pattern, err)
+			}
+			rule.argsRegexps = append(rule.argsRegexps, re)
+		}
+		if rule.MaxTimeout != "" {
+			maxTimeout, err := time.ParseDuration(rule.MaxTimeout)
+			if err != nil {
+				return fmt.Errorf("allow rule %d '%s' maxTimeout: %s", i, rule.Cmd, err)
+			}
+			rule.maxTimeout = maxTimeout
+		}
+	}
+	return nil
+}
+
+// Returns error if request is neither signed by HMAC key nor has token
+func (rac RemoteAgentConfig) authenticate(req *http.Request, body []byte) error {
+	if rac.Token == "" && rac.HmacKey == "" {
+		return fmt.Errorf("neither token nor hmacKey is configured in %s", configFileName)
+	}
+
+	if signature := req.Header.Get(authHeaderSignature); signature != "" {
+		if rac.HmacKey == "" {
+			return fmt.Errorf("hmacKey is not configured")
+		}
+		return rac.checkSignature(req, body, signature)
+	}
+
+	if rac.Token == "" {
+		return fmt.Errorf("no %s header", authHeaderSignature)
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return fmt.Errorf("no Authorization header")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(rac.Token)) != 1 {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
+func (rac RemoteAgentConfig) checkSignature(req *http.Request, body []byte, signature string) error {
+	timestamp := req.Header.Get(authHeaderTimestamp)
+	unixTime, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s '%s'", authHeaderTimestamp, timestamp)
+	}
+	signedAt := time.Unix(unixTime, 0)
+	if skew := time.Since(signedAt); skew > authMaxClockSkew || skew < -authMaxClockSkew {
+		return fmt.Errorf("%s '%s' is out of %s", authHeaderTimestamp, timestamp, authMaxClockSkew)
+	}
+
+	mac := hmac.New(sha256.New, []byte(rac.HmacKey))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n", timestamp, req.Method, req.URL.Path, req.URL.RawQuery)
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	authUsedSignaturesMu.Lock()
+	defer authUsedSignaturesMu.Unlock()
+	now := time.Now()
+	for s, expires := range authUsedSignatures {
+		if now.After(expires) {
+			delete(authUsedSignatures, s)
+		}
+	}
+	if _, used := authUsedSignatures[expected]; used {
+		return fmt.Errorf("signature is already used")
+	}
+	authUsedSignatures[expected] = signedAt.Add(authMaxClockSkew)
+
+	return nil
+}
+
+// Returns timeout of command or error if there is no allow rule of command
+func (rac RemoteAgentConfig) allowed(remoteCmd RemoteAgentCommand, timeout time.Duration) (time.Duration, error) {
+	var reasons []string
+	for _, rule := range rac.Allow {
+		if !allowRuleMatchesCmd(rule.Cmd, remoteCmd.Cmd) || !allowRuleMatchesArgs(rule, remoteCmd.Args) {
+			continue
+		}
+		if remoteCmd.Cwd != "" && !allowRuleMatchesCwd(rule.Cwd, remoteCmd.Cwd) {
+			reasons = append(reasons, fmt.Sprintf("cwd '%s' is not allowed", remoteCmd.Cwd))
+			continue
+		}
+		if name, found := allowRuleFirstDeniedEnv(rule.Env, remoteCmd.Env); found {
+			reasons = append(reasons, fmt.Sprintf("env %s is not allowed", name))
+			continue
+		}
+		if rule.maxTimeout > 0 {
+			if timeout > rule.maxTimeout {
+				reasons = append(reasons, fmt.Sprintf("timeout %s exceeds %s", timeout, rule.maxTimeout))
+				continue
+			}
+			if timeout == 0 {
+				timeout = rule.maxTimeout
+			}
+		}
+		return timeout, nil
+	}
+	if len(reasons) > 0 {
+		return 0, fmt.Errorf("command '%s' '%s': %s", remoteCmd.Cmd, remoteCmd.Args, strings.Join(reasons, ", "))
+	}
+	return 0, fmt.Errorf("command '%s' '%s' is not in allowlist", remoteCmd.Cmd, remoteCmd.Args)
+}
+
+func allowRuleMatchesArgs(rule RemoteAgentAllowRule, args string) bool {
+	if len(rule.argsRegexps) == 0 && strings.TrimSpace(args) == "" {
+		return true
+	}
+	for _, re := range rule.argsRegexps {
+		if re.MatchString(args) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cwd must be absolute and in one of directories
+func allowRuleMatchesCwd(dirs []string, cwd string) bool {
+	if !filepath.IsAbs(cwd) {
+		return false
+	}
+	cwd = filepath.Clean(cwd)
+	for _, dir := range dirs {
+		if runtime.GOOS == "linux" {
+			dir = strings.Replace(dir, `\`, "/", -1)
+		}
+		dir = filepath.Clean(dir)
+		if runtime.GOOS == "windows" {
+			dir, cwd = strings.ToLower(dir), strings.ToLower(cwd)
+		}
+		rel, err := filepath.Rel(dir, cwd)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns name of the first variable of env which is not in names
+func allowRuleFirstDeniedEnv(names []string, env map[string]string) (string, bool) {
+	var denied []string
+	for name := range env {
+		allowed := false
+		for _, n := range names {
+			if n == name || (runtime.GOOS == "windows" && strings.EqualFold(n, name)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			denied = append(denied, name)
+		}
+	}
+	if len(denied) == 0 {
+		return "", false
+	}
+	sort.Strings(denied)
+	return denied[0], true
+}
+
+// Rule without path matches bare name only, so "C:\webroot\websrv.exe" does not match "websrv.exe"
+func allowRuleMatchesCmd(ruleCmd, cmd string) bool {
+	ruleCmd = allowRuleCmdPath(ruleCmd)
+	if !strings.ContainsAny(ruleCmd, `/\`) {
+		if strings.ContainsAny(cmd, `/\`) {
+			return false
+		}
+	} else {
+		ruleCmd = filepath.Clean(ruleCmd)
+		cmd = filepath.Clean(cmd)
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(ruleCmd, cmd)
+	}
+	return ruleCmd == cmd
+}
+
+func allowRuleCmdPath(ruleCmd string) string {
+	if runtime.GOOS == "linux" {
+		return strings.Replace(ruleCmd, `\`, "/", -1)
+	}
+	return ruleCmd
+}
+
+// Returns true if executable resolved from PATH or rule is in web root, files there may be uploaded
+func (webSrv WebSrv) inWebRoot(executable string) bool {
+	root, err := filepath.EvalSymlinks(webSrv.webRoot)
+	if err != nil {
+		root = webSrv.webRoot
+	}
+	resolved, err := filepath.EvalSymlinks(executable)
+	if err != nil {
+		resolved = executable
+		if dir, err := filepath.EvalSymlinks(filepath.Dir(executable)); err == nil {
+			resolved = filepath.Join(dir, filepath.Base(executable))
+		}
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return true
+	}
+	return allowRuleMatchesCwd([]string{root}, resolved)
+}
+
+// Logs rejected request with client address
+func rejectRequest(rw http.ResponseWriter, req *http.Request, code int, reason error) {
+	logger.Printf("rejected %s %s from %s: %s\r\n", req.Method, req.URL.Path, req.RemoteAddr, reason)
+	http.Error(rw, http.StatusText(code), code)
+}
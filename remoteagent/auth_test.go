@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func authTestSign(key, timestamp, method, path, query, body string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", timestamp, method, path, query, body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestCheckSignature(t *testing.T) {
+	rac := RemoteAgentConfig{HmacKey: "secret"}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body := `{"cmd": "wpr.exe", "args": "-cancel"}`
+	tests := []struct {
+		name      string
+		target    string
+		signature string
+		err       bool
+	}{
+		{"signed query", "/files/log.txt?offset=10", authTestSign("secret", timestamp, "PUT", "/files/log.txt", "offset=10", body), false},
+		{"unsigned query", "/files/log.txt?offset=10", authTestSign("secret", timestamp, "PUT", "/files/log.txt", "", body), true},
+		{"changed query", "/files/log.txt?offset=0", authTestSign("secret", timestamp, "PUT", "/files/log.txt", "offset=10", body), true},
+		{"other key", "/", authTestSign("other", timestamp, "PUT", "/", "", body), true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("PUT", test.target, nil)
+		req.Header.Set(authHeaderTimestamp, timestamp)
+		err := rac.checkSignature(req, []byte(body), test.signature)
+		if test.err != (err != nil) {
+			t.Errorf("%s: got error %v, expected error %v", test.name, err, test.err)
+		}
+	}
+
+	// Signature is accepted once
+	signature := authTestSign("secret", timestamp, "PUT", "/", "", body)
+	req := httptest.NewRequest("PUT", "/", nil)
+	req.Header.Set(authHeaderTimestamp, timestamp)
+	err := rac.checkSignature(req, []byte(body), signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rac.checkSignature(req, []byte(body), signature)
+	if err == nil {
+		t.Errorf("no error for used signature")
+	}
+}
+
+func TestAllowRuleMatchesCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("paths are unix ones")
+	}
+	tests := []struct {
+		ruleCmd  string
+		cmd      string
+		expected bool
+	}{
+		{"websrv.exe", "websrv.exe", true},
+		{"websrv.exe", "/opt/agent/webroot/websrv.exe", false},
+		{"websrv.exe", "uploads/websrv.exe", false},
+		{"websrv.exe", "./websrv.exe", false},
+		{"/opt/wpr/wpr.exe", "/opt/wpr/wpr.exe", true},
+		{"/opt/wpr/wpr.exe", "/opt/wpr/../wpr/wpr.exe", true},
+		{"/opt/wpr/wpr.exe", "wpr.exe", false},
+		{"/opt/wpr/wpr.exe", "/opt/agent/webroot/wpr.exe", false},
+	}
+
+	for _, test := range tests {
+		if got := allowRuleMatchesCmd(test.ruleCmd, test.cmd); got != test.expected {
+			t.Errorf("rule '%s' cmd '%s': got %v, expected %v", test.ruleCmd, test.cmd, got, test.expected)
+		}
+	}
+}
+
+func TestCompileAllowlist(t *testing.T) {
+	tests := []struct {
+		rule RemoteAgentAllowRule
+		err  bool
+	}{
+		{RemoteAgentAllowRule{Cmd: "websrv.exe", Args: []string{`-stopAfter \d+`}, MaxTimeout: "1h"}, false},
+		{RemoteAgentAllowRule{Cmd: filepath.Join(os.TempDir(), "wpr.exe")}, false},
+		{RemoteAgentAllowRule{Cmd: filepath.Join("webroot", "websrv.exe")}, true},
+		{RemoteAgentAllowRule{Cmd: ""}, true},
+		{RemoteAgentAllowRule{Cmd: "websrv.exe", Args: []string{`(`}}, true},
+		{RemoteAgentAllowRule{Cmd: "websrv.exe", MaxTimeout: "1 hour"}, true},
+	}
+
+	for _, test := range tests {
+		rac := RemoteAgentConfig{Allow: []RemoteAgentAllowRule{test.rule}}
+		err := rac.compileAllowlist()
+		if test.err != (err != nil) {
+			t.Errorf("rule %v: got error %v, expected error %v", test.rule, err, test.err)
+		}
+	}
+}
+
+func TestInWebRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remoteagent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	webSrv := WebSrv{webRoot: filepath.Join(dir, "webroot")}
+	err = os.MkdirAll(filepath.Join(webSrv.webRoot, "uploads"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		executable string
+		expected   bool
+	}{
+		{filepath.Join(webSrv.webRoot, "uploads", "websrv.exe"), true},
+		{filepath.Join(webSrv.webRoot, "..", "webroot", "websrv.exe"), true},
+		{filepath.Join(dir, "websrv.exe"), false},
+		{filepath.Join(dir, "webroot2", "websrv.exe"), false},
+	}
+	for _, test := range tests {
+		if got := webSrv.inWebRoot(test.executable); got != test.expected {
+			t.Errorf("%s: got %v, expected %v", test.executable, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Files are transferred inside of web root only:
+//
+//	GET|HEAD /files/{path} downloads file with Range support or lists directory
+//	PUT /files/{path} uploads file or chunk of it with "Content-Range: bytes {start}-{end}/{total}"
+//	GET /zip/{path} downloads directory as zip archive
+//
+// SHA-256 of file is sent in X-RemoteAgent-Sha256 header, of zip archive in trailer. Checksum of file is cached
+// while its size and modification time are the same, Range request gets it only if it is cached.
+// Uploaded file is verified by X-RemoteAgent-Sha256 if it is set on the last chunk.
+// Chunks are written to {path}.part, size of it is sent in X-RemoteAgent-Offset to resume upload from.
+const (
+	filesHeaderSha256  = "X-RemoteAgent-Sha256"
+	filesHeaderOffset  = "X-RemoteAgent-Offset"
+	filesPartExt       = ".part"
+	filesMaxChunkSize  = 64 << 20
+	filesUrlPrefix     = "/files/"
+	filesZipUrlPrefix  = "/zip/"
+	filesDirPermission = 0755
+	filesMaxChecksums  = 1000
+)
+
+type fileChecksum struct {
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+var (
+	// File path > checksum of file version
+	fileChecksums   = map[string]fileChecksum{}
+	fileChecksumsMu sync.Mutex
+)
+
+type fileInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Dir     bool      `json:"dir"`
+	ModTime time.Time `json:"modTime"`
+	Sha256  string    `json:"sha256,omitempty"`
+}
+
+// Returns path in web root, symlinks out of web root are not followed
+func (webSrv WebSrv) sandboxPath(urlPath string) (string, error) {
+	if strings.Contains(urlPath, "\x00") || (runtime.GOOS == "windows" && strings.Contains(urlPath, ":")) {
+		return "", fmt.Errorf("invalid path '%s'", urlPath)
+	}
+	root, err := filepath.EvalSymlinks(webSrv.webRoot)
+	if err != nil {
+		return "", err
+	}
+	filePath := filepath.Join(root, filepath.FromSlash(path.Clean("/"+urlPath)))
+
+	// The nearest existing parent must be in web root after symlinks are resolved
+	existing := filePath
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("path '%s' is out of web root", urlPath)
+	}
+
+	return filePath, nil
+}
+
+// GET, HEAD and PUT /files/{path}
+func (webSrv WebSrv) files(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	switch req.Method {
+	case "GET", "HEAD":
+		webSrv.downloadFile(rw, req)
+	case "PUT":
+		webSrv.uploadFile(rw, req)
+	default:
+		rejectRequest(rw, req, 405, fmt.Errorf("method %s not allowed", req.Method))
+	}
+}
+
+func (webSrv WebSrv) downloadFile(rw http.ResponseWriter, req *http.Request) {
+	err := webSrv.config.authenticate(req, nil)
+	if err != nil {
+		rejectRequest(rw, req, 401, err)
+		return
+	}
+	filePath, err := webSrv.sandboxPath(strings.TrimPrefix(req.URL.Path, filesUrlPrefix))
+	if err != nil {
+		rejectRequest(rw, req, 403, err)
+		return
+	}
+
+	if part, err := os.Stat(filePath + filesPartExt); err == nil {
+		rw.Header().Set(filesHeaderOffset, strconv.FormatInt(part.Size(), 10))
+	}
+
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		http.Error(rw, fmt.Sprintf("%s not found", req.URL.Path), 404)
+		return
+	}
+	if err != nil {
+		logger.Printf("failed to open %s: %s\r\n", filePath, err)
+		http.Error(rw, err.Error(), 500)
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(rw, err.Error(), 500)
+		return
+	}
+	if stat.IsDir() {
+		writeDirList(rw, f)
+		return
+	}
+
+	checksum, err := cachedFileSha256(filePath, f, stat, req.Header.Get("Range") == "")
+	if err != nil {
+		logger.Printf("failed to read %s: %s\r\n", filePath, err)
+		http.Error(rw, err.Error(), 500)
+		return
+	}
+	if checksum != "" {
+		rw.Header().Set(filesHeaderSha256, checksum)
+	}
+	http.ServeContent(rw, req, stat.Name(), stat.ModTime(), f)
+}
+
+func writeDirList(rw http.ResponseWriter, dir *os.File) {
+	entries, err := dir.Readdir(-1)
+	if err != nil {
+		http.Error(rw, err.Error(), 500)
+		return
+	}
+	list := []fileInfo{}
+	for _, entry := range entries {
+		list = append(list, fileInfo{Name: entry.Name(), Size: entry.Size(), Dir: entry.IsDir(), ModTime: entry.ModTime()})
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(rw).Encode(list)
+	if err != nil {
+		logger.Printf("failed to write list of %s: %s\r\n", dir.Name(), err)
+	}
+}
+
+func (webSrv WebSrv) uploadFile(rw http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	chunk, err := ioutil.ReadAll(http.MaxBytesReader(rw, req.Body, filesMaxChunkSize))
+	if err != nil {
+		rejectRequest(rw, req, 400, err)
+		return
+	}
+	err = webSrv.config.authenticate(req, chunk)
+	if err != nil {
+		rejectRequest(rw, req, 401, err)
+		return
+	}
+	filePath, err := webSrv.sandboxPath(strings.TrimPrefix(req.URL.Path, filesUrlPrefix))
+	if err != nil {
+		rejectRequest(rw, req, 403, err)
+		return
+	}
+
+	if stat, err := os.Stat(filePath); err == nil && stat.IsDir() {
+		http.Error(rw, fmt.Sprintf("%s is directory", req.URL.Path), 409)
+		return
+	}
+
+	start, total, err := parseContentRange(req.Header.Get("Content-Range"), int64(len(chunk)))
+	if err != nil {
+		http.Error(rw, err.Error(), 400)
+		return
+	}
+
+	partPath := filePath + filesPartExt
+	var offset int64
+	if part, err := os.Stat(partPath); err == nil {
+		offset = part.Size()
+	}
+	if start != 0 && start != offset {
+		rw.Header().Set(filesHeaderOffset, strconv.FormatInt(offset, 10))
+		http.Error(rw, fmt.Sprintf("chunk starts at %d, uploaded %d", start, offset), 409)
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(filePath), filesDirPermission)
+	if err != nil {
+		http.Error(rw, err.Error(), 500)
+		return
+	}
+	flags := os.O_WRONLY | os.O_CREATE
+	if start == 0 {
+		flags |= os.O_TRUNC
+	}
+	part, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		logger.Printf("failed to open %s: %s\r\n", partPath, err)
+		http.Error(rw, err.Error(), 500)
+		return
+	}
+	_, err = part.WriteAt(chunk, start)
+	if err != nil {
+		part.Close()
+		logger.Printf("failed to write %s: %s\r\n", partPath, err)
+		http.Error(rw, err.Error(), 500)
+		return
+	}
+	err = part.Close()
+	if err != nil {
+		http.Error(rw, err.Error(), 500)
+		return
+	}
+
+	offset = start + int64(len(chunk))
+	rw.Header().Set(filesHeaderOffset, strconv.FormatInt(offset, 10))
+	if offset < total {
+		rw.WriteHeader(202)
+		return
+	}
+
+	info, err := completeUpload(partPath, filePath, req.Header.Get(filesHeaderSha256))
+	if err != nil {
+		logger.Printf("failed to complete upload of %s from %s: %s\r\n", filePath, req.RemoteAddr, err)
+		http.Error(rw, err.Error(), 422)
+		return
+	}
+	logger.Printf("uploaded %s %d bytes from %s\r\n", filePath, info.Size, req.RemoteAddr)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(201)
+	err = json.NewEncoder(rw).Encode(info)
+	if err != nil {
+		logger.Printf("failed to write upload result of %s: %s\r\n", filePath, err)
+	}
+}
+
+// Verifies checksum of uploaded part and renames it to file, part is removed if checksum is wrong
+func completeUpload(partPath, filePath, expectedSha256 string) (fileInfo, error) {
+	part, err := os.Open(partPath)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	checksum, err := fileSha256(part)
+	part.Close()
+	if err != nil {
+		return fileInfo{}, err
+	}
+	if expectedSha256 != "" && !strings.EqualFold(expectedSha256, checksum) {
+		os.Remove(partPath)
+		return fileInfo{}, fmt.Errorf("sha256 is %s, expected %s", checksum, expectedSha256)
+	}
+
+	// Rename does not replace existing file on Windows
+	err = os.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fileInfo{}, err
+	}
+	err = os.Rename(partPath, filePath)
+	if err != nil {
+		return fileInfo{}, err
+	}
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	cacheFileSha256(filePath, stat, checksum)
+	return fileInfo{Name: stat.Name(), Size: stat.Size(), ModTime: stat.ModTime(), Sha256: checksum}, nil
+}
+
+// Returns start and total size of "bytes {start}-{end}/{total}", whole file is chunk without range
+func parseContentRange(contentRange string, chunkSize int64) (int64, int64, error) {
+	if contentRange == "" {
+		return 0, chunkSize, nil
+	}
+	var start, end, total int64
+	_, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range '%s': %s", contentRange, err)
+	}
+	if start < 0 || end < start || end >= total || end-start+1 != chunkSize {
+		return 0, 0, fmt.Errorf("invalid Content-Range '%s' of %d bytes", contentRange, chunkSize)
+	}
+	return start, total, nil
+}
+
+// Returns checksum of file version from cache, it is computed and cached if compute is true,
+// otherwise checksum is empty if it is not cached
+func cachedFileSha256(filePath string, f *os.File, stat os.FileInfo, compute bool) (string, error) {
+	fileChecksumsMu.Lock()
+	cached, found := fileChecksums[filePath]
+	fileChecksumsMu.Unlock()
+	if found && cached.size == stat.Size() && cached.modTime.Equal(stat.ModTime()) {
+		return cached.sha256, nil
+	}
+	if !compute {
+		return "", nil
+	}
+
+	checksum, err := fileSha256(f)
+	if err != nil {
+		return "", err
+	}
+	cacheFileSha256(filePath, stat, checksum)
+	return checksum, nil
+}
+
+func cacheFileSha256(filePath string, stat os.FileInfo, checksum string) {
+	fileChecksumsMu.Lock()
+	defer fileChecksumsMu.Unlock()
+	if _, found := fileChecksums[filePath]; !found && len(fileChecksums) >= filesMaxChecksums {
+		// Any entry is dropped, it is computed again on next download
+		for p := range fileChecksums {
+			delete(fileChecksums, p)
+			break
+		}
+	}
+	fileChecksums[filePath] = fileChecksum{size: stat.Size(), modTime: stat.ModTime(), sha256: checksum}
+}
+
+func fileSha256(f *os.File) (string, error) {
+	h := sha256.New()
+	_, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// GET /zip/{path}
+func (webSrv WebSrv) zipFiles(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if req.Method != "GET" {
+		rejectRequest(rw, req, 405, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+	err := webSrv.config.authenticate(req, nil)
+	if err != nil {
+		rejectRequest(rw, req, 401, err)
+		return
+	}
+	dirPath, err := webSrv.sandboxPath(strings.TrimPrefix(req.URL.Path, filesZipUrlPrefix))
+	if err != nil {
+		rejectRequest(rw, req, 403, err)
+		return
+	}
+	stat, err := os.Stat(dirPath)
+	if err != nil || !stat.IsDir() {
+		http.Error(rw, fmt.Sprintf("directory %s not found", req.URL.Path), 404)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/zip")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", stat.Name()))
+	rw.Header().Set("Trailer", filesHeaderSha256)
+
+	h := sha256.New()
+	err = zipDir(io.MultiWriter(rw, h), dirPath)
+	if err != nil {
+		// Status is sent already, client gets broken archive without checksum
+		logger.Printf("failed to zip %s for %s: %s\r\n", dirPath, req.RemoteAddr, err)
+		return
+	}
+	rw.Header().Set(filesHeaderSha256, hex.EncodeToString(h.Sum(nil)))
+}
+
+func zipDir(w io.Writer, dirPath string) error {
+	zw := zip.NewWriter(w)
+	err := filepath.Walk(dirPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == dirPath || !(info.IsDir() || info.Mode().IsRegular()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dirPath, filePath)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = zw.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(fw, f)
+		return err
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadFileSha256(t *testing.T) {
+	webRoot, err := ioutil.TempDir("", "remoteagent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(webRoot)
+	webSrv := WebSrv{webRoot: webRoot, config: RemoteAgentConfig{Token: "secret"}}
+	filePath := filepath.Join(webRoot, "trace.etl")
+
+	download := func(rangeHeader string) (int, string) {
+		req := httptest.NewRequest("GET", filesUrlPrefix+"trace.etl", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rw := httptest.NewRecorder()
+		webSrv.downloadFile(rw, req)
+		return rw.Code, rw.Header().Get(filesHeaderSha256)
+	}
+	sha := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+
+	err = ioutil.WriteFile(filePath, []byte("first version"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Range request of file without cached checksum gets no checksum
+	if code, checksum := download("bytes=0-4"); code != 206 || checksum != "" {
+		t.Errorf("got %d '%s', expected 206 without checksum", code, checksum)
+	}
+	if code, checksum := download(""); code != 200 || checksum != sha("first version") {
+		t.Errorf("got %d '%s', expected 200 %s", code, checksum, sha("first version"))
+	}
+	if code, checksum := download("bytes=0-4"); code != 206 || checksum != sha("first version") {
+		t.Errorf("got %d '%s', expected 206 with cached %s", code, checksum, sha("first version"))
+	}
+
+	// Changed file is read again
+	err = ioutil.WriteFile(filePath, []byte("second, longer version"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, checksum := download("bytes=0-4"); code != 206 || checksum != "" {
+		t.Errorf("got %d '%s' for changed file, expected 206 without checksum", code, checksum)
+	}
+	if code, checksum := download(""); code != 200 || checksum != sha("second, longer version") {
+		t.Errorf("got %d '%s', expected 200 %s", code, checksum, sha("second, longer version"))
+	}
+}
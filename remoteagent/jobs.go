@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Every command is executed as job with captured output:
+//
+//	POST /jobs[?wait=true&timeout=60s] with command JSON starts job
+//	GET /jobs/{id}[?wait=true&timeout=60s] returns job
+//
+// Job is returned as JSON, in wait mode response is sent when job is finished or timeout is expired,
+// status code is 202 if job is still running.
+const (
+	jobStatusRunning = "running"
+	jobStatusExited  = "exited"
+	jobStatusFailed  = "failed"
+	jobStatusKilled  = "killed"
+	jobStatusTimeout = "timeout"
+
+	jobDefaultWaitTimeout = 60 * time.Second
+	// Bytes of stdout and stderr kept per job, the rest is cut off from beginning
+	jobMaxOutput = 1 << 20
+	// Finished jobs kept for GET /jobs/{id}
+	jobMaxFinished = 1000
+)
+
+type job struct {
+	ID        string     `json:"id"`
+	Cmd       string     `json:"cmd"`
+	Args      []string   `json:"args"`
+	Dir       string     `json:"dir,omitempty"`
+	Pid       int        `json:"pid"`
+	Status    string     `json:"status"`
+	Killed    bool       `json:"killed"`
+	Timeout   string     `json:"timeout,omitempty"`
+	TimedOut  bool       `json:"timedOut"`
+	ExitCode  int        `json:"exitCode"`
+	Error     string     `json:"error,omitempty"`
+	StartTime time.Time  `json:"startTime"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+	Stdout    string     `json:"stdout"`
+	Stderr    string     `json:"stderr"`
+
+	cmd    *exec.Cmd
+	group  *processGroup // nil if process group of command is not created
+	stdout *jobOutput
+	stderr *jobOutput
+	stream *streamHub
+	done   chan struct{}
+}
+
+// Keeps last jobMaxOutput bytes written and streams them as events of name
+type jobOutput struct {
+	mu     sync.Mutex
+	buf    []byte
+	name   string
+	stream *streamHub
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = map[string]*job{}
+)
+
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = append(o.buf, p...)
+	if len(o.buf) > jobMaxOutput {
+		o.buf = o.buf[len(o.buf)-jobMaxOutput:]
+	}
+	o.stream.publish(streamEvent{name: o.name, data: string(p)})
+	return len(p), nil
+}
+
+func (o *jobOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return string(o.buf)
+}
+
+// Starts command in background and registers job of it, process tree of command is killed after timeout if it is set
+func startJob(cmd *exec.Cmd, timeout, grace time.Duration) *job {
+	stream := newStreamHub()
+	j := &job{
+		ID:        newJobId(),
+		Cmd:       cmd.Args[0],
+		Args:      cmd.Args[1:],
+		Status:    jobStatusRunning,
+		StartTime: time.Now(),
+		Dir:       cmd.Dir,
+		cmd:       cmd,
+		stdout:    &jobOutput{name: "stdout", stream: stream},
+		stderr:    &jobOutput{name: "stderr", stream: stream},
+		stream:    stream,
+		done:      make(chan struct{}),
+	}
+	cmd.Stdout = j.stdout
+	cmd.Stderr = j.stderr
+	setProcessGroup(cmd)
+
+	jobsMu.Lock()
+	jobs[j.ID] = j
+	removeFinishedJobs()
+	jobsMu.Unlock()
+
+	err := cmd.Start()
+	if err != nil {
+		logger.Printf("failed to execute '%s' '%s': %s\r\n", cmd.Path, cmd.Args, err)
+		j.finish(jobStatusFailed, -1, err)
+		return j
+	}
+	group, err := newProcessGroup(cmd.Process)
+	if err != nil {
+		logger.Printf("job %s: children of process %d are not killed after it exits: %s\r\n", j.ID, cmd.Process.Pid, err)
+	}
+	jobsMu.Lock()
+	j.Pid = cmd.Process.Pid
+	j.group = group
+	jobsMu.Unlock()
+	logger.Printf("job %s started process %d: '%s' '%s'\r\n", j.ID, j.Pid, cmd.Path, cmd.Args)
+
+	if timeout > 0 {
+		j.Timeout = timeout.String()
+		go j.killAfter(timeout, grace)
+	}
+
+	go func() {
+		err := cmd.Wait()
+		exitCode := 0
+		if err != nil {
+			exitCode = -1
+			if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+				exitCode = status.ExitStatus()
+			}
+			logger.Printf("job %s: failed to execute '%s' '%s': %s\r\n", j.ID, cmd.Path, cmd.Args, err)
+		}
+		j.finish(jobStatusExited, exitCode, nil)
+		logger.Printf("job %s exited with code %d\r\n", j.ID, exitCode)
+	}()
+
+	return j
+}
+
+func (j *job) finish(status string, exitCode int, err error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	end := time.Now()
+	if status == jobStatusExited && j.TimedOut {
+		status = jobStatusTimeout
+	} else if status == jobStatusExited && j.Killed {
+		status = jobStatusKilled
+	}
+	j.Status = status
+	j.ExitCode = exitCode
+	j.EndTime = &end
+	if err != nil {
+		j.Error = err.Error()
+	}
+	close(j.done)
+	j.stream.close()
+}
+
+func (j *job) killAfter(timeout, grace time.Duration) {
+	if j.wait(timeout) {
+		return
+	}
+	jobsMu.Lock()
+	j.TimedOut = true
+	jobsMu.Unlock()
+	logger.Printf("job %s exceeded timeout %s\r\n", j.ID, timeout)
+
+	err := j.kill(true, grace)
+	if err != nil {
+		logger.Printf("failed to kill job %s: %s\r\n", j.ID, err)
+	}
+}
+
+// Returns copy of job with current output
+func (j *job) snapshot() job {
+	jobsMu.Lock()
+	s := *j
+	jobsMu.Unlock()
+	s.Stdout = j.stdout.String()
+	s.Stderr = j.stderr.String()
+	return s
+}
+
+// Waits for job to finish, returns false if timeout is expired
+func (j *job) wait(timeout time.Duration) bool {
+	select {
+	case <-j.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func newJobId() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Removes the oldest finished jobs above jobMaxFinished, jobsMu must be locked
+func removeFinishedJobs() {
+	var finished []*job
+	for _, j := range jobs {
+		if j.EndTime != nil {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= jobMaxFinished {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[a].EndTime.Before(*finished[b].EndTime)
+	})
+	for _, j := range finished[:len(finished)-jobMaxFinished] {
+		// Job with running children is kept to be killed by cleanup
+		if j.group != nil {
+			if j.group.alive() {
+				continue
+			}
+			j.group.close()
+		}
+		delete(jobs, j.ID)
+	}
+}
+
+// POST /jobs
+func (webSrv WebSrv) jobs(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if req.Method != "POST" {
+		rejectRequest(rw, req, 405, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+
+	wait, timeout, err := jobWaitParams(req)
+	if err != nil {
+		http.Error(rw, err.Error(), 400)
+		return
+	}
+
+	cmd, cmdTimeout, ok := webSrv.readCommand(rw, req)
+	if !ok {
+		return
+	}
+
+	j := startJob(cmd, cmdTimeout, webSrv.config.Cleanup.gracePeriod)
+	writeJob(rw, j, wait, timeout, 201)
+}
+
+// GET /jobs/{id} and /jobs/{id}/stream
+func (webSrv WebSrv) job(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if req.Method != "GET" {
+		rejectRequest(rw, req, 405, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+
+	err := webSrv.config.authenticate(req, nil)
+	if err != nil {
+		rejectRequest(rw, req, 401, err)
+		return
+	}
+
+	wait, timeout, err := jobWaitParams(req)
+	if err != nil {
+		http.Error(rw, err.Error(), 400)
+		return
+	}
+
+	id := strings.TrimPrefix(req.URL.Path, "/jobs/")
+	stream := strings.HasSuffix(id, streamSuffix)
+	id = strings.TrimSuffix(id, streamSuffix)
+	jobsMu.Lock()
+	j, found := jobs[id]
+	jobsMu.Unlock()
+	if !found {
+		http.Error(rw, fmt.Sprintf("job %s not found", id), 404)
+		return
+	}
+
+	if stream {
+		streamJob(rw, req, j)
+		return
+	}
+	writeJob(rw, j, wait, timeout, 200)
+}
+
+func jobWaitParams(req *http.Request) (bool, time.Duration, error) {
+	query := req.URL.Query()
+	wait := query.Get("wait") == "true"
+	timeout := jobDefaultWaitTimeout
+	if t := query.Get("timeout"); t != "" {
+		var err error
+		timeout, err = time.ParseDuration(t)
+		if err != nil {
+			// Seconds without unit
+			seconds, errSeconds := strconv.ParseFloat(t, 64)
+			if errSeconds != nil {
+				return wait, timeout, fmt.Errorf("invalid timeout '%s': %s", t, err)
+			}
+			timeout = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return wait, timeout, nil
+}
+
+func writeJob(rw http.ResponseWriter, j *job, wait bool, timeout time.Duration, code int) {
+	if wait && !j.wait(timeout) {
+		code = 202
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	err := json.NewEncoder(rw).Encode(j.snapshot())
+	if err != nil {
+		logger.Printf("failed to write job %s: %s\r\n", j.ID, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/oneumyvakin/osext"
 
 	"net/http"
+	"io"
 	"log"
 	"fmt"
 	"flag"
@@ -16,6 +17,7 @@ import (
 	"io/ioutil"
 	"runtime"
 	"strings"
+	"time"
 )
 
 const (
@@ -31,17 +33,26 @@ var (
 
 type WebSrv struct {
 	webRoot string
+	config RemoteAgentConfig
 }
 
 type RemoteAgentConfig struct {
 	Listen string `json:"listen"`
 	Port string `json:"port"`
 	PortTls string `json:"portTls"`
+	Token string `json:"token"`
+	HmacKey string `json:"hmacKey"`
+	Allow []RemoteAgentAllowRule `json:"allow"`
+	Cleanup RemoteAgentCleanup `json:"cleanup"`
 }
 
 type RemoteAgentCommand struct {
 	Cmd string `json:"cmd"`
 	Args string `json:"args"`
+	// Optional absolute working directory, extra environment variables and timeout like "30s"
+	Cwd string `json:"cwd"`
+	Env map[string]string `json:"env"`
+	Timeout string `json:"timeout"`
 }
 
 func main() {
@@ -61,12 +72,30 @@ func main() {
 	portTls := flag.String("portTls", raConfig.PortTls, "Listen port for secure connections. Default: 8087")
 	tlsCertFile := flag.String("tlsCertFile", "websrv-tls.crt", "TLS certificate file path. Default: websrv-tls.crt")
 	tlsKeyFile := flag.String("tlsKeyFile", "websrv-tls.key", "TLS key file path. Default: websrv-tls.key")
-	webRoot := flag.String("webRoot", root, "Absolute path to web root. Default: current directory")
+	webRoot := flag.String("webRoot", filepath.Join(root, "webroot"), "Absolute path to web root, file transfer is sandboxed in it. Default: webroot in agent directory")
 	flag.Parse()
 
-	webSrv := WebSrv{webRoot:*webRoot}
+	if raConfig.Token == "" && raConfig.HmacKey == "" {
+		logger.Printf("neither token nor hmacKey is configured in %s, all commands will be rejected\n", configFileName)
+	}
+
+	err = os.MkdirAll(*webRoot, filesDirPermission)
+	if err != nil {
+		logger.Printf("failed to create web root %s: %s\n", *webRoot, err)
+	}
+
+	webSrv := WebSrv{webRoot:*webRoot, config:raConfig}
 
 	http.HandleFunc("/", webSrv.index)
+	http.HandleFunc("/jobs", webSrv.jobs)
+	http.HandleFunc("/jobs/", webSrv.job)
+	http.HandleFunc("/processes", webSrv.processes)
+	http.HandleFunc("/processes/", webSrv.process)
+	http.HandleFunc(filesUrlPrefix, webSrv.files)
+	http.HandleFunc(filesZipUrlPrefix, webSrv.zipFiles)
+	http.HandleFunc(streamUrlLog, webSrv.streamLog)
+
+	startCleanup(raConfig.Cleanup)
 
 	_, errCrtFile := os.Stat(*tlsCertFile)
 	_, errKeyFile := os.Stat(*tlsKeyFile)
@@ -97,6 +126,7 @@ func NewRemoteAgentConfig() (RemoteAgentConfig, error) {
 		Listen:  configDefaultListen,
 		Port:    configDefaultPort,
 		PortTls: configDefaultPortTLS,
+		Cleanup: RemoteAgentCleanup{gracePeriod: cleanupDefaultGracePeriod},
 	}
 
 	if _, err := os.Stat(configFileName); err != nil {
@@ -113,35 +143,86 @@ func NewRemoteAgentConfig() (RemoteAgentConfig, error) {
 		return rac, err
 	}
 
+	err = rac.Cleanup.parse()
+	if err != nil {
+		return rac, err
+	}
+
+	// Invalid allowlist allows nothing
+	err = rac.compileAllowlist()
+	if err != nil {
+		rac.Allow = nil
+		return rac, err
+	}
+
 	return rac, nil
 }
 
 func (webSrv WebSrv) index(rw http.ResponseWriter, req *http.Request) {
 	if req.Method == "GET" {
-		errMsg := "method GET not allowed\r\n"
-		logger.Print(errMsg)
-		http.Error(rw, errMsg, 403)
+		rejectRequest(rw, req, 403, fmt.Errorf("method GET not allowed"))
 		return
 	}
-	rw.Header().Set("Access-Control-Allow-Origin", "*")
 	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 
+	cmd, timeout, ok := webSrv.readCommand(rw, req)
+	if !ok {
+		return
+	}
+
+	startJob(cmd, timeout, webSrv.config.Cleanup.gracePeriod)
+
+	msg := fmt.Sprintf("execute on RemoteAgent: \"%s\" %s\r\n", cmd.Args[0], cmd.Args[1:])
+	fmt.Fprint(rw, msg)
+	logger.Print(msg)
+}
+
+// Authenticates request and returns allowed command of request body with its timeout, writes error response if not ok
+func (webSrv WebSrv) readCommand(rw http.ResponseWriter, req *http.Request) (*exec.Cmd, time.Duration, bool) {
 	defer req.Body.Close()
 
-	decoder := json.NewDecoder(req.Body)
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, req.Body, authMaxBodySize))
+	if err != nil {
+		rejectRequest(rw, req, 400, err)
+		return nil, 0, false
+	}
+
+	err = webSrv.config.authenticate(req, body)
+	if err != nil {
+		rejectRequest(rw, req, 401, err)
+		return nil, 0, false
+	}
 
 	remoteCmd := RemoteAgentCommand{}
-	err := decoder.Decode(&remoteCmd)
+	err = json.Unmarshal(body, &remoteCmd)
 	if err != nil {
 		errMsg := fmt.Sprintf("failed to decode json: '%s'\r\n", err.Error())
 		logger.Print(errMsg)
 		http.Error(rw, errMsg, 400)
-		return
+		return nil, 0, false
 	}
 
 	if runtime.GOOS == "linux" {
 		remoteCmd.Cmd = strings.Replace(remoteCmd.Cmd, `\`, "/", -1)
 		remoteCmd.Args = strings.Replace(remoteCmd.Args, `\`, "/", -1)
+		remoteCmd.Cwd = strings.Replace(remoteCmd.Cwd, `\`, "/", -1)
+	}
+
+	var timeout time.Duration
+	if remoteCmd.Timeout != "" {
+		timeout, err = time.ParseDuration(remoteCmd.Timeout)
+		if err != nil || timeout <= 0 {
+			errMsg := fmt.Sprintf("invalid timeout '%s' of '%s'\r\n", remoteCmd.Timeout, remoteCmd.Cmd)
+			logger.Print(errMsg)
+			http.Error(rw, errMsg, 400)
+			return nil, 0, false
+		}
+	}
+
+	timeout, err = webSrv.config.allowed(remoteCmd, timeout)
+	if err != nil {
+		rejectRequest(rw, req, 403, err)
+		return nil, 0, false
 	}
 
 	args, err := stringargv.Parse(remoteCmd.Args)
@@ -149,27 +230,26 @@ func (webSrv WebSrv) index(rw http.ResponseWriter, req *http.Request) {
 		errMsg := fmt.Sprintf("failed to parse args '%s' '%s': %s\r\n", remoteCmd.Cmd, remoteCmd.Args, err)
 		logger.Print(errMsg)
 		http.Error(rw, errMsg, 400)
-		return
+		return nil, 0, false
 	}
 
 	cmd := exec.Command(
 		remoteCmd.Cmd,
 		args...,
 	)
-
-	go cmdRunner(cmd)
-
-	msg := fmt.Sprintf("execute on RemoteAgent: \"%s\" %s\r\n", remoteCmd.Cmd, args)
-	fmt.Fprintf(rw, msg)
-	logger.Print(msg)
-}
-
-func cmdRunner(cmd *exec.Cmd) {
-	err := cmd.Run()
-	if err != nil {
-		logger.Printf("failed to execute '%s' '%s': %s\r\n", cmd.Path, cmd.Args, err)
-		return
+	if webSrv.inWebRoot(cmd.Path) {
+		rejectRequest(rw, req, 403, fmt.Errorf("command '%s' is in web root", cmd.Path))
+		return nil, 0, false
 	}
+	cmd.Dir = remoteCmd.Cwd
+	if len(remoteCmd.Env) > 0 {
+		cmd.Env = os.Environ()
+		for name, value := range remoteCmd.Env {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+
+	return cmd, timeout, true
 }
 
 func newLogger(logFilePath string) *log.Logger {
@@ -178,5 +258,5 @@ func newLogger(logFilePath string) *log.Logger {
 		log.Fatal("Failed to open log file "+logFilePath, err)
 	}
 
-	return log.New(logFile, os.Args[0]+": ", log.Ldate|log.Ltime|log.Lshortfile)
+	return log.New(io.MultiWriter(logFile, streamWriter{hub: logStream, name: "log"}), os.Args[0]+": ", log.Ldate|log.Ltime|log.Lshortfile)
 }
\ No newline at end of file
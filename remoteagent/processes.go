@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Processes of running jobs can be listed and killed:
+//
+//	GET /processes
+//	POST /processes/{job id}/kill[?grace=5s]
+//	POST /processes/{job id}/killTree[?grace=5s]
+//
+// Process is asked to exit first and is killed if it is still running after grace period.
+// Process tree is process group on Unix and job object on Windows, it is listed and killed
+// while children are running after process of job exited, like "cmd /c start" or daemonizing wpr.
+// Leftovers are killed by cleanup policy of remoteagent.json:
+//
+//	{"cleanup": {"onShutdown": true, "maxLifetime": "2h", "gracePeriod": "5s"}}
+const (
+	cleanupDefaultGracePeriod = 5 * time.Second
+	cleanupCheckInterval      = 10 * time.Second
+)
+
+type RemoteAgentCleanup struct {
+	// Kill process trees of running jobs when agent is stopped
+	OnShutdown bool `json:"onShutdown"`
+	// Kill process tree of job running longer, empty is unlimited
+	MaxLifetime string `json:"maxLifetime"`
+	GracePeriod string `json:"gracePeriod"`
+
+	maxLifetime time.Duration
+	gracePeriod time.Duration
+}
+
+type processInfo struct {
+	JobID     string    `json:"jobId"`
+	Pid       int       `json:"pid"`
+	Cmd       string    `json:"cmd"`
+	Args      []string  `json:"args"`
+	StartTime time.Time `json:"startTime"`
+	// Process exited and its children are running
+	Exited bool `json:"exited"`
+}
+
+func (c *RemoteAgentCleanup) parse() error {
+	if c.GracePeriod != "" {
+		gracePeriod, err := time.ParseDuration(c.GracePeriod)
+		if err != nil {
+			return fmt.Errorf("cleanup gracePeriod: %s", err)
+		}
+		c.gracePeriod = gracePeriod
+	}
+	if c.MaxLifetime != "" {
+		maxLifetime, err := time.ParseDuration(c.MaxLifetime)
+		if err != nil {
+			return fmt.Errorf("cleanup maxLifetime: %s", err)
+		}
+		c.maxLifetime = maxLifetime
+	}
+	return nil
+}
+
+// Starts killing of jobs by cleanup policy
+func startCleanup(c RemoteAgentCleanup) {
+	if c.OnShutdown {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			s := <-signals
+			logger.Printf("%s: kill running jobs\r\n", s)
+			killJobs(runningJobs(), c.gracePeriod)
+			os.Exit(0)
+		}()
+	}
+
+	if c.maxLifetime > 0 {
+		go func() {
+			for range time.Tick(cleanupCheckInterval) {
+				var expired []*job
+				for _, j := range runningJobs() {
+					if time.Since(j.StartTime) > c.maxLifetime {
+						logger.Printf("job %s is running longer than %s\r\n", j.ID, c.maxLifetime)
+						expired = append(expired, j)
+					}
+				}
+				killJobs(expired, c.gracePeriod)
+			}
+		}()
+	}
+}
+
+func runningJobs() []*job {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	var running []*job
+	for _, j := range jobs {
+		if j.running() || j.childrenRunning() {
+			running = append(running, j)
+		}
+	}
+	return running
+}
+
+// Process of job is running, jobsMu must be locked
+func (j *job) running() bool {
+	return j.EndTime == nil && j.Pid != 0
+}
+
+// Children of job are running after its process exited, jobsMu must be locked
+func (j *job) childrenRunning() bool {
+	return j.EndTime != nil && j.group != nil && j.group.alive()
+}
+
+// Kills process trees of jobs in parallel
+func killJobs(killed []*job, grace time.Duration) {
+	var wg sync.WaitGroup
+	for _, j := range killed {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			err := j.kill(true, grace)
+			if err != nil {
+				logger.Printf("failed to kill job %s: %s\r\n", j.ID, err)
+			}
+		}(j)
+	}
+	wg.Wait()
+}
+
+// Asks process or process tree of job to exit and kills it after grace period
+func (j *job) kill(tree bool, grace time.Duration) error {
+	jobsMu.Lock()
+	running, childrenRunning, group := j.running(), tree && j.childrenRunning(), j.group
+	if !running && !childrenRunning {
+		jobsMu.Unlock()
+		return fmt.Errorf("job %s is not running", j.ID)
+	}
+	if running {
+		j.Killed = true
+	}
+	jobsMu.Unlock()
+
+	if !running {
+		return j.killGroup(group, grace)
+	}
+
+	logger.Printf("job %s: terminate process %d, tree %t\r\n", j.ID, j.Pid, tree)
+	err := terminateProcess(j.cmd.Process, tree)
+	if err != nil {
+		logger.Printf("job %s: failed to terminate process %d: %s\r\n", j.ID, j.Pid, err)
+	}
+	if err != nil || !j.wait(grace) {
+		logger.Printf("job %s: kill process %d, tree %t\r\n", j.ID, j.Pid, tree)
+		err = killProcess(j.cmd.Process, tree)
+	}
+
+	// Children left after process exited
+	if tree && group != nil && group.alive() {
+		logger.Printf("job %s: kill children of process %d\r\n", j.ID, j.Pid)
+		return group.kill()
+	}
+	return err
+}
+
+// Asks children left after process of job exited to exit and kills them after grace period
+func (j *job) killGroup(group *processGroup, grace time.Duration) error {
+	logger.Printf("job %s: terminate children of process %d\r\n", j.ID, j.Pid)
+	err := group.terminate()
+	if err != nil {
+		logger.Printf("job %s: failed to terminate children of process %d: %s\r\n", j.ID, j.Pid, err)
+	}
+	for deadline := time.Now().Add(grace); err == nil && time.Now().Before(deadline) && group.alive(); {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !group.alive() {
+		return nil
+	}
+
+	logger.Printf("job %s: kill children of process %d\r\n", j.ID, j.Pid)
+	return group.kill()
+}
+
+// GET /processes
+func (webSrv WebSrv) processes(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if req.Method != "GET" {
+		rejectRequest(rw, req, 405, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+
+	err := webSrv.config.authenticate(req, nil)
+	if err != nil {
+		rejectRequest(rw, req, 401, err)
+		return
+	}
+
+	list := []processInfo{}
+	jobsMu.Lock()
+	for _, j := range jobs {
+		if j.running() || j.childrenRunning() {
+			list = append(list, processInfo{JobID: j.ID, Pid: j.Pid, Cmd: j.Cmd, Args: j.Args, StartTime: j.StartTime, Exited: !j.running()})
+		}
+	}
+	jobsMu.Unlock()
+
+	rw.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(rw).Encode(list)
+	if err != nil {
+		logger.Printf("failed to write processes: %s\r\n", err)
+	}
+}
+
+// POST /processes/{job id}/kill and /processes/{job id}/killTree
+func (webSrv WebSrv) process(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if req.Method != "POST" {
+		rejectRequest(rw, req, 405, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+
+	err := webSrv.config.authenticate(req, nil)
+	if err != nil {
+		rejectRequest(rw, req, 401, err)
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(req.URL.Path, "/processes/"), "/")
+	if len(path) != 2 || (path[1] != "kill" && path[1] != "killTree") {
+		http.Error(rw, fmt.Sprintf("unknown action %s", req.URL.Path), 404)
+		return
+	}
+	id, tree := path[0], path[1] == "killTree"
+
+	grace := webSrv.config.Cleanup.gracePeriod
+	if g := req.URL.Query().Get("grace"); g != "" {
+		grace, err = time.ParseDuration(g)
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("invalid grace '%s': %s", g, err), 400)
+			return
+		}
+	}
+
+	jobsMu.Lock()
+	j, found := jobs[id]
+	jobsMu.Unlock()
+	if !found {
+		http.Error(rw, fmt.Sprintf("job %s not found", id), 404)
+		return
+	}
+
+	err = j.kill(tree, grace)
+	if err != nil {
+		http.Error(rw, err.Error(), 409)
+		return
+	}
+
+	writeJob(rw, j, true, cleanupDefaultGracePeriod, 200)
+}
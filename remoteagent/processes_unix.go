@@ -0,0 +1,54 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Process tree is process group of started process
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Process group outlives started process while its children are running,
+// children which start own session like daemons are not in it
+type processGroup struct {
+	pgid int
+}
+
+func newProcessGroup(p *os.Process) (*processGroup, error) {
+	return &processGroup{pgid: p.Pid}, nil
+}
+
+func (g *processGroup) alive() bool {
+	return syscall.Kill(-g.pgid, 0) == nil
+}
+
+func (g *processGroup) terminate() error {
+	return syscall.Kill(-g.pgid, syscall.SIGTERM)
+}
+
+func (g *processGroup) kill() error {
+	return syscall.Kill(-g.pgid, syscall.SIGKILL)
+}
+
+func (g *processGroup) close() {
+}
+
+func terminateProcess(p *os.Process, tree bool) error {
+	if tree {
+		return syscall.Kill(-p.Pid, syscall.SIGTERM)
+	}
+	return p.Signal(syscall.SIGTERM)
+}
+
+func killProcess(p *os.Process, tree bool) error {
+	if tree {
+		return syscall.Kill(-p.Pid, syscall.SIGKILL)
+	}
+	return p.Kill()
+}
@@ -0,0 +1,55 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// Shell exits at once and leaves background child in its process group like daemonizing tools
+func TestKillJobsChildrenAfterExit(t *testing.T) {
+	oldLogger := logger
+	logger = log.New(ioutil.Discard, "", 0)
+	defer func() { logger = oldLogger }()
+
+	j := startJob(exec.Command("sh", "-c", "sleep 30 >/dev/null 2>&1 & exit 0"), 0, time.Second)
+	if !j.wait(5 * time.Second) {
+		t.Fatalf("job %s is still running", j.ID)
+	}
+	if j.snapshot().Status != jobStatusExited {
+		t.Fatalf("got status %s, expected %s", j.snapshot().Status, jobStatusExited)
+	}
+
+	found := false
+	for _, running := range runningJobs() {
+		if running == j {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("job %s with running child is not in running jobs", j.ID)
+	}
+
+	// Process of job is not running, only its tree can be killed
+	err := j.kill(false, time.Second)
+	if err == nil {
+		t.Errorf("no error for kill of exited process")
+	}
+	killJobs([]*job{j}, time.Second)
+	for deadline := time.Now().Add(5 * time.Second); j.group.alive() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if j.group.alive() {
+		t.Errorf("child of job %s is running after kill", j.ID)
+	}
+	for _, running := range runningJobs() {
+		if running == j {
+			t.Errorf("job %s is running after kill", j.ID)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	createSuspended                     = 0x00000004
+	processSetQuota                     = 0x0100
+	processTerminate                    = 0x0001
+	processSuspendResume                = 0x0800
+	jobObjectBasicAccountingInformation = 1
+	jobObjectBasicProcessIdList         = 3
+	jobObjectMaxProcessIds              = 1024
+)
+
+var (
+	kernel32                      = syscall.NewLazyDLL("kernel32.dll")
+	ntdll                         = syscall.NewLazyDLL("ntdll.dll")
+	procCreateJobObjectW          = kernel32.NewProc("CreateJobObjectW")
+	procAssignProcessToJobObject  = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject        = kernel32.NewProc("TerminateJobObject")
+	procQueryInformationJobObject = kernel32.NewProc("QueryInformationJobObject")
+	procNtResumeProcess           = ntdll.NewProc("NtResumeProcess")
+)
+
+// Process is started suspended to be added to job object before it starts children
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: createSuspended}
+}
+
+// Job object of started process, children started by "cmd /c start" or daemonizing tools are in it
+// after started process exits
+type processGroup struct {
+	job syscall.Handle
+}
+
+type jobObjectBasicAccounting struct {
+	TotalUserTime             int64
+	TotalKernelTime           int64
+	ThisPeriodTotalUserTime   int64
+	ThisPeriodTotalKernelTime int64
+	TotalPageFaultCount       uint32
+	TotalProcesses            uint32
+	ActiveProcesses           uint32
+	TotalTerminatedProcesses  uint32
+}
+
+type jobObjectProcessIdList struct {
+	NumberOfAssignedProcesses uint32
+	NumberOfProcessIdsInList  uint32
+	ProcessIdList             [jobObjectMaxProcessIds]uintptr
+}
+
+// Assigns suspended process to new job object and resumes it, process is not left suspended on error
+func newProcessGroup(p *os.Process) (*processGroup, error) {
+	h, err := syscall.OpenProcess(processSetQuota|processTerminate|processSuspendResume, false, uint32(p.Pid))
+	if err != nil {
+		// Suspended process can not be resumed without handle
+		p.Kill()
+		return nil, fmt.Errorf("failed to open process %d: %s", p.Pid, err)
+	}
+	defer syscall.CloseHandle(h)
+
+	var g *processGroup
+	job, _, err := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		err = fmt.Errorf("failed to create job object: %s", err)
+	} else if r, _, errAssign := procAssignProcessToJobObject.Call(job, uintptr(h)); r == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		err = fmt.Errorf("failed to assign process %d to job object: %s", p.Pid, errAssign)
+	} else {
+		g = &processGroup{job: syscall.Handle(job)}
+		err = nil
+	}
+
+	if status, _, _ := procNtResumeProcess.Call(uintptr(h)); status != 0 {
+		if g != nil {
+			g.close()
+		}
+		return nil, fmt.Errorf("failed to resume process %d: NTSTATUS 0x%x", p.Pid, status)
+	}
+	return g, err
+}
+
+func (g *processGroup) alive() bool {
+	var info jobObjectBasicAccounting
+	r, _, _ := procQueryInformationJobObject.Call(uintptr(g.job), jobObjectBasicAccountingInformation,
+		uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info), 0)
+	return r != 0 && info.ActiveProcesses > 0
+}
+
+// Asks processes of job object to close their windows
+func (g *processGroup) terminate() error {
+	var list jobObjectProcessIdList
+	r, _, err := procQueryInformationJobObject.Call(uintptr(g.job), jobObjectBasicProcessIdList,
+		uintptr(unsafe.Pointer(&list)), unsafe.Sizeof(list), 0)
+	if r == 0 {
+		return fmt.Errorf("failed to list processes of job object: %s", err)
+	}
+	if list.NumberOfProcessIdsInList == 0 {
+		return nil
+	}
+	args := []string{}
+	for _, pid := range list.ProcessIdList[:list.NumberOfProcessIdsInList] {
+		args = append(args, "/PID", strconv.Itoa(int(pid)))
+	}
+	return exec.Command("taskkill", args...).Run()
+}
+
+func (g *processGroup) kill() error {
+	r, _, err := procTerminateJobObject.Call(uintptr(g.job), 1)
+	if r == 0 {
+		return fmt.Errorf("failed to terminate job object: %s", err)
+	}
+	return nil
+}
+
+func (g *processGroup) close() {
+	syscall.CloseHandle(g.job)
+}
+
+// Asks process to close its windows
+func terminateProcess(p *os.Process, tree bool) error {
+	return taskkill(p, tree, false)
+}
+
+func killProcess(p *os.Process, tree bool) error {
+	if !tree {
+		return p.Kill()
+	}
+	return taskkill(p, tree, true)
+}
+
+func taskkill(p *os.Process, tree, force bool) error {
+	args := []string{"/PID", strconv.Itoa(p.Pid)}
+	if tree {
+		args = append(args, "/T")
+	}
+	if force {
+		args = append(args, "/F")
+	}
+	return exec.Command("taskkill", args...).Run()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output of jobs and log of agent are streamed as Server-Sent Events:
+//
+//	GET /jobs/{id}/stream sends output captured so far and live output as "stdout" and "stderr" events,
+//	then "exit" event with job JSON
+//	GET /log/stream sends live "log" events
+//
+// Data of event is written as is, lines of it are "data:" lines. Slow client is disconnected.
+const (
+	streamUrlLog           = "/log/stream"
+	streamSuffix           = "/stream"
+	streamHeartbeat        = 15 * time.Second
+	streamSubscriberBuffer = 1024
+)
+
+type streamEvent struct {
+	name string
+	data string
+}
+
+// Sends events to subscribers
+type streamHub struct {
+	mu          sync.Mutex
+	subscribers map[chan streamEvent]bool
+	closed      bool
+}
+
+// Writes to hub as events of name
+type streamWriter struct {
+	hub  *streamHub
+	name string
+}
+
+var logStream = newStreamHub()
+
+func newStreamHub() *streamHub {
+	return &streamHub{subscribers: map[chan streamEvent]bool{}}
+}
+
+// Returns closed channel if hub is closed
+func (h *streamHub) subscribe() chan streamEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events := make(chan streamEvent, streamSubscriberBuffer)
+	if h.closed {
+		close(events)
+		return events
+	}
+	h.subscribers[events] = true
+	return events
+}
+
+func (h *streamHub) unsubscribe(events chan streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[events] {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+func (h *streamHub) publish(e streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for events := range h.subscribers {
+		select {
+		case events <- e:
+		default:
+			// Subscriber does not keep up
+			delete(h.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// Closes channels of subscribers
+func (h *streamHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for events := range h.subscribers {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+func (w streamWriter) Write(p []byte) (int, error) {
+	w.hub.publish(streamEvent{name: w.name, data: string(p)})
+	return len(p), nil
+}
+
+// GET /jobs/{id}/stream
+func streamJob(rw http.ResponseWriter, req *http.Request, j *job) {
+	// Captured output and subscription are taken at once to not lose or repeat output
+	j.stdout.mu.Lock()
+	j.stderr.mu.Lock()
+	replay := []streamEvent{
+		{name: j.stdout.name, data: string(j.stdout.buf)},
+		{name: j.stderr.name, data: string(j.stderr.buf)},
+	}
+	events := j.stream.subscribe()
+	j.stderr.mu.Unlock()
+	j.stdout.mu.Unlock()
+	defer j.stream.unsubscribe(events)
+
+	flusher, ok := streamStart(rw)
+	if !ok {
+		return
+	}
+	for _, e := range replay {
+		if e.data != "" {
+			writeStreamEvent(rw, e)
+		}
+	}
+	flusher.Flush()
+
+	if !streamEvents(rw, req, flusher, events) {
+		return
+	}
+	select {
+	case <-j.done:
+	default:
+		// Client is disconnected as slow
+		return
+	}
+
+	// Output is not repeated in exit event
+	s := j.snapshot()
+	s.Stdout, s.Stderr = "", ""
+	data, err := jsonString(s)
+	if err != nil {
+		logger.Printf("failed to encode job %s: %s\r\n", j.ID, err)
+		return
+	}
+	writeStreamEvent(rw, streamEvent{name: "exit", data: data})
+	flusher.Flush()
+}
+
+// GET /log/stream
+func (webSrv WebSrv) streamLog(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		rejectRequest(rw, req, 405, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+	err := webSrv.config.authenticate(req, nil)
+	if err != nil {
+		rejectRequest(rw, req, 401, err)
+		return
+	}
+
+	events := logStream.subscribe()
+	defer logStream.unsubscribe(events)
+
+	flusher, ok := streamStart(rw)
+	if !ok {
+		return
+	}
+	flusher.Flush()
+	streamEvents(rw, req, flusher, events)
+}
+
+func streamStart(rw http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming is not supported", 500)
+		return nil, false
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(200)
+	return flusher, true
+}
+
+// Writes events until channel is closed, returns false if client is gone
+func streamEvents(rw http.ResponseWriter, req *http.Request, flusher http.Flusher, events chan streamEvent) bool {
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return true
+			}
+			writeStreamEvent(rw, e)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(rw, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-req.Context().Done():
+			return false
+		}
+	}
+}
+
+func jsonString(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func writeStreamEvent(rw http.ResponseWriter, e streamEvent) {
+	data := strings.Replace(e.data, "\r\n", "\n", -1)
+	data = strings.Replace(data, "\r", "\n", -1)
+	fmt.Fprintf(rw, "event: %s\n", e.name)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(rw, "data: %s\n", line)
+	}
+	fmt.Fprint(rw, "\n")
+}